@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// HeaderAPIKey carries the API key of a machine client
+	HeaderAPIKey = "X-API-Key"
+
+	apiKeyPrefix      = "ak_"
+	apiKeySecretBytes = 32
+
+	// apiKeyUsageDays is how long daily usage counters are kept
+	apiKeyUsageDays = 90
+)
+
+var (
+	// ErrInvalidAPIKey is returned for unknown and revoked keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyNotFound is returned when no key has the given ID
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// scopePattern accepts scopes such as products:read and inventory:write
+var scopePattern = regexp.MustCompile(`^[a-z][a-z_-]*:(read|write)$`)
+
+// APIKey is an API key issued to a partner or machine client. Only the SHA-256
+// hash of the key is stored; the key itself is shown once when it is issued.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	RateLimit string     `json:"rate_limit"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScopes reports whether the key was granted every one of scopes
+func (k *APIKey) HasScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		granted := false
+		for _, s := range k.Scopes {
+			if s == scope {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return false
+		}
+	}
+	return true
+}
+
+// APIKeyUsage is the request count of a key, in total and per day
+type APIKeyUsage struct {
+	Total    int64            `json:"total"`
+	Daily    map[string]int64 `json:"daily"`
+	LastUsed *time.Time       `json:"last_used,omitempty"`
+}
+
+// APIKeyStore keeps API keys and their usage counters in Redis. Keys are stored
+// under their hash, so a request is authenticated with a single lookup.
+type APIKeyStore struct {
+	redis *redis.Client
+}
+
+// NewAPIKeyStore creates a store on the given Redis client
+func NewAPIKeyStore(client *redis.Client) *APIKeyStore {
+	return &APIKeyStore{redis: client}
+}
+
+// hashAPIKey hashes a key for storage. Keys carry 256 random bits, so a fast
+// hash is enough; a password hash would only slow down every request.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiKeyHashKey(hash string) string { return "apikey:hash:" + hash }
+func apiKeyIDKey(id string) string     { return "apikey:id:" + id }
+func apiKeyUsageKey(id string) string  { return "apikey:usage:" + id }
+
+const apiKeyIDsKey = "apikey:ids"
+
+// Issue creates a key and returns it together with the plaintext key
+func (s *APIKeyStore) Issue(ctx context.Context, name string, scopes []string, rateLimit, createdBy string) (*APIKey, string, error) {
+	secret := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plaintext := apiKeyPrefix + hex.EncodeToString(secret)
+
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    plaintext[:len(apiKeyPrefix)+8],
+		Scopes:    scopes,
+		RateLimit: rateLimit,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash := hashAPIKey(plaintext)
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, apiKeyHashKey(hash), data, 0)
+	pipe.Set(ctx, apiKeyIDKey(key.ID), hash, 0)
+	pipe.SAdd(ctx, apiKeyIDsKey, key.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to store API key: %w", err)
+	}
+	return key, plaintext, nil
+}
+
+// Authenticate returns the active key matching a plaintext key
+func (s *APIKeyStore) Authenticate(ctx context.Context, plaintext string) (*APIKey, error) {
+	data, err := s.redis.Get(ctx, apiKeyHashKey(hashAPIKey(plaintext))).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return &key, nil
+}
+
+// Get returns a key by ID, including revoked keys
+func (s *APIKeyStore) Get(ctx context.Context, id string) (*APIKey, error) {
+	_, key, err := s.lookup(ctx, id)
+	return key, err
+}
+
+func (s *APIKeyStore) lookup(ctx context.Context, id string) (string, *APIKey, error) {
+	hash, err := s.redis.Get(ctx, apiKeyIDKey(id)).Result()
+	if err == redis.Nil {
+		return "", nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := s.redis.Get(ctx, apiKeyHashKey(hash)).Bytes()
+	if err == redis.Nil {
+		return "", nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", nil, err
+	}
+	return hash, &key, nil
+}
+
+// List returns every key, newest first
+func (s *APIKeyStore) List(ctx context.Context) ([]*APIKey, error) {
+	ids, err := s.redis.SMembers(ctx, apiKeyIDsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*APIKey, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.Get(ctx, id)
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Revoke disables a key. The record is kept so that its usage stays auditable.
+func (s *APIKeyStore) Revoke(ctx context.Context, id string) (*APIKey, error) {
+	hash, key, err := s.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	data, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redis.Set(ctx, apiKeyHashKey(hash), data, 0).Err(); err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return key, nil
+}
+
+// RecordUsage counts a request made with a key
+func (s *APIKeyStore) RecordUsage(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	dayKey := fmt.Sprintf("%s:%s", apiKeyUsageKey(id), now.Format("2006-01-02"))
+
+	pipe := s.redis.Pipeline()
+	pipe.HIncrBy(ctx, apiKeyUsageKey(id), "total", 1)
+	pipe.HSet(ctx, apiKeyUsageKey(id), "last_used", now.Unix())
+	pipe.Incr(ctx, dayKey)
+	pipe.Expire(ctx, dayKey, apiKeyUsageDays*24*time.Hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Usage returns the request counts of a key over the last days
+func (s *APIKeyStore) Usage(ctx context.Context, id string, days int) (*APIKeyUsage, error) {
+	totals, err := s.redis.HGetAll(ctx, apiKeyUsageKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &APIKeyUsage{Daily: make(map[string]int64, days)}
+	usage.Total, _ = strconv.ParseInt(totals["total"], 10, 64)
+	if lastUsed, err := strconv.ParseInt(totals["last_used"], 10, 64); err == nil {
+		t := time.Unix(lastUsed, 0).UTC()
+		usage.LastUsed = &t
+	}
+
+	pipe := s.redis.Pipeline()
+	today := time.Now().UTC()
+	counts := make(map[string]*redis.StringCmd, days)
+	for i := 0; i < days; i++ {
+		day := today.AddDate(0, 0, -i).Format("2006-01-02")
+		counts[day] = pipe.Get(ctx, fmt.Sprintf("%s:%s", apiKeyUsageKey(id), day))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for day, cmd := range counts {
+		if count, err := cmd.Int64(); err == nil {
+			usage.Daily[day] = count
+		}
+	}
+	return usage, nil
+}
+
+// IssueAPIKeyRequest is the body of POST /admin/api-keys
+type IssueAPIKeyRequest struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes" binding:"required,min=1"`
+	RateLimit string   `json:"rate_limit"`
+}
+
+// registerAPIKeyAdmin mounts the API key management endpoints. tiers are the
+// rate-limit tiers a key may be assigned.
+func registerAPIKeyAdmin(r gin.IRouter, keys *APIKeyStore, tiers map[string]RateLimitConfig) {
+	disabled := func(c *gin.Context) bool {
+		if keys != nil {
+			return false
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "API keys require Redis",
+			"code":  "API_KEYS_DISABLED",
+		})
+		return true
+	}
+
+	r.POST("/api-keys", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		var req IssueAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid API key request",
+				"code":    "INVALID_API_KEY_REQUEST",
+				"details": err.Error(),
+			})
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !scopePattern.MatchString(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid scope",
+					"code":    "INVALID_SCOPE",
+					"details": fmt.Sprintf("scope %q must look like resource:read or resource:write", scope),
+				})
+				return
+			}
+		}
+		if req.RateLimit == "" {
+			req.RateLimit = defaultRateLimitTier
+		}
+		if _, ok := tiers[req.RateLimit]; !ok && req.RateLimit != defaultRateLimitTier {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Unknown rate limit tier",
+				"code":    "INVALID_RATE_LIMIT",
+				"details": fmt.Sprintf("rate limit tier %q is not defined in the route table", req.RateLimit),
+			})
+			return
+		}
+
+		key, plaintext, err := keys.Issue(c.Request.Context(), req.Name, req.Scopes, req.RateLimit, middleware.UserID(c))
+		if err != nil {
+			log.Printf("Failed to issue API key: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to issue API key",
+				"code":  "API_KEY_ISSUE_FAILED",
+			})
+			return
+		}
+		log.Printf("Issued API key %s (%s) with scopes %v", key.ID, key.Name, key.Scopes)
+		c.JSON(http.StatusCreated, gin.H{
+			"api_key": key,
+			"key":     plaintext,
+		})
+	})
+
+	r.GET("/api-keys", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		list, err := keys.List(c.Request.Context())
+		if err != nil {
+			log.Printf("Failed to list API keys: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to list API keys",
+				"code":  "API_KEY_LIST_FAILED",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"api_keys": list})
+	})
+
+	r.GET("/api-keys/:id", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		key, err := keys.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			writeAPIKeyError(c, err)
+			return
+		}
+		usage, err := keys.Usage(c.Request.Context(), key.ID, 30)
+		if err != nil {
+			log.Printf("Failed to read API key usage: %v", err)
+		}
+		c.JSON(http.StatusOK, gin.H{"api_key": key, "usage": usage})
+	})
+
+	r.DELETE("/api-keys/:id", func(c *gin.Context) {
+		if disabled(c) {
+			return
+		}
+		key, err := keys.Revoke(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			writeAPIKeyError(c, err)
+			return
+		}
+		log.Printf("Revoked API key %s (%s)", key.ID, key.Name)
+		c.JSON(http.StatusOK, gin.H{"api_key": key})
+	})
+}
+
+func writeAPIKeyError(c *gin.Context, err error) {
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "API key not found",
+			"code":  "API_KEY_NOT_FOUND",
+		})
+		return
+	}
+	log.Printf("API key lookup failed: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "Failed to fetch API key",
+		"code":  "API_KEY_LOOKUP_FAILED",
+	})
+}
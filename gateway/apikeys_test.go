@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestAPIKeyStore creates a key store on an in-memory Redis
+func newTestAPIKeyStore(t *testing.T) (*miniredis.Miniredis, *APIKeyStore) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, NewAPIKeyStore(client)
+}
+
+// issue issues a key with scopes, failing the test on an error
+func issue(t *testing.T, keys *APIKeyStore, name string, scopes ...string) (*APIKey, string) {
+	t.Helper()
+	key, plaintext, err := keys.Issue(context.Background(), name, scopes, defaultRateLimitTier, "admin-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, plaintext
+}
+
+func TestAPIKeyIssueAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	server, keys := newTestAPIKeyStore(t)
+	key, plaintext := issue(t, keys, "partner", "products:read")
+
+	if !strings.HasPrefix(plaintext, apiKeyPrefix) || len(plaintext) != len(apiKeyPrefix)+2*apiKeySecretBytes {
+		t.Errorf("key %q, want %s followed by %d hex digits", plaintext, apiKeyPrefix, 2*apiKeySecretBytes)
+	}
+	if !strings.HasPrefix(plaintext, key.Prefix) || len(key.Prefix) != len(apiKeyPrefix)+8 {
+		t.Errorf("prefix %q does not identify key %q", key.Prefix, plaintext)
+	}
+	if key.CreatedBy != "admin-1" || key.RateLimit != defaultRateLimitTier {
+		t.Errorf("key %+v, want it created by admin-1 on the default tier", key)
+	}
+	// Only the hash of the key is stored
+	for _, name := range server.Keys() {
+		if strings.Contains(name+" "+valueOf(server, name), plaintext) {
+			t.Errorf("%s holds the plaintext key", name)
+		}
+	}
+
+	authenticated, err := keys.Authenticate(ctx, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated.ID != key.ID || authenticated.Name != "partner" {
+		t.Errorf("authenticated key %+v, want %s", authenticated, key.ID)
+	}
+	for _, wrong := range []string{"", plaintext + "0", plaintext[:len(plaintext)-1], key.Prefix} {
+		if _, err := keys.Authenticate(ctx, wrong); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("key %q: error %v, want %v", wrong, err, ErrInvalidAPIKey)
+		}
+	}
+
+	// Keys are listed newest first
+	newer, _ := issue(t, keys, "newer", "orders:read")
+	list, err := keys.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != newer.ID || list[1].ID != key.ID {
+		t.Errorf("listed %d keys, want %s then %s", len(list), newer.ID, key.ID)
+	}
+}
+
+// valueOf returns the value of a Redis string, or the members of a set
+func valueOf(server *miniredis.Miniredis, name string) string {
+	if value, err := server.Get(name); err == nil {
+		return value
+	}
+	if members, err := server.Members(name); err == nil {
+		return strings.Join(members, " ")
+	}
+	return ""
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	ctx := context.Background()
+	_, keys := newTestAPIKeyStore(t)
+	key, plaintext := issue(t, keys, "partner", "products:read")
+	other, otherPlaintext := issue(t, keys, "other", "products:read")
+
+	revoked, err := keys.Revoke(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.RevokedAt == nil {
+		t.Fatal("revoked key has no revocation time")
+	}
+	if _, err := keys.Authenticate(ctx, plaintext); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("revoked key: error %v, want %v", err, ErrInvalidAPIKey)
+	}
+	if _, err := keys.Authenticate(ctx, otherPlaintext); err != nil {
+		t.Errorf("key %s stopped working with another revoked: %v", other.ID, err)
+	}
+
+	// The record stays for auditing, and revoking again keeps the first time
+	stored, err := keys.Get(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RevokedAt == nil || !stored.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("stored revocation time %v, want %v", stored.RevokedAt, revoked.RevokedAt)
+	}
+	again, err := keys.Revoke(ctx, key.ID)
+	if err != nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("second revocation at %v, error %v, want the first at %v", again.RevokedAt, err, revoked.RevokedAt)
+	}
+
+	if _, err := keys.Revoke(ctx, "unknown"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("unknown key: error %v, want %v", err, ErrAPIKeyNotFound)
+	}
+}
+
+func TestAPIKeyHasScopes(t *testing.T) {
+	key := &APIKey{Scopes: []string{"products:read", "orders:write"}}
+	tests := []struct {
+		name   string
+		scopes []string
+		want   bool
+	}{
+		{"none required", nil, true},
+		{"one granted", []string{"products:read"}, true},
+		{"all granted", []string{"orders:write", "products:read"}, true},
+		{"one missing", []string{"products:read", "products:write"}, false},
+		{"read does not grant write", []string{"products:write"}, false},
+		{"write does not grant read", []string{"orders:read"}, false},
+		{"prefix of a scope", []string{"products"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := key.HasScopes(tt.scopes); got != tt.want {
+				t.Errorf("HasScopes(%v) = %v, want %v", tt.scopes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyUsage(t *testing.T) {
+	ctx := context.Background()
+	server, keys := newTestAPIKeyStore(t)
+	key, _ := issue(t, keys, "partner", "products:read")
+	other, _ := issue(t, keys, "other", "products:read")
+
+	for i := 0; i < 3; i++ {
+		if err := keys.RecordUsage(ctx, key.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A count from yesterday is part of the daily history
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	server.Set(apiKeyUsageKey(key.ID)+":"+yesterday, "5")
+
+	usage, err := keys.Usage(ctx, key.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if usage.Total != 3 || usage.Daily[today] != 3 || usage.Daily[yesterday] != 5 || len(usage.Daily) != 2 {
+		t.Errorf("usage %+v, want 3 in total and 3 today, 5 yesterday", usage)
+	}
+	if usage.LastUsed == nil || time.Since(*usage.LastUsed) > time.Minute {
+		t.Errorf("last used %v, want just now", usage.LastUsed)
+	}
+	// Daily counters expire
+	if ttl := server.TTL(apiKeyUsageKey(key.ID) + ":" + today); ttl != apiKeyUsageDays*24*time.Hour {
+		t.Errorf("daily counter expires in %s, want %d days", ttl, apiKeyUsageDays)
+	}
+
+	unused, err := keys.Usage(ctx, other.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unused.Total != 0 || len(unused.Daily) != 0 || unused.LastUsed != nil {
+		t.Errorf("usage of an unused key %+v, want none", unused)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	server, keys := newTestAPIKeyStore(t)
+	reader, readerKey := issue(t, keys, "reader", "products:read")
+	_, writerKey := issue(t, keys, "writer", "products:write")
+	revoked, revokedKey := issue(t, keys, "revoked", "products:read")
+	if _, err := keys.Revoke(ctx, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The upstream echoes the identity it was called with
+	r := gin.New()
+	route := RouteConfig{Auth: true, Scopes: []string{"products:read"}}
+	r.GET("/products", authenticate(func(c *gin.Context) { c.AbortWithStatus(http.StatusTeapot) }, keys, route), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"client": c.GetHeader(middleware.HeaderClientID),
+			"role":   c.GetHeader(middleware.HeaderUserRole),
+			"key":    c.GetHeader(HeaderAPIKey),
+		})
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		code   string
+	}{
+		{"granted", readerKey, http.StatusOK, ""},
+		{"missing scope", writerKey, http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		{"revoked", revokedKey, http.StatusUnauthorized, "INVALID_API_KEY"},
+		{"unknown", apiKeyPrefix + strings.Repeat("0", 2*apiKeySecretBytes), http.StatusUnauthorized, "INVALID_API_KEY"},
+		{"no key falls back to the bearer token", "", http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/products", nil)
+			if tt.key != "" {
+				req.Header.Set(HeaderAPIKey, tt.key)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			var body map[string]string
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if tt.code != "" && body["code"] != tt.code {
+				t.Errorf("code %q, want %q", body["code"], tt.code)
+			}
+			if tt.status == http.StatusOK {
+				if body["client"] != reader.ID || body["role"] != middleware.RoleService || body["key"] != "" {
+					t.Errorf("upstream saw %v, want client %s as a service without the key", body, reader.ID)
+				}
+			}
+		})
+	}
+
+	// Only the granted request is counted, off the request path
+	deadline := time.Now().Add(time.Second)
+	for {
+		usage, err := keys.Usage(ctx, reader.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if usage.Total == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("recorded %d requests of the reader key, want 1", usage.Total)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if usage, _ := keys.Usage(ctx, revoked.ID, 1); usage.Total != 0 {
+		t.Errorf("recorded %d requests of the revoked key, want none", usage.Total)
+	}
+
+	// Without Redis keys cannot be checked
+	server.Close()
+	req := httptest.NewRequest(http.MethodGet, "/products", nil)
+	req.Header.Set(HeaderAPIKey, readerKey)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d with Redis down, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestIssueAPIKeyValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, keys := newTestAPIKeyStore(t)
+	r := gin.New()
+	registerAPIKeyAdmin(r, keys, map[string]RateLimitConfig{"partner": {}})
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"valid", `{"name": "acme", "scopes": ["products:read", "inventory:write"], "rate_limit": "partner"}`, http.StatusCreated, ""},
+		{"default tier", `{"name": "acme", "scopes": ["products:read"]}`, http.StatusCreated, ""},
+		{"no name", `{"scopes": ["products:read"]}`, http.StatusBadRequest, "INVALID_API_KEY_REQUEST"},
+		{"no scopes", `{"name": "acme", "scopes": []}`, http.StatusBadRequest, "INVALID_API_KEY_REQUEST"},
+		{"invalid scope", `{"name": "acme", "scopes": ["products:delete"]}`, http.StatusBadRequest, "INVALID_SCOPE"},
+		{"unknown tier", `{"name": "acme", "scopes": ["products:read"], "rate_limit": "gold"}`, http.StatusBadRequest, "INVALID_RATE_LIMIT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			var body struct {
+				Code string `json:"code"`
+				Key  string `json:"key"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Code != tt.code {
+				t.Errorf("code %q, want %q", body.Code, tt.code)
+			}
+			if tt.status == http.StatusCreated && !strings.HasPrefix(body.Key, apiKeyPrefix) {
+				t.Errorf("response key %q, want the plaintext key", body.Key)
+			}
+		})
+	}
+}
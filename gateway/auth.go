@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// defaultRole is assumed for tokens issued without a role claim
+const defaultRole = "user"
+
+// stripIdentityHeaders removes identity headers supplied by the client so that
+// only values derived from a verified token ever reach the services
+func stripIdentityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, header := range middleware.IdentityHeaders {
+			c.Request.Header.Del(header)
+		}
+		c.Next()
+	}
+}
+
+// requireAuth verifies the bearer token issued by user-service and forwards its
+// user_id and role claims to the upstream as trusted identity headers
+func requireAuth(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Missing authorization header",
+				"code":  "MISSING_AUTH",
+			})
+			return
+		}
+
+		bearerToken := strings.Split(authHeader, " ")
+		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid authorization format",
+				"code":  "INVALID_AUTH_FORMAT",
+			})
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		parsedToken, err := jwt.ParseWithClaims(bearerToken[1], claims, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(jwtSecret), nil
+		})
+		if err != nil || !parsedToken.Valid {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid or expired token",
+				"code":  "INVALID_TOKEN",
+			})
+			return
+		}
+
+		userID, ok := claims["user_id"].(string)
+		if !ok || userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid token claims",
+				"code":  "INVALID_CLAIMS",
+			})
+			return
+		}
+
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = defaultRole
+		}
+
+		c.Set("user_id", userID)
+		c.Set("user_role", role)
+		c.Request.Header.Set(middleware.HeaderUserID, userID)
+		c.Request.Header.Set(middleware.HeaderUserRole, role)
+		c.Next()
+	}
+}
+
+// authenticate applies the route's authentication. Routes that declare scopes
+// admit API keys holding all of them; requests without a key, and every
+// request to other routes, need a bearer token when the route requires auth.
+func authenticate(jwtAuth gin.HandlerFunc, keys *APIKeyStore, route RouteConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader(HeaderAPIKey)
+		// The key is a credential for the gateway only and never reaches a service
+		c.Request.Header.Del(HeaderAPIKey)
+
+		switch {
+		case apiKey != "" && len(route.Scopes) > 0:
+			authenticateAPIKey(c, keys, apiKey, route.Scopes)
+		case route.Auth && apiKey != "" && c.GetHeader("Authorization") == "":
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "API keys are not accepted on this route",
+				"code":  "API_KEY_NOT_ALLOWED",
+			})
+		case route.Auth:
+			jwtAuth(c)
+		default:
+			c.Next()
+		}
+	}
+}
+
+// authenticateAPIKey verifies an API key and forwards its identity to the upstream
+func authenticateAPIKey(c *gin.Context, keys *APIKeyStore, apiKey string, scopes []string) {
+	if keys == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "API keys are not enabled",
+			"code":  "INVALID_API_KEY",
+		})
+		return
+	}
+
+	key, err := keys.Authenticate(c.Request.Context(), apiKey)
+	if errors.Is(err, ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid or revoked API key",
+			"code":  "INVALID_API_KEY",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("API key verification failed: %v", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "API key verification unavailable",
+			"code":  "AUTH_UNAVAILABLE",
+		})
+		return
+	}
+	if !key.HasScopes(scopes) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":   "Insufficient scope",
+			"code":    "INSUFFICIENT_SCOPE",
+			"details": fmt.Sprintf("API key requires scopes %s", strings.Join(scopes, ", ")),
+		})
+		return
+	}
+
+	// Usage is counted off the request path
+	go func(id string) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := keys.RecordUsage(ctx, id); err != nil {
+			log.Printf("Failed to record usage of API key %s: %v", id, err)
+		}
+	}(key.ID)
+
+	c.Set("client_id", key.ID)
+	c.Set("user_role", middleware.RoleService)
+	c.Set("scopes", key.Scopes)
+	c.Set("api_key_tier", key.RateLimit)
+	c.Request.Header.Set(middleware.HeaderClientID, key.ID)
+	c.Request.Header.Set(middleware.HeaderUserRole, middleware.RoleService)
+	c.Request.Header.Set(middleware.HeaderScopes, strings.Join(key.Scopes, " "))
+	c.Next()
+}
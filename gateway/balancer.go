@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Supported load balancing strategies
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyLeastOutstanding = "least_outstanding"
+	StrategyWeighted         = "weighted"
+)
+
+// Instance is a single healthy upstream endpoint returned by service discovery
+type Instance struct {
+	ID      string            `json:"id"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta"`
+}
+
+// Host returns the host:port pair used to reach the instance
+func (i *Instance) Host() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// Weight reads the "weight" key from the Consul service meta, defaulting to 1.
+// A weight of 0 drains the instance.
+func (i *Instance) Weight() int {
+	weight, err := strconv.Atoi(i.Meta["weight"])
+	if err != nil || weight < 0 {
+		return 1
+	}
+	return weight
+}
+
+// Balancer picks the instance that should serve the next request.
+// The returned release func must be called once the request has completed.
+type Balancer interface {
+	Pick(instances []*Instance) (*Instance, func())
+}
+
+// newBalancer creates a balancer for the given strategy name
+func newBalancer(strategy string) (Balancer, error) {
+	switch strategy {
+	case "", StrategyRoundRobin:
+		return &roundRobinBalancer{}, nil
+	case StrategyLeastOutstanding:
+		return &leastOutstandingBalancer{inflight: make(map[string]*int64)}, nil
+	case StrategyWeighted:
+		return &weightedBalancer{current: make(map[string]int)}, nil
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy: %s", strategy)
+	}
+}
+
+func noopRelease() {}
+
+// roundRobinBalancer cycles through instances in order
+type roundRobinBalancer struct {
+	next uint64
+}
+
+func (b *roundRobinBalancer) Pick(instances []*Instance) (*Instance, func()) {
+	if len(instances) == 0 {
+		return nil, noopRelease
+	}
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return instances[n%uint64(len(instances))], noopRelease
+}
+
+// leastOutstandingBalancer sends each request to the instance with the fewest
+// requests currently in flight through this gateway
+type leastOutstandingBalancer struct {
+	mu       sync.Mutex
+	inflight map[string]*int64
+	next     uint64
+}
+
+func (b *leastOutstandingBalancer) counter(id string) *int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counter, ok := b.inflight[id]
+	if !ok {
+		counter = new(int64)
+		b.inflight[id] = counter
+	}
+	return counter
+}
+
+func (b *leastOutstandingBalancer) Pick(instances []*Instance) (*Instance, func()) {
+	if len(instances) == 0 {
+		return nil, noopRelease
+	}
+
+	// Start scanning at a rotating offset so ties are spread evenly
+	offset := int(atomic.AddUint64(&b.next, 1) - 1)
+	var best *Instance
+	var bestCounter *int64
+	bestCount := int64(-1)
+	for i := range instances {
+		instance := instances[(offset+i)%len(instances)]
+		counter := b.counter(instance.ID)
+		count := atomic.LoadInt64(counter)
+		if bestCount == -1 || count < bestCount {
+			best, bestCounter, bestCount = instance, counter, count
+		}
+	}
+
+	atomic.AddInt64(bestCounter, 1)
+	var once sync.Once
+	return best, func() {
+		once.Do(func() { atomic.AddInt64(bestCounter, -1) })
+	}
+}
+
+// weightedBalancer implements smooth weighted round robin using the
+// "weight" key of each instance's Consul service meta
+type weightedBalancer struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (b *weightedBalancer) Pick(instances []*Instance) (*Instance, func()) {
+	if len(instances) == 0 {
+		return nil, noopRelease
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// When every instance is drained they share the requests equally
+	drained := true
+	for _, instance := range instances {
+		if instance.Weight() > 0 {
+			drained = false
+			break
+		}
+	}
+
+	var best *Instance
+	total := 0
+	seen := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		weight := instance.Weight()
+		if drained {
+			weight = 1
+		}
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		seen[instance.ID] = true
+		b.current[instance.ID] += weight
+		if best == nil || b.current[instance.ID] > b.current[best.ID] {
+			best = instance
+		}
+	}
+	b.current[best.ID] -= total
+
+	// Forget instances that have left the healthy set
+	for id := range b.current {
+		if !seen[id] {
+			delete(b.current, id)
+		}
+	}
+
+	return best, noopRelease
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// weightedInstances returns instances with the given weight meta, with IDs
+// i0, i1 and so on. An empty weight leaves the meta unset.
+func weightedInstances(weights ...string) []*Instance {
+	instances := make([]*Instance, len(weights))
+	for i, weight := range weights {
+		instances[i] = &Instance{ID: "i" + string(rune('0'+i)), Meta: map[string]string{}}
+		if weight != "" {
+			instances[i].Meta["weight"] = weight
+		}
+	}
+	return instances
+}
+
+// pickCounts picks n times, releasing each pick at once, and counts the picks
+// of each instance ID
+func pickCounts(b Balancer, instances []*Instance, n int) map[string]int {
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		instance, release := b.Pick(instances)
+		counts[instance.ID]++
+		release()
+	}
+	return counts
+}
+
+func TestBalancerDistribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		weights  []string
+		picks    int
+		want     map[string]int
+	}{
+		{"round robin", StrategyRoundRobin, []string{"", "", ""}, 9, map[string]int{"i0": 3, "i1": 3, "i2": 3}},
+		{"round robin ignores weights", StrategyRoundRobin, []string{"5", "1"}, 4, map[string]int{"i0": 2, "i1": 2}},
+		{"least outstanding spreads ties", StrategyLeastOutstanding, []string{"", "", ""}, 9, map[string]int{"i0": 3, "i1": 3, "i2": 3}},
+		{"weighted", StrategyWeighted, []string{"3", "1"}, 8, map[string]int{"i0": 6, "i1": 2}},
+		{"weighted three ways", StrategyWeighted, []string{"5", "1", "1"}, 14, map[string]int{"i0": 10, "i1": 2, "i2": 2}},
+		{"weight defaults to 1", StrategyWeighted, []string{"", "2"}, 6, map[string]int{"i0": 2, "i1": 4}},
+		{"invalid weights count as 1", StrategyWeighted, []string{"heavy", "-3"}, 4, map[string]int{"i0": 2, "i1": 2}},
+		{"weight 0 is drained", StrategyWeighted, []string{"0", "1", "1"}, 6, map[string]int{"i1": 3, "i2": 3}},
+		{"every instance drained", StrategyWeighted, []string{"0", "0"}, 4, map[string]int{"i0": 2, "i1": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newBalancer(tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := pickCounts(b, weightedInstances(tt.weights...), tt.picks)
+			if len(got) != len(tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("picked %s %d times, want %d", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedBalancerIsSmooth(t *testing.T) {
+	b, _ := newBalancer(StrategyWeighted)
+	instances := weightedInstances("2", "1")
+
+	// The heavier instance does not get its share in one burst
+	var picks []string
+	for i := 0; i < 6; i++ {
+		instance, _ := b.Pick(instances)
+		picks = append(picks, instance.ID)
+	}
+	if got := strings.Join(picks, ","); got != "i0,i1,i0,i0,i1,i0" {
+		t.Errorf("picked %s, want i0,i1,i0 twice", got)
+	}
+
+	// An instance that leaves and returns starts over
+	b.Pick(instances[:1])
+	if instance, _ := b.Pick(instances); instance.ID != "i0" {
+		t.Errorf("picked %s after i1 returned, want i0", instance.ID)
+	}
+}
+
+func TestLeastOutstandingBalancer(t *testing.T) {
+	b := &leastOutstandingBalancer{inflight: make(map[string]*int64)}
+	instances := weightedInstances("", "", "")
+
+	// Requests in flight keep the next one away from their instances
+	releases := map[string]func(){}
+	for i := 0; i < len(instances); i++ {
+		instance, release := b.Pick(instances)
+		if releases[instance.ID] != nil {
+			t.Fatalf("picked %s twice while it had a request in flight", instance.ID)
+		}
+		releases[instance.ID] = release
+	}
+
+	releases["i1"]()
+	if instance, release := b.Pick(instances); instance.ID != "i1" {
+		t.Errorf("picked %s, want i1 which has no request in flight", instance.ID)
+	} else {
+		release()
+	}
+
+	// Releasing twice does not free a request that is still in flight
+	releases["i1"]()
+	instance, _ := b.Pick(instances)
+	if instance.ID != "i1" {
+		t.Errorf("picked %s, want i1", instance.ID)
+	}
+	for id, want := range map[string]int64{"i0": 1, "i1": 1, "i2": 1} {
+		if got := atomic.LoadInt64(b.inflight[id]); got != want {
+			t.Errorf("%s has %d requests in flight, want %d", id, got, want)
+		}
+	}
+}
+
+func TestOutstandingRequestsAreReleased(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		instance http.Handler
+		policy   retryPolicy
+		// cancel cancels the request once it reached the instance
+		cancel bool
+		status int
+	}{
+		{"success", &countingInstance{status: http.StatusOK}, retryPolicy{}, false, http.StatusOK},
+		{"upstream error", &countingInstance{status: http.StatusInternalServerError}, retryPolicy{}, false, http.StatusInternalServerError},
+		{"retried errors", &countingInstance{status: http.StatusServiceUnavailable}, retryPolicy{retries: 2}, false, http.StatusServiceUnavailable},
+		{"dropped connection", dropConnection{}, retryPolicy{retries: 1}, false, http.StatusBadGateway},
+		{"per try timeout", &countingInstance{status: http.StatusOK, delay: time.Second}, retryPolicy{perTryTimeout: 10 * time.Millisecond}, false, http.StatusGatewayTimeout},
+		{"cancelled by the client", &countingInstance{status: http.StatusOK, delay: time.Minute}, retryPolicy{}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LB_STRATEGY_PRODUCT_SERVICE", StrategyLeastOutstanding)
+			gw := newTestGateway(t, map[string][]registry.Instance{
+				"product-service": testInstances(t, tt.instance, 3),
+			})
+			r := gin.New()
+			r.GET("/products", proxyToService(gw, "product-service", "/products", tt.policy))
+			server := serveTestGateway(t, r)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/products", nil)
+			if tt.cancel {
+				// The request reaches an instance before it is cancelled
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			switch {
+			case tt.cancel && err == nil:
+				resp.Body.Close()
+				t.Fatalf("status %d, want the request to be cancelled", resp.StatusCode)
+			case !tt.cancel && err != nil:
+				t.Fatal(err)
+			case !tt.cancel:
+				resp.Body.Close()
+				if resp.StatusCode != tt.status {
+					t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+				}
+			}
+
+			up, err := gw.upstream("product-service")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := up.balancer.(*leastOutstandingBalancer)
+			// The gateway notices the cancellation after the client returned
+			deadline := time.Now().Add(time.Second)
+			for {
+				b.mu.Lock()
+				var inflight int64
+				for _, counter := range b.inflight {
+					inflight += atomic.LoadInt64(counter)
+				}
+				b.mu.Unlock()
+				if inflight == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("%d requests still in flight", inflight)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// dropConnection is an upstream instance that closes the connection without
+// answering
+type dropConnection struct{}
+
+func (dropConnection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
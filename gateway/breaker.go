@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"e-commerce-platform/pkg/config"
+)
+
+// ErrCircuitOpen is returned when a breaker rejects a request
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Outcome is the result of a request admitted by a breaker
+type Outcome int
+
+const (
+	OutcomeSuccess Outcome = iota
+	OutcomeFailure
+	// OutcomeIgnored releases the request without counting it, e.g. when the client went away
+	OutcomeIgnored
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// MarshalJSON renders the state by name on admin endpoints
+func (s BreakerState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// BreakerConfig controls when a breaker opens and how it recovers
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker
+	FailureThreshold int `json:"failure_threshold"`
+	// OpenTimeout is how long the breaker stays open before letting probes through
+	OpenTimeout time.Duration `json:"open_timeout"`
+	// HalfOpenRequests is the number of successful probes needed to close again
+	HalfOpenRequests int `json:"half_open_requests"`
+}
+
+// OutlierConfig controls ejection of instances that keep returning 5xx
+type OutlierConfig struct {
+	// ErrorRate is the share of 5xx responses within Window that ejects an instance
+	ErrorRate float64 `json:"error_rate"`
+	// MinRequests is the number of requests within Window needed before ejecting
+	MinRequests int `json:"min_requests"`
+	// Window is the interval over which 5xx responses are counted
+	Window time.Duration `json:"window"`
+	// EjectionTime is the base ejection period, multiplied by the number of
+	// recent ejections. Every EjectionTime an instance spends back in rotation
+	// without being ejected again forgives one ejection.
+	EjectionTime time.Duration `json:"ejection_time"`
+	// MaxEjectionTime caps the ejection period
+	MaxEjectionTime time.Duration `json:"max_ejection_time"`
+	// MaxEjectionPercent caps the share of an upstream's instances ejected at once
+	MaxEjectionPercent int `json:"max_ejection_percent"`
+}
+
+// ResilienceConfig holds the breaker and ejection settings of one upstream
+type ResilienceConfig struct {
+	Service  BreakerConfig `json:"service"`
+	Instance BreakerConfig `json:"instance"`
+	Outlier  OutlierConfig `json:"outlier"`
+}
+
+// UpstreamConfig is the load balancing, breaker and retry settings of one
+// upstream, see config.Load. Every variable can be overridden per upstream
+// with a _<SERVICE> suffix, e.g. CB_FAILURE_THRESHOLD_ORDER_SERVICE.
+type UpstreamConfig struct {
+	Strategy string `env:"LB_STRATEGY" default:"round_robin" oneof:"round_robin least_outstanding weighted"`
+
+	ServiceFailureThreshold int           `env:"CB_SERVICE_FAILURE_THRESHOLD" default:"20" min:"1"`
+	ServiceOpenTimeout      time.Duration `env:"CB_SERVICE_OPEN_TIMEOUT" default:"15s" min:"1ms"`
+	FailureThreshold        int           `env:"CB_FAILURE_THRESHOLD" default:"5" min:"1"`
+	OpenTimeout             time.Duration `env:"CB_OPEN_TIMEOUT" default:"30s" min:"1ms"`
+	HalfOpenRequests        int           `env:"CB_HALF_OPEN_REQUESTS" default:"1" min:"1"`
+
+	OutlierErrorPercent       int           `env:"OUTLIER_ERROR_PERCENT" default:"50" min:"1" max:"100"`
+	OutlierMinRequests        int           `env:"OUTLIER_MIN_REQUESTS" default:"10" min:"1"`
+	OutlierWindow             time.Duration `env:"OUTLIER_WINDOW" default:"30s" min:"1ms"`
+	OutlierEjectionTime       time.Duration `env:"OUTLIER_EJECTION_TIME" default:"30s" min:"1ms"`
+	OutlierMaxEjectionTime    time.Duration `env:"OUTLIER_MAX_EJECTION_TIME" default:"5m" min:"1ms"`
+	OutlierMaxEjectionPercent int           `env:"OUTLIER_MAX_EJECTION_PERCENT" default:"50" min:"1" max:"100"`
+
+	RetryBudgetPercent int `env:"RETRY_BUDGET_PERCENT" default:"20" min:"1" max:"100"`
+}
+
+// loadUpstreamConfig loads the settings of a service, with the service's
+// overrides taking precedence
+func loadUpstreamConfig(serviceName string) (UpstreamConfig, error) {
+	var cfg UpstreamConfig
+	suffix := strings.ToUpper(strings.ReplaceAll(serviceName, "-", "_"))
+	if err := config.LoadFor(&cfg, suffix); err != nil {
+		return UpstreamConfig{}, fmt.Errorf("invalid configuration of upstream %s:\n%w", serviceName, err)
+	}
+	return cfg, nil
+}
+
+// resilience returns the breaker and ejection settings
+func (c UpstreamConfig) resilience() ResilienceConfig {
+	return ResilienceConfig{
+		Service: BreakerConfig{
+			FailureThreshold: c.ServiceFailureThreshold,
+			OpenTimeout:      c.ServiceOpenTimeout,
+			HalfOpenRequests: c.HalfOpenRequests,
+		},
+		Instance: BreakerConfig{
+			FailureThreshold: c.FailureThreshold,
+			OpenTimeout:      c.OpenTimeout,
+			HalfOpenRequests: c.HalfOpenRequests,
+		},
+		Outlier: OutlierConfig{
+			ErrorRate:          float64(c.OutlierErrorPercent) / 100,
+			MinRequests:        c.OutlierMinRequests,
+			Window:             c.OutlierWindow,
+			EjectionTime:       c.OutlierEjectionTime,
+			MaxEjectionTime:    c.OutlierMaxEjectionTime,
+			MaxEjectionPercent: c.OutlierMaxEjectionPercent,
+		},
+	}
+}
+
+// CircuitBreaker stops sending traffic to a target after consecutive failures.
+// Once OpenTimeout has passed it lets a limited number of probes through and
+// closes again when they succeed.
+type CircuitBreaker struct {
+	cfg BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	successes   int
+	probes      int
+	openedAt    time.Time
+	lastFailure time.Time
+}
+
+// BreakerStatus is a point-in-time view of a breaker
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	LastFailure         *time.Time   `json:"last_failure,omitempty"`
+}
+
+// NewCircuitBreaker creates a closed breaker
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{cfg: cfg}
+}
+
+// refresh moves an open breaker to half-open once its timeout has passed.
+// The caller must hold the lock.
+func (b *CircuitBreaker) refresh(now time.Time) {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.successes = 0
+		b.probes = 0
+	}
+}
+
+// Available reports whether Acquire would currently let a request through
+func (b *CircuitBreaker) Available() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		return b.probes < b.cfg.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// Acquire admits a request, returning ErrCircuitOpen when the breaker rejects it.
+// The returned func must be called with the outcome of the request.
+func (b *CircuitBreaker) Acquire() (func(Outcome), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case BreakerOpen:
+		return nil, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+	}
+
+	var once sync.Once
+	return func(outcome Outcome) {
+		once.Do(func() { b.record(outcome) })
+	}, nil
+}
+
+func (b *CircuitBreaker) record(outcome Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+
+	switch outcome {
+	case OutcomeIgnored:
+		return
+	case OutcomeSuccess:
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.successes++
+			if b.successes >= b.cfg.HalfOpenRequests {
+				b.state = BreakerClosed
+			}
+		}
+		return
+	}
+
+	b.failures++
+	b.lastFailure = now
+	if b.state == BreakerOpen {
+		return
+	}
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = now
+	}
+}
+
+// Status returns the current state of the breaker
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if !b.lastFailure.IsZero() {
+		lastFailure := b.lastFailure
+		status.LastFailure = &lastFailure
+	}
+	return status
+}
+
+// instanceHealth tracks the breaker and 5xx rate of one upstream instance
+type instanceHealth struct {
+	breaker *CircuitBreaker
+
+	windowStart  time.Time
+	requests     int
+	serverErrors int
+	ejectedUntil time.Time
+	ejections    int
+	// forgivenAt is when an ejection was last forgiven, see decay
+	forgivenAt time.Time
+}
+
+// decay forgives one ejection for every period the instance has spent back in
+// rotation since its last ejection ended, so that an instance that recovered
+// is not ejected for longer and longer when it fails again much later
+func (h *instanceHealth) decay(now time.Time, period time.Duration) {
+	if h.ejections == 0 || now.Before(h.ejectedUntil) {
+		return
+	}
+	if h.forgivenAt.Before(h.ejectedUntil) {
+		h.forgivenAt = h.ejectedUntil
+	}
+	periods := int(now.Sub(h.forgivenAt) / period)
+	if periods == 0 {
+		return
+	}
+	h.ejections = max(0, h.ejections-periods)
+	h.forgivenAt = h.forgivenAt.Add(time.Duration(periods) * period)
+}
+
+// InstanceStatus is the admin view of one upstream instance
+type InstanceStatus struct {
+	ID           string        `json:"id"`
+	Breaker      BreakerStatus `json:"breaker"`
+	Ejected      bool          `json:"ejected"`
+	EjectedUntil *time.Time    `json:"ejected_until,omitempty"`
+	Ejections    int           `json:"ejections"`
+	Requests     int           `json:"window_requests"`
+	ServerErrors int           `json:"window_server_errors"`
+}
+
+// UpstreamStatus is the admin view of an upstream's breakers
+type UpstreamStatus struct {
+	Service   string           `json:"service"`
+	Breaker   BreakerStatus    `json:"breaker"`
+	Instances []InstanceStatus `json:"instances"`
+	Config    ResilienceConfig `json:"config"`
+}
+
+// healthTracker holds the service breaker and per-instance health of one upstream
+type healthTracker struct {
+	cfg     ResilienceConfig
+	service *CircuitBreaker
+
+	mu        sync.Mutex
+	instances map[string]*instanceHealth
+}
+
+func newHealthTracker(cfg ResilienceConfig) *healthTracker {
+	return &healthTracker{
+		cfg:       cfg,
+		service:   NewCircuitBreaker(cfg.Service),
+		instances: make(map[string]*instanceHealth),
+	}
+}
+
+func (t *healthTracker) instance(id string) *instanceHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	health, ok := t.instances[id]
+	if !ok {
+		health = &instanceHealth{breaker: NewCircuitBreaker(t.cfg.Instance)}
+		t.instances[id] = health
+	}
+	return health
+}
+
+// prune forgets the instances that are no longer discovered
+func (t *healthTracker) prune(instances []*Instance) {
+	discovered := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		discovered[instance.ID] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.instances {
+		if !discovered[id] {
+			delete(t.instances, id)
+		}
+	}
+}
+
+// available filters out instances that are ejected or whose breaker is open
+func (t *healthTracker) available(instances []*Instance) []*Instance {
+	now := time.Now()
+	candidates := make([]*Instance, 0, len(instances))
+	for _, instance := range instances {
+		health := t.instance(instance.ID)
+		t.mu.Lock()
+		ejected := now.Before(health.ejectedUntil)
+		t.mu.Unlock()
+		if !ejected && health.breaker.Available() {
+			candidates = append(candidates, instance)
+		}
+	}
+	return candidates
+}
+
+// record feeds the outcome of a request into the outlier detector of an instance
+func (t *healthTracker) record(instance *Instance, instanceCount int, serverError bool) {
+	health := t.instance(instance.ID)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(health.windowStart) > t.cfg.Outlier.Window {
+		health.windowStart = now
+		health.requests = 0
+		health.serverErrors = 0
+	}
+	health.requests++
+	if serverError {
+		health.serverErrors++
+	}
+	health.decay(now, t.cfg.Outlier.EjectionTime)
+
+	if health.requests < t.cfg.Outlier.MinRequests || now.Before(health.ejectedUntil) {
+		return
+	}
+	if float64(health.serverErrors)/float64(health.requests) < t.cfg.Outlier.ErrorRate {
+		return
+	}
+
+	// Never eject more than the configured share of the upstream
+	ejected := 0
+	for _, other := range t.instances {
+		if now.Before(other.ejectedUntil) {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > instanceCount*t.cfg.Outlier.MaxEjectionPercent {
+		return
+	}
+
+	health.ejections++
+	health.ejectedUntil = now.Add(min(time.Duration(health.ejections)*t.cfg.Outlier.EjectionTime, t.cfg.Outlier.MaxEjectionTime))
+	health.requests = 0
+	health.serverErrors = 0
+}
+
+// status reports the breaker and ejection state for the admin endpoint
+func (t *healthTracker) status(serviceName string) UpstreamStatus {
+	status := UpstreamStatus{
+		Service:   serviceName,
+		Breaker:   t.service.Status(),
+		Instances: []InstanceStatus{},
+		Config:    t.cfg,
+	}
+
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.instances))
+	for id := range t.instances {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+	sort.Strings(ids)
+
+	now := time.Now()
+	for _, id := range ids {
+		health := t.instance(id)
+		instanceStatus := InstanceStatus{
+			ID:      id,
+			Breaker: health.breaker.Status(),
+		}
+
+		t.mu.Lock()
+		health.decay(now, t.cfg.Outlier.EjectionTime)
+		if now.Before(health.ejectedUntil) {
+			ejectedUntil := health.ejectedUntil
+			instanceStatus.Ejected = true
+			instanceStatus.EjectedUntil = &ejectedUntil
+		}
+		instanceStatus.Ejections = health.ejections
+		instanceStatus.Requests = health.requests
+		instanceStatus.ServerErrors = health.serverErrors
+		t.mu.Unlock()
+
+		status.Instances = append(status.Instances, instanceStatus)
+	}
+	return status
+}
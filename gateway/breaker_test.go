@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// outcomes feeds outcomes through a breaker, failing the test when one is rejected
+func outcomes(t *testing.T, b *CircuitBreaker, results ...Outcome) {
+	t.Helper()
+	for _, outcome := range results {
+		done, err := b.Acquire()
+		if err != nil {
+			t.Fatalf("breaker in state %s rejected a request: %v", b.Status().State, err)
+		}
+		done(outcome)
+	}
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+	b := NewCircuitBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 1})
+
+	// A success in between resets the consecutive failures
+	outcomes(t, b, OutcomeFailure, OutcomeSuccess, OutcomeFailure)
+	if state := b.Status().State; state != BreakerClosed {
+		t.Fatalf("state %s after non-consecutive failures, want %s", state, BreakerClosed)
+	}
+
+	outcomes(t, b, OutcomeFailure)
+	if state := b.Status().State; state != BreakerOpen {
+		t.Fatalf("state %s after %d failures, want %s", state, 2, BreakerOpen)
+	}
+	if _, err := b.Acquire(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker admitted a request: %v", err)
+	}
+
+	// After the timeout one probe is let through, and failing it opens the breaker again
+	time.Sleep(25 * time.Millisecond)
+	if state := b.Status().State; state != BreakerHalfOpen {
+		t.Fatalf("state %s after the open timeout, want %s", state, BreakerHalfOpen)
+	}
+	probe, err := b.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Acquire(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("half-open breaker admitted a second probe: %v", err)
+	}
+	probe(OutcomeFailure)
+	if state := b.Status().State; state != BreakerOpen {
+		t.Fatalf("state %s after a failed probe, want %s", state, BreakerOpen)
+	}
+
+	// A successful probe closes it
+	time.Sleep(25 * time.Millisecond)
+	outcomes(t, b, OutcomeSuccess)
+	if state := b.Status().State; state != BreakerClosed {
+		t.Fatalf("state %s after a successful probe, want %s", state, BreakerClosed)
+	}
+
+	// Ignored outcomes, e.g. cancelled requests, neither open nor close it
+	outcomes(t, b, OutcomeIgnored, OutcomeIgnored, OutcomeIgnored)
+	if status := b.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("status %+v after ignored outcomes, want closed without failures", status)
+	}
+}
+
+// testOutlier ejects an instance on its first 5xx response
+var testOutlier = OutlierConfig{
+	ErrorRate:          0.5,
+	MinRequests:        1,
+	Window:             time.Minute,
+	EjectionTime:       time.Minute,
+	MaxEjectionTime:    150 * time.Second,
+	MaxEjectionPercent: 50,
+}
+
+// newTestTracker creates a health tracker with the test outlier settings
+func newTestTracker() *healthTracker {
+	breaker := BreakerConfig{FailureThreshold: 100, OpenTimeout: time.Minute, HalfOpenRequests: 1}
+	return newHealthTracker(ResilienceConfig{Service: breaker, Instance: breaker, Outlier: testOutlier})
+}
+
+// testUpstreamInstances returns count instances named i0, i1, ...
+func testUpstreamInstances(count int) []*Instance {
+	instances := make([]*Instance, count)
+	for i := range instances {
+		instances[i] = &Instance{ID: fmt.Sprintf("i%d", i), Address: "10.0.0.1", Port: 8000 + i}
+	}
+	return instances
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		instances int
+		percent   int
+		want      int
+	}{
+		{4, 50, 2},
+		{4, 25, 1},
+		{3, 50, 1},
+		{2, 100, 2},
+		{1, 50, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d%% of %d", tt.percent, tt.instances), func(t *testing.T) {
+			tracker := newTestTracker()
+			tracker.cfg.Outlier.MaxEjectionPercent = tt.percent
+			instances := testUpstreamInstances(tt.instances)
+
+			// Every instance fails
+			for _, instance := range instances {
+				tracker.record(instance, len(instances), true)
+			}
+			if available := tracker.available(instances); len(available) != tt.instances-tt.want {
+				t.Errorf("%d instances available, want %d ejected", len(available), tt.want)
+			}
+			ejected := 0
+			for _, instance := range tracker.status("test").Instances {
+				if instance.Ejected {
+					ejected++
+				}
+			}
+			if ejected != tt.want {
+				t.Errorf("status reports %d ejected instances, want %d", ejected, tt.want)
+			}
+		})
+	}
+}
+
+func TestEjectionTime(t *testing.T) {
+	tracker := newTestTracker()
+	instances := testUpstreamInstances(2)
+	instance := instances[0]
+
+	// ejectAgain ends the current ejection and fails the instance again
+	ejectAgain := func() time.Duration {
+		t.Helper()
+		health := tracker.instance(instance.ID)
+		health.ejectedUntil = time.Now()
+		tracker.record(instance, len(instances), true)
+		return time.Until(health.ejectedUntil).Round(time.Second)
+	}
+
+	// The period grows with each ejection up to the maximum
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 150 * time.Second, 150 * time.Second} {
+		if got := ejectAgain(); got != want {
+			t.Errorf("ejection %d lasts %s, want %s", i+1, got, want)
+		}
+	}
+
+	// Three healthy periods after the last ejection forgive three of the four ejections
+	health := tracker.instance(instance.ID)
+	health.ejectedUntil = time.Now().Add(-3*time.Minute - time.Second)
+	health.forgivenAt = health.ejectedUntil
+	tracker.record(instance, len(instances), false)
+	if health.ejections != 1 {
+		t.Errorf("%d ejections are remembered, want 1", health.ejections)
+	}
+	if got := ejectAgain(); got != 2*time.Minute {
+		t.Errorf("ejection after recovering lasts %s, want %s", got, 2*time.Minute)
+	}
+}
+
+func TestPruneForgetsDepartedInstances(t *testing.T) {
+	tracker := newTestTracker()
+	instances := testUpstreamInstances(3)
+	for _, instance := range instances {
+		tracker.record(instance, len(instances), false)
+	}
+
+	tracker.prune(instances[1:])
+	var ids []string
+	for _, instance := range tracker.status("test").Instances {
+		ids = append(ids, instance.ID)
+	}
+	if fmt.Sprint(ids) != "[i1 i2]" {
+		t.Errorf("tracking %v, want [i1 i2]", ids)
+	}
+}
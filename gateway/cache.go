@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pkgredis "e-commerce-platform/pkg/redis"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxCacheTTL is the longest a route may keep a response
+	maxCacheTTL = time.Hour
+
+	// maxCachedBodyBytes is the largest response body that is cached
+	maxCachedBodyBytes = 1 << 20
+
+	// maxMemoryCacheEntries bounds the in-memory store
+	maxMemoryCacheEntries = 10000
+
+	cacheKeyPrefix = "gateway:cache"
+)
+
+// errCacheMiss is returned by a response store when it holds no fresh entry
+var errCacheMiss = errors.New("cache miss")
+
+// CacheConfig enables response caching on a GET route. Responses are stored in
+// a group, and purging the group drops every response of the routes using it.
+type CacheConfig struct {
+	TTL   time.Duration `yaml:"ttl" json:"ttl"`
+	Group string        `yaml:"group" json:"group"`
+}
+
+// cachedResponse is a stored upstream response
+type cachedResponse struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// responseStore keeps cached responses. Groups are purged by bumping their
+// generation, which is part of every key, so stale entries simply expire.
+type responseStore interface {
+	Get(ctx context.Context, key string) (*cachedResponse, error)
+	Set(ctx context.Context, key string, resp *cachedResponse, ttl time.Duration) error
+	Generation(ctx context.Context, group string) (int64, error)
+	Purge(ctx context.Context, group string) error
+}
+
+// redisStore shares cached responses between gateway instances
+type redisStore struct {
+	client *pkgredis.Client
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (*cachedResponse, error) {
+	var resp cachedResponse
+	if err := s.client.Get(ctx, key, &resp); err != nil {
+		if errors.Is(err, pkgredis.ErrCacheMiss) {
+			return nil, errCacheMiss
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, resp *cachedResponse, ttl time.Duration) error {
+	return s.client.Set(ctx, key, resp, ttl)
+}
+
+func (s *redisStore) Generation(ctx context.Context, group string) (int64, error) {
+	var generation int64
+	if err := s.client.Get(ctx, generationKey(group), &generation); err != nil && !errors.Is(err, pkgredis.ErrCacheMiss) {
+		return 0, err
+	}
+	return generation, nil
+}
+
+func (s *redisStore) Purge(ctx context.Context, group string) error {
+	_, err := s.client.Increment(ctx, generationKey(group))
+	return err
+}
+
+func generationKey(group string) string {
+	return fmt.Sprintf("%s:generation:%s", cacheKeyPrefix, group)
+}
+
+type memoryEntry struct {
+	resp    *cachedResponse
+	expires time.Time
+}
+
+// memoryStore keeps cached responses in the gateway process
+type memoryStore struct {
+	mu          sync.Mutex
+	entries     map[string]memoryEntry
+	generations map[string]int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		entries:     make(map[string]memoryEntry),
+		generations: make(map[string]int64),
+	}
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (*cachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, errCacheMiss
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, errCacheMiss
+	}
+	return entry.resp, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key string, resp *cachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= maxMemoryCacheEntries {
+		s.evict()
+	}
+	s.entries[key] = memoryEntry{resp: resp, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// evict drops expired entries, or an arbitrary tenth of the store when none have expired
+func (s *memoryStore) evict() {
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+	for key := range s.entries {
+		if len(s.entries) < maxMemoryCacheEntries*9/10 {
+			break
+		}
+		delete(s.entries, key)
+	}
+}
+
+func (s *memoryStore) Generation(_ context.Context, group string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generations[group], nil
+}
+
+func (s *memoryStore) Purge(_ context.Context, group string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generations[group]++
+	prefix := fmt.Sprintf("%s:%s:", cacheKeyPrefix, group)
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+// fallbackStore uses Redis and falls back to process memory while Redis fails
+type fallbackStore struct {
+	primary  responseStore
+	fallback responseStore
+}
+
+func (s *fallbackStore) Get(ctx context.Context, key string) (*cachedResponse, error) {
+	resp, err := s.primary.Get(ctx, key)
+	if err != nil && !errors.Is(err, errCacheMiss) {
+		log.Printf("Response cache unavailable, using memory: %v", err)
+		return s.fallback.Get(ctx, key)
+	}
+	return resp, err
+}
+
+func (s *fallbackStore) Set(ctx context.Context, key string, resp *cachedResponse, ttl time.Duration) error {
+	if err := s.primary.Set(ctx, key, resp, ttl); err != nil {
+		log.Printf("Response cache unavailable, using memory: %v", err)
+		return s.fallback.Set(ctx, key, resp, ttl)
+	}
+	return nil
+}
+
+func (s *fallbackStore) Generation(ctx context.Context, group string) (int64, error) {
+	generation, err := s.primary.Generation(ctx, group)
+	if err != nil {
+		log.Printf("Response cache unavailable, using memory: %v", err)
+		return s.fallback.Generation(ctx, group)
+	}
+	return generation, nil
+}
+
+// Purge purges both stores, so entries written to memory during an outage do not outlive it
+func (s *fallbackStore) Purge(ctx context.Context, group string) error {
+	fallbackErr := s.fallback.Purge(ctx, group)
+	if err := s.primary.Purge(ctx, group); err != nil {
+		return err
+	}
+	return fallbackErr
+}
+
+// ResponseCache caches upstream responses of the routes that enable it
+type ResponseCache struct {
+	store responseStore
+}
+
+// NewResponseCache caches responses in Redis, falling back to memory while
+// Redis is unreachable, or only in memory when client is nil
+func NewResponseCache(client *pkgredis.Client) *ResponseCache {
+	if client == nil {
+		return &ResponseCache{store: newMemoryStore()}
+	}
+	return &ResponseCache{store: &fallbackStore{
+		primary:  &redisStore{client: client},
+		fallback: newMemoryStore(),
+	}}
+}
+
+// Purge drops every cached response of a group
+func (rc *ResponseCache) Purge(ctx context.Context, group string) error {
+	if err := rc.store.Purge(ctx, group); err != nil {
+		return err
+	}
+	log.Printf("Purged response cache group %s", group)
+	cachePurges.WithLabelValues(group).Inc()
+	return nil
+}
+
+// Listen purges the groups published on the cache invalidation channel until ctx is cancelled
+func (rc *ResponseCache) Listen(ctx context.Context, client *pkgredis.Client) {
+	for {
+		err := client.Subscribe(ctx, pkgredis.CacheInvalidationChannel, func(group string) {
+			if err := rc.Purge(ctx, group); err != nil {
+				log.Printf("Failed to purge response cache group %s: %v", group, err)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Cache invalidation subscription lost, resubscribing: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Middleware serves GET requests from the cache and stores cacheable upstream
+// responses. Keys vary by path, query string and Accept-Language. Request and
+// response Cache-Control directives are honoured.
+func (rc *ResponseCache) Middleware(service string, cfg CacheConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		request := parseCacheControl(c.GetHeader("Cache-Control"))
+		if _, ok := request["no-store"]; ok {
+			bypassCache(c, service)
+			return
+		}
+
+		generation, err := rc.store.Generation(ctx, cfg.Group)
+		if err != nil {
+			bypassCache(c, service)
+			return
+		}
+		key := cacheKey(cfg.Group, generation, c.Request)
+
+		// no-cache asks for a fresh response, which is still stored for later requests
+		_, noCache := request["no-cache"]
+		if !noCache {
+			if resp, err := rc.store.Get(ctx, key); err == nil {
+				age := time.Since(resp.StoredAt)
+				if maxAge, ok := directiveSeconds(request, "max-age"); !ok || age <= maxAge {
+					cacheRequests.WithLabelValues(service, "hit").Inc()
+					serveCached(c, resp, age)
+					return
+				}
+			}
+		}
+
+		cacheRequests.WithLabelValues(service, "miss").Inc()
+		writer := &cacheWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Header("X-Cache", "MISS")
+		c.Next()
+
+		ttl, ok := cacheTTL(writer, cfg.TTL)
+		if !ok {
+			return
+		}
+		resp := &cachedResponse{
+			Status:   writer.Status(),
+			Header:   storedHeaders(writer.Header()),
+			Body:     writer.body.Bytes(),
+			StoredAt: time.Now(),
+		}
+		// Store with a fresh context, the response is complete even if the client went away
+		storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+		defer cancel()
+		if err := rc.store.Set(storeCtx, key, resp, ttl); err != nil {
+			log.Printf("Failed to cache response for %s: %v", c.Request.URL.Path, err)
+		}
+	}
+}
+
+// Invalidate purges groups after a successful write through the route
+func (rc *ResponseCache) Invalidate(groups []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < 200 || status > 299 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), time.Second)
+		defer cancel()
+		for _, group := range groups {
+			if err := rc.Purge(ctx, group); err != nil {
+				log.Printf("Failed to purge response cache group %s: %v", group, err)
+			}
+		}
+	}
+}
+
+func bypassCache(c *gin.Context, service string) {
+	cacheRequests.WithLabelValues(service, "bypass").Inc()
+	c.Header("X-Cache", "BYPASS")
+	c.Next()
+}
+
+func serveCached(c *gin.Context, resp *cachedResponse, age time.Duration) {
+	header := c.Writer.Header()
+	for name, values := range resp.Header {
+		// Entries stored before a header became per-request may still carry it
+		if !perRequestHeaders[http.CanonicalHeaderKey(name)] {
+			header[name] = values
+		}
+	}
+	header.Set("Age", strconv.Itoa(int(age.Seconds())))
+	header.Set("X-Cache", "HIT")
+	c.Status(resp.Status)
+	c.Writer.Write(resp.Body)
+	c.Abort()
+}
+
+// cacheKey identifies a response by group generation, path, sorted query string and Accept-Language
+func cacheKey(group string, generation int64, req *http.Request) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%s", req.URL.Path, req.URL.Query().Encode(), strings.ToLower(strings.ReplaceAll(req.Header.Get("Accept-Language"), " ", "")))
+	return fmt.Sprintf("%s:%s:%d:%s", cacheKeyPrefix, group, generation, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// cacheTTL reports how long a response may be cached: the route TTL, shortened
+// by the upstream's s-maxage or max-age
+func cacheTTL(w *cacheWriter, routeTTL time.Duration) (time.Duration, bool) {
+	header := w.Header()
+	if w.Status() != http.StatusOK || w.overflow || header.Get("Set-Cookie") != "" || header.Get("Content-Encoding") != "" {
+		return 0, false
+	}
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "Accept-Language") {
+				return 0, false
+			}
+		}
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[name]; ok {
+			return 0, false
+		}
+	}
+	ttl := routeTTL
+	if maxAge, ok := directiveSeconds(directives, "s-maxage"); ok {
+		ttl = min(ttl, maxAge)
+	} else if maxAge, ok := directiveSeconds(directives, "max-age"); ok {
+		ttl = min(ttl, maxAge)
+	}
+	return ttl, ttl > 0
+}
+
+// perRequestHeaders describe one exchange and are not replayed from the
+// cache. The rate limit headers describe the quota of the current client.
+// Keys are canonical header names.
+var perRequestHeaders = map[string]bool{
+	"Date":                true,
+	"Age":                 true,
+	"X-Cache":             true,
+	"X-Request-Id":        true,
+	"Traceparent":         true,
+	"Ratelimit-Limit":     true,
+	"Ratelimit-Remaining": true,
+	"Ratelimit-Reset":     true,
+	"Retry-After":         true,
+}
+
+func storedHeaders(header http.Header) http.Header {
+	stored := make(http.Header, len(header))
+	for name, values := range header {
+		if !perRequestHeaders[http.CanonicalHeaderKey(name)] {
+			stored[name] = append([]string(nil), values...)
+		}
+	}
+	return stored
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, lowercased
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cacheWriter keeps a copy of the response body while it is written to the client
+type cacheWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *cacheWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > maxCachedBodyBytes {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCacheHitKeepsRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rc := NewResponseCache(nil)
+
+	// The rate limiter runs before the cache, with one request less remaining each time
+	remaining := 10
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		remaining--
+		middleware.SetRateLimitHeaders(c, middleware.Result{Allowed: true, Limit: 10, Remaining: remaining, Reset: time.Minute})
+	})
+	r.GET("/products", rc.Middleware("product-service", CacheConfig{TTL: time.Minute, Group: "products"}), func(c *gin.Context) {
+		c.String(http.StatusOK, "products")
+	})
+
+	for i, want := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/products", nil))
+		if got := rec.Header().Get("X-Cache"); got != want {
+			t.Fatalf("request %d: X-Cache %q, want %q", i, got, want)
+		}
+		if got := rec.Header().Get(middleware.HeaderRateLimitRemaining); got != strconv.Itoa(remaining) {
+			t.Errorf("request %d: %s %q, want %d", i, middleware.HeaderRateLimitRemaining, got, remaining)
+		}
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		body   int
+		want   time.Duration
+	}{
+		{"route TTL", http.StatusOK, nil, 10, time.Minute},
+		{"not 200", http.StatusNotFound, nil, 10, 0},
+		{"Set-Cookie", http.StatusOK, map[string]string{"Set-Cookie": "session=1"}, 10, 0},
+		{"compressed", http.StatusOK, map[string]string{"Content-Encoding": "gzip"}, 10, 0},
+		{"too large", http.StatusOK, nil, maxCachedBodyBytes + 1, 0},
+		{"Vary Accept-Language", http.StatusOK, map[string]string{"Vary": "accept-language"}, 10, time.Minute},
+		{"Vary another header", http.StatusOK, map[string]string{"Vary": "Accept-Language, Authorization"}, 10, 0},
+		{"Vary *", http.StatusOK, map[string]string{"Vary": "*"}, 10, 0},
+		{"no-store", http.StatusOK, map[string]string{"Cache-Control": "no-store"}, 10, 0},
+		{"no-cache", http.StatusOK, map[string]string{"Cache-Control": "No-Cache"}, 10, 0},
+		{"private", http.StatusOK, map[string]string{"Cache-Control": "private, max-age=30"}, 10, 0},
+		{"shorter max-age", http.StatusOK, map[string]string{"Cache-Control": "public, max-age=30"}, 10, 30 * time.Second},
+		{"longer max-age", http.StatusOK, map[string]string{"Cache-Control": "max-age=7200"}, 10, time.Minute},
+		{"s-maxage over max-age", http.StatusOK, map[string]string{"Cache-Control": "max-age=5, s-maxage=\"20\""}, 10, 20 * time.Second},
+		{"s-maxage 0", http.StatusOK, map[string]string{"Cache-Control": "s-maxage=0, max-age=30"}, 10, 0},
+		{"invalid max-age", http.StatusOK, map[string]string{"Cache-Control": "max-age=soon"}, 10, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			w := &cacheWriter{ResponseWriter: c.Writer}
+			for name, value := range tt.header {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(tt.status)
+			w.Write([]byte(strings.Repeat("x", tt.body)))
+
+			ttl, ok := cacheTTL(w, time.Minute)
+			if ok != (tt.want > 0) || ttl != tt.want {
+				t.Errorf("TTL %s, %v, want %s", ttl, ok, tt.want)
+			}
+		})
+	}
+}
+
+// cachedRouter serves GET /products in the products group and GET /orders in
+// the orders group through rc. A POST to /products invalidates products and
+// answers with the status of its status query parameter.
+func cachedRouter(rc *ResponseCache) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	var calls atomic.Int64
+	upstream := func(c *gin.Context) {
+		c.String(http.StatusOK, "response %d", calls.Add(1))
+	}
+	r := gin.New()
+	r.GET("/products", rc.Middleware("product-service", CacheConfig{TTL: time.Minute, Group: "products"}), upstream)
+	r.GET("/orders", rc.Middleware("order-service", CacheConfig{TTL: time.Minute, Group: "orders"}), upstream)
+	r.POST("/products", rc.Invalidate([]string{"products"}), func(c *gin.Context) {
+		status, _ := strconv.Atoi(c.Query("status"))
+		c.Status(status)
+	})
+	return r
+}
+
+// cacheStatus sends a request to r and returns its X-Cache header
+func cacheStatus(r *gin.Engine, method, target string, header map[string]string) string {
+	req := httptest.NewRequest(method, target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Header().Get("X-Cache")
+}
+
+func TestCachePurge(t *testing.T) {
+	rc := NewResponseCache(nil)
+	r := cachedRouter(rc)
+
+	steps := []struct {
+		name   string
+		method string
+		target string
+		header map[string]string
+		want   string
+	}{
+		{"first products", http.MethodGet, "/products", nil, "MISS"},
+		{"first orders", http.MethodGet, "/orders", nil, "MISS"},
+		{"cached products", http.MethodGet, "/products", nil, "HIT"},
+		{"other query", http.MethodGet, "/products?page=2", nil, "MISS"},
+		{"other language", http.MethodGet, "/products", map[string]string{"Accept-Language": "de"}, "MISS"},
+		{"no-store request", http.MethodGet, "/products", map[string]string{"Cache-Control": "no-store"}, "BYPASS"},
+		{"no-cache request", http.MethodGet, "/products", map[string]string{"Cache-Control": "no-cache"}, "MISS"},
+		{"failed write", http.MethodPost, "/products?status=500", nil, ""},
+		{"kept after a failed write", http.MethodGet, "/products", nil, "HIT"},
+		{"successful write", http.MethodPost, "/products?status=201", nil, ""},
+		{"purged by the write", http.MethodGet, "/products", nil, "MISS"},
+		{"other group kept", http.MethodGet, "/orders", nil, "HIT"},
+	}
+	for _, step := range steps {
+		if got := cacheStatus(r, step.method, step.target, step.header); got != step.want {
+			t.Errorf("%s: X-Cache %q, want %q", step.name, got, step.want)
+		}
+	}
+
+	// A purge bumps the generation in every key of the group
+	if err := rc.Purge(context.Background(), "orders"); err != nil {
+		t.Fatal(err)
+	}
+	if generation, _ := rc.store.Generation(context.Background(), "orders"); generation != 1 {
+		t.Errorf("orders generation %d, want 1", generation)
+	}
+	if generation, _ := rc.store.Generation(context.Background(), "products"); generation != 1 {
+		t.Errorf("products generation %d, want 1", generation)
+	}
+	if got := cacheStatus(r, http.MethodGet, "/orders", nil); got != "MISS" {
+		t.Errorf("orders after the purge: X-Cache %q, want MISS", got)
+	}
+}
+
+// errStoreDown is returned by a flakyStore that is down
+var errStoreDown = errors.New("redis unreachable")
+
+// flakyStore is a response store that fails while it is down
+type flakyStore struct {
+	responseStore
+	down atomic.Bool
+}
+
+func (s *flakyStore) Get(ctx context.Context, key string) (*cachedResponse, error) {
+	if s.down.Load() {
+		return nil, errStoreDown
+	}
+	return s.responseStore.Get(ctx, key)
+}
+
+func (s *flakyStore) Set(ctx context.Context, key string, resp *cachedResponse, ttl time.Duration) error {
+	if s.down.Load() {
+		return errStoreDown
+	}
+	return s.responseStore.Set(ctx, key, resp, ttl)
+}
+
+func (s *flakyStore) Generation(ctx context.Context, group string) (int64, error) {
+	if s.down.Load() {
+		return 0, errStoreDown
+	}
+	return s.responseStore.Generation(ctx, group)
+}
+
+func (s *flakyStore) Purge(ctx context.Context, group string) error {
+	if s.down.Load() {
+		return errStoreDown
+	}
+	return s.responseStore.Purge(ctx, group)
+}
+
+func TestCacheMemoryFallback(t *testing.T) {
+	primary := &flakyStore{responseStore: newMemoryStore()}
+	fallback := newMemoryStore()
+	rc := &ResponseCache{store: &fallbackStore{primary: primary, fallback: fallback}}
+	r := cachedRouter(rc)
+
+	for i, want := range []string{"MISS", "HIT"} {
+		if got := cacheStatus(r, http.MethodGet, "/products", nil); got != want {
+			t.Errorf("request %d with Redis up: X-Cache %q, want %q", i, got, want)
+		}
+	}
+	if len(fallback.entries) != 0 {
+		t.Errorf("memory holds %d entries while Redis is up, want none", len(fallback.entries))
+	}
+
+	// Responses are cached in memory while Redis is down
+	primary.down.Store(true)
+	for i, want := range []string{"MISS", "HIT"} {
+		if got := cacheStatus(r, http.MethodGet, "/products", nil); got != want {
+			t.Errorf("request %d with Redis down: X-Cache %q, want %q", i, got, want)
+		}
+	}
+
+	// A purge that fails on Redis still drops the memory entries
+	if err := rc.Purge(context.Background(), "products"); !errors.Is(err, errStoreDown) {
+		t.Errorf("purge error %v, want %v", err, errStoreDown)
+	}
+	if got := cacheStatus(r, http.MethodGet, "/products", nil); got != "MISS" {
+		t.Errorf("after the purge: X-Cache %q, want MISS", got)
+	}
+
+	// Once Redis is back, its entries are served again
+	primary.down.Store(false)
+	if got := cacheStatus(r, http.MethodGet, "/products", nil); got != "HIT" {
+		t.Errorf("with Redis back: X-Cache %q, want HIT", got)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	resp := &cachedResponse{Status: http.StatusOK}
+
+	store.Set(ctx, "expired", resp, -time.Second)
+	if _, err := store.Get(ctx, "expired"); !errors.Is(err, errCacheMiss) {
+		t.Errorf("expired entry: error %v, want a miss", err)
+	}
+	if _, ok := store.entries["expired"]; ok {
+		t.Error("expired entry was kept")
+	}
+
+	// A full store makes room for new entries
+	for i := 0; i < maxMemoryCacheEntries; i++ {
+		store.Set(ctx, fmt.Sprintf("%s:products:0:%d", cacheKeyPrefix, i), resp, time.Minute)
+	}
+	store.Set(ctx, "new", resp, time.Minute)
+	if n := len(store.entries); n > maxMemoryCacheEntries*9/10+1 {
+		t.Errorf("%d entries after eviction, want at most %d", n, maxMemoryCacheEntries*9/10+1)
+	}
+	if _, err := store.Get(ctx, "new"); err != nil {
+		t.Errorf("new entry: %v", err)
+	}
+
+	// Purging a group drops its entries at once
+	store.Purge(ctx, "products")
+	if n := len(store.entries); n != 1 {
+		t.Errorf("%d entries after the purge, want only the entry outside the group", n)
+	}
+}
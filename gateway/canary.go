@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// HeaderCanary pins a request to one version of every upstream it reaches
+	HeaderCanary = "X-Canary"
+	// canaryCookie pins browser sessions the same way as HeaderCanary
+	canaryCookie = "canary"
+	// stableVersion names the instances that carry none of a service's canary tags
+	stableVersion = "stable"
+
+	// versionStatsBucket and versionStatsBuckets make up the window over which
+	// per-version error rates are reported on the admin endpoint
+	versionStatsBucket  = time.Minute
+	versionStatsBuckets = 5
+)
+
+// CanaryConfig sends Weight percent of a service's requests to its instances
+// registered with Tag. The remaining share goes to the stable instances.
+type CanaryConfig struct {
+	Tag    string `yaml:"tag" json:"tag"`
+	Weight int    `yaml:"weight" json:"weight"`
+}
+
+// validateCanaries checks the canaries of one service
+func validateCanaries(service string, canaries []CanaryConfig) error {
+	total := 0
+	seen := make(map[string]bool, len(canaries))
+	for _, canary := range canaries {
+		if canary.Tag == "" || canary.Tag == stableVersion {
+			return fmt.Errorf("canaries of %s: tag must be set and cannot be %q", service, stableVersion)
+		}
+		if seen[canary.Tag] {
+			return fmt.Errorf("canaries of %s: duplicate tag %q", service, canary.Tag)
+		}
+		seen[canary.Tag] = true
+		if canary.Weight < 0 || canary.Weight > 100 {
+			return fmt.Errorf("canaries of %s: weight of %q must be between 0 and 100", service, canary.Tag)
+		}
+		total += canary.Weight
+	}
+	if total > 100 {
+		return fmt.Errorf("canaries of %s: weights add up to more than 100", service)
+	}
+	return nil
+}
+
+// canaryPin returns the version a request asked for with the X-Canary header or
+// the canary cookie, if any
+func canaryPin(req *http.Request) string {
+	if pin := req.Header.Get(HeaderCanary); pin != "" {
+		return pin
+	}
+	if cookie, err := req.Cookie(canaryCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// instanceVersion returns the first canary tag an instance carries, or stable
+func instanceVersion(instance *Instance, canaries []CanaryConfig) string {
+	for _, canary := range canaries {
+		for _, tag := range instance.Tags {
+			if tag == canary.Tag {
+				return canary.Tag
+			}
+		}
+	}
+	return stableVersion
+}
+
+// groupByVersion splits instances by the version they serve
+func groupByVersion(instances []*Instance, canaries []CanaryConfig) map[string][]*Instance {
+	groups := make(map[string][]*Instance, len(canaries)+1)
+	for _, instance := range instances {
+		version := instanceVersion(instance, canaries)
+		groups[version] = append(groups[version], instance)
+	}
+	return groups
+}
+
+// selectVersion picks the version that serves a request and returns its
+// instances. A pinned version is honoured while it has instances, otherwise
+// the version is drawn by weight. When the chosen version has no instances the
+// request falls back to stable, and then to any canary that has instances.
+func selectVersion(instances []*Instance, canaries []CanaryConfig, pin string) (string, []*Instance) {
+	if len(canaries) == 0 {
+		return stableVersion, instances
+	}
+	groups := groupByVersion(instances, canaries)
+
+	if pin != "" && len(groups[pin]) > 0 {
+		return pin, groups[pin]
+	}
+
+	// The share of a canary without instances goes to stable, not to the next canary
+	roll := rand.Intn(100)
+	for _, canary := range canaries {
+		if roll < canary.Weight {
+			if len(groups[canary.Tag]) > 0 {
+				return canary.Tag, groups[canary.Tag]
+			}
+			break
+		}
+		roll -= canary.Weight
+	}
+
+	if len(groups[stableVersion]) > 0 {
+		return stableVersion, groups[stableVersion]
+	}
+	for _, canary := range canaries {
+		if len(groups[canary.Tag]) > 0 {
+			return canary.Tag, groups[canary.Tag]
+		}
+	}
+	return stableVersion, instances
+}
+
+// versionBucket counts the attempts of one version within one bucket interval
+type versionBucket struct {
+	start    time.Time
+	requests int
+	errors   int
+}
+
+// versionStats counts attempts and errors per version of an upstream over a
+// sliding window, so a canary can be compared with the stable build
+type versionStats struct {
+	service string
+
+	mu       sync.Mutex
+	versions map[string]*[versionStatsBuckets]versionBucket
+}
+
+func newVersionStats(service string) *versionStats {
+	return &versionStats{
+		service:  service,
+		versions: make(map[string]*[versionStatsBuckets]versionBucket),
+	}
+}
+
+// record counts one attempt against a version. Transport errors and 5xx
+// responses count as errors.
+func (s *versionStats) record(version string, failed bool) {
+	result := "success"
+	if failed {
+		result = "error"
+	}
+	upstreamResponses.WithLabelValues(s.service, version, result).Inc()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets, ok := s.versions[version]
+	if !ok {
+		buckets = new([versionStatsBuckets]versionBucket)
+		s.versions[version] = buckets
+	}
+
+	start := time.Now().Truncate(versionStatsBucket)
+	bucket := &buckets[start.Unix()/int64(versionStatsBucket/time.Second)%versionStatsBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = versionBucket{start: start}
+	}
+	bucket.requests++
+	if failed {
+		bucket.errors++
+	}
+}
+
+// window returns the attempts and errors of a version within the window
+func (s *versionStats) window(version string) (requests, errors int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets, ok := s.versions[version]
+	if !ok {
+		return 0, 0
+	}
+	oldest := time.Now().Truncate(versionStatsBucket).Add(-(versionStatsBuckets - 1) * versionStatsBucket)
+	for _, bucket := range buckets {
+		if !bucket.start.Before(oldest) {
+			requests += bucket.requests
+			errors += bucket.errors
+		}
+	}
+	return requests, errors
+}
+
+// recorded returns the versions that have been recorded so far
+func (s *versionStats) recorded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := make([]string, 0, len(s.versions))
+	for version := range s.versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// VersionStatus is the admin view of one version of an upstream
+type VersionStatus struct {
+	Version   string  `json:"version"`
+	Weight    int     `json:"weight"`
+	Instances int     `json:"instances"`
+	Requests  int     `json:"window_requests"`
+	Errors    int     `json:"window_errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// CanaryStatus is the admin view of the versions of an upstream
+type CanaryStatus struct {
+	Service  string          `json:"service"`
+	Window   string          `json:"window"`
+	Versions []VersionStatus `json:"versions"`
+}
+
+// SetCanaries replaces the canary configuration of every service
+func (g *Gateway) SetCanaries(canaries map[string][]CanaryConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.canaries = canaries
+}
+
+// canariesOf returns the canary configuration of a service
+func (g *Gateway) canariesOf(serviceName string) []CanaryConfig {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.canaries[serviceName]
+}
+
+// CanaryStatus reports the traffic share, instances and recent error rate of
+// every version of the upstreams in use or with canaries configured
+func (g *Gateway) CanaryStatus() []CanaryStatus {
+	g.mu.Lock()
+	names := make(map[string]bool, len(g.upstreams)+len(g.canaries))
+	for name := range g.upstreams {
+		names[name] = true
+	}
+	for name := range g.canaries {
+		names[name] = true
+	}
+	g.mu.Unlock()
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	statuses := make([]CanaryStatus, 0, len(sorted))
+	for _, name := range sorted {
+		statuses = append(statuses, g.canaryStatus(name))
+	}
+	return statuses
+}
+
+func (g *Gateway) canaryStatus(serviceName string) CanaryStatus {
+	canaries := g.canariesOf(serviceName)
+	// A service without an upstream has served no requests yet
+	stats := newVersionStats(serviceName)
+	if up, err := g.upstream(serviceName); err == nil {
+		stats = up.versions
+	}
+
+	var groups map[string][]*Instance
+	if instances, err := g.discovery.Instances(serviceName); err == nil {
+		groups = groupByVersion(instances, canaries)
+	}
+
+	// Stable gets whatever share the canaries leave, and versions that are no
+	// longer configured keep showing until their stats age out
+	weights := map[string]int{stableVersion: 100}
+	order := []string{stableVersion}
+	for _, canary := range canaries {
+		weights[canary.Tag] = canary.Weight
+		weights[stableVersion] -= canary.Weight
+		order = append(order, canary.Tag)
+	}
+	for _, version := range stats.recorded() {
+		if _, ok := weights[version]; !ok {
+			weights[version] = 0
+			order = append(order, version)
+		}
+	}
+
+	status := CanaryStatus{
+		Service:  serviceName,
+		Window:   (versionStatsBuckets * versionStatsBucket).String(),
+		Versions: make([]VersionStatus, 0, len(order)),
+	}
+	for _, version := range order {
+		requests, errors := stats.window(version)
+		versionStatus := VersionStatus{
+			Version:   version,
+			Weight:    weights[version],
+			Instances: len(groups[version]),
+			Requests:  requests,
+			Errors:    errors,
+		}
+		if requests > 0 {
+			versionStatus.ErrorRate = float64(errors) / float64(requests)
+		}
+		status.Versions = append(status.Versions, versionStatus)
+	}
+	return status
+}
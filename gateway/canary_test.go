@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"e-commerce-platform/pkg/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// versionedInstances returns one instance per tag, with an empty tag for a
+// stable instance
+func versionedInstances(tags ...string) []*Instance {
+	instances := make([]*Instance, len(tags))
+	for i, tag := range tags {
+		instances[i] = &Instance{ID: "i" + string(rune('0'+i))}
+		if tag != "" {
+			instances[i].Tags = []string{"api", tag}
+		}
+	}
+	return instances
+}
+
+func TestSelectVersionByWeight(t *testing.T) {
+	const draws = 10000
+	tests := []struct {
+		name      string
+		instances []*Instance
+		canaries  []CanaryConfig
+		// want is the expected share of each version in percent
+		want map[string]float64
+	}{
+		{"no canaries", versionedInstances("", "v2"), nil, map[string]float64{stableVersion: 100}},
+		{"10 percent", versionedInstances("", "", "v2"), []CanaryConfig{{Tag: "v2", Weight: 10}}, map[string]float64{stableVersion: 90, "v2": 10}},
+		{"weight 0", versionedInstances("", "v2"), []CanaryConfig{{Tag: "v2", Weight: 0}}, map[string]float64{stableVersion: 100}},
+		{"weight 100", versionedInstances("", "v2"), []CanaryConfig{{Tag: "v2", Weight: 100}}, map[string]float64{"v2": 100}},
+		{"two canaries", versionedInstances("", "v2", "v3"), []CanaryConfig{{Tag: "v2", Weight: 20}, {Tag: "v3", Weight: 30}},
+			map[string]float64{stableVersion: 50, "v2": 20, "v3": 30}},
+		{"canary without instances", versionedInstances("", "v3"), []CanaryConfig{{Tag: "v2", Weight: 20}, {Tag: "v3", Weight: 30}},
+			map[string]float64{stableVersion: 70, "v3": 30}},
+		{"no stable instances", versionedInstances("v2"), []CanaryConfig{{Tag: "v2", Weight: 10}}, map[string]float64{"v2": 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := map[string]int{}
+			for i := 0; i < draws; i++ {
+				version, instances := selectVersion(tt.instances, tt.canaries, "")
+				for _, instance := range instances {
+					if got := instanceVersion(instance, tt.canaries); got != version {
+						t.Fatalf("%s was chosen with instance %s of %s", version, instance.ID, got)
+					}
+				}
+				counts[version]++
+			}
+			for version := range counts {
+				if _, ok := tt.want[version]; !ok {
+					t.Errorf("%s got %d requests, want none", version, counts[version])
+				}
+			}
+			for version, want := range tt.want {
+				// The share of 10000 draws is within 2 points of the weight
+				if got := 100 * float64(counts[version]) / draws; math.Abs(got-want) > 2 {
+					t.Errorf("%s got %.1f%% of the requests, want %.0f%%", version, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSelectVersionPinned(t *testing.T) {
+	canaries := []CanaryConfig{{Tag: "v2", Weight: 0}, {Tag: "v3", Weight: 100}}
+	tests := []struct {
+		name      string
+		instances []*Instance
+		pin       string
+		want      string
+		count     int
+	}{
+		{"canary with weight 0", versionedInstances("", "v2", "v3"), "v2", "v2", 1},
+		{"stable", versionedInstances("", "", "v3"), stableVersion, stableVersion, 2},
+		{"unknown version is weighted", versionedInstances("", "v2", "v3"), "v9", "v3", 1},
+		{"version without instances is weighted", versionedInstances("", "v3"), "v2", "v3", 1},
+		{"stable without instances falls back to a canary", versionedInstances("v2"), stableVersion, "v2", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				version, instances := selectVersion(tt.instances, canaries, tt.pin)
+				if version != tt.want || len(instances) != tt.count {
+					t.Fatalf("chose %s with %d instances, want %s with %d", version, len(instances), tt.want, tt.count)
+				}
+			}
+		})
+	}
+}
+
+func TestCanaryPin(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   string
+	}{
+		{"none", "", "", ""},
+		{"header", "v2", "", "v2"},
+		{"cookie", "", "stable", "stable"},
+		{"header over cookie", "v2", "stable", "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/products", nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderCanary, tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: canaryCookie, Value: tt.cookie})
+			}
+			if got := canaryPin(req); got != tt.want {
+				t.Errorf("pin %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// versionInstance is an upstream instance that answers with its version
+type versionInstance struct {
+	version  string
+	requests atomic.Int64
+}
+
+func (i *versionInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.requests.Add(1)
+	w.Write([]byte(i.version))
+}
+
+func TestProxyRoutesCanaries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stable, canary := &versionInstance{version: stableVersion}, &versionInstance{version: "v2"}
+	instances := testInstances(t, stable, 2)
+	for _, instance := range testInstances(t, canary, 1) {
+		instance.Tags = []string{"v2"}
+		instances = append(instances, instance)
+	}
+	gw := newTestGateway(t, map[string][]registry.Instance{"product-service": instances})
+	// A canary with weight 0 only serves pinned requests
+	gw.SetCanaries(map[string][]CanaryConfig{"product-service": {{Tag: "v2", Weight: 0}}})
+
+	r := gin.New()
+	r.GET("/products", proxyToService(gw, "product-service", "/products", retryPolicy{}))
+	url := serveTestGateway(t, r).URL + "/products"
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int64
+	}{
+		{"unpinned", nil, 0},
+		{"pinned with the header", http.Header{HeaderCanary: {"v2"}}, 10},
+		{"pinned with the cookie", http.Header{"Cookie": {canaryCookie + "=v2"}}, 10},
+		{"pinned to stable", http.Header{HeaderCanary: {stableVersion}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := canary.requests.Load()
+			for i := 0; i < 10; i++ {
+				if status := send(t, http.MethodGet, url, "", tt.header); status != http.StatusOK {
+					t.Fatalf("status %d", status)
+				}
+			}
+			if got := canary.requests.Load() - before; got != tt.want {
+				t.Errorf("canary served %d of 10 requests, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Attempts are counted per version for the admin endpoint
+	statuses := gw.CanaryStatus()
+	if len(statuses) != 1 {
+		t.Fatalf("%d canary statuses, want 1", len(statuses))
+	}
+	requests := map[string]int{}
+	for _, version := range statuses[0].Versions {
+		requests[version.Version] = version.Requests
+	}
+	if requests[stableVersion] != 20 || requests["v2"] != 20 {
+		data, _ := json.Marshal(statuses)
+		t.Errorf("status %s, want 20 requests to each version", data)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxComposeBodyBytes is the largest upstream response a composition handler reads
+const maxComposeBodyBytes = 4 << 20
+
+// composeHandlers are the gateway-side handlers a route can use instead of
+// proxying to a single upstream
+var composeHandlers = map[string]func(gw *Gateway, policy retryPolicy) gin.HandlerFunc{
+	"order_details": orderDetails,
+}
+
+// composeUpstreams are the services each compose handler calls
+var composeUpstreams = map[string][]string{
+	"order_details": {"order-service", "product-service", "payment-service"},
+}
+
+// forwardedHeaders are copied from the client request onto composed upstream requests
+var forwardedHeaders = append([]string{logging.HeaderRequestID, "Accept-Language", HeaderCanary}, middleware.IdentityHeaders...)
+
+// ComposeError describes a downstream call that failed while building a composed response
+type ComposeError struct {
+	Service  string `json:"service"`
+	Resource string `json:"resource"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Error    string `json:"error"`
+}
+
+// fetchResult is the outcome of one upstream GET
+type fetchResult struct {
+	status int
+	body   []byte
+	err    error
+}
+
+// fetch sends a GET to one instance of a service. It goes through the same
+// breakers, retries, canary routing and tracing as proxied requests.
+func (g *Gateway) fetch(c *gin.Context, serviceName, path string, policy retryPolicy) fetchResult {
+	target, err := g.newTarget(serviceName, path, policy, canaryPin(c.Request))
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	defer target.release()
+	target.retryable = true
+
+	ctx := context.WithValue(c.Request.Context(), proxyTargetKey{}, target)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+target.instance.Host()+path, nil)
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	for _, header := range forwardedHeaders {
+		if value := c.Request.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := target.upstream.proxy.Transport.RoundTrip(req)
+	if err != nil {
+		reason := "connection"
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = "timeout"
+		}
+		log.Printf("Compose error for %s %s: %v", serviceName, path, err)
+		proxyErrors.WithLabelValues(serviceName, reason).Inc()
+		return fetchResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxComposeBodyBytes))
+	if err != nil {
+		return fetchResult{err: err}
+	}
+	return fetchResult{status: resp.StatusCode, body: body}
+}
+
+// failure describes an unsuccessful fetch. It reports false when the fetch succeeded.
+func (r fetchResult) failure(serviceName, resource string) (ComposeError, bool) {
+	if r.err == nil && r.status == http.StatusOK {
+		return ComposeError{}, false
+	}
+
+	failure := ComposeError{Service: serviceName, Resource: resource}
+	switch {
+	case r.err != nil && errors.Is(r.err, context.DeadlineExceeded):
+		failure.Status = http.StatusGatewayTimeout
+		failure.Code = "UPSTREAM_TIMEOUT"
+		failure.Error = "Upstream request timed out"
+	case r.err != nil && (errors.Is(r.err, errNoInstances) || errors.Is(r.err, ErrCircuitOpen)):
+		status, body := targetErrorResponse(r.err)
+		failure.Status = status
+		failure.Code = body["code"].(string)
+		failure.Error = body["error"].(string)
+	case r.err != nil:
+		failure.Status = http.StatusBadGateway
+		failure.Code = "PROXY_ERROR"
+		failure.Error = r.err.Error()
+	default:
+		// Keep the upstream's own error code when it sent one
+		var upstreamErr struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		_ = json.Unmarshal(r.body, &upstreamErr)
+		failure.Status = r.status
+		failure.Code = upstreamErr.Code
+		failure.Error = upstreamErr.Error
+		if failure.Code == "" {
+			failure.Code = "UPSTREAM_ERROR"
+		}
+		if failure.Error == "" {
+			failure.Error = http.StatusText(r.status)
+		}
+	}
+	return failure, true
+}
+
+// OrderItemDetails is an order item together with the product it refers to.
+// Product is null when the product could not be fetched.
+type OrderItemDetails struct {
+	ProductID string          `json:"product_id"`
+	Quantity  int             `json:"quantity"`
+	Price     float64         `json:"price"`
+	Product   json.RawMessage `json:"product"`
+}
+
+// OrderDetails is the document served by GET /api/v1/orders/:id/details.
+// Partial is set, and Errors lists the failed calls, when a product or the
+// payments could not be fetched.
+type OrderDetails struct {
+	Order    json.RawMessage    `json:"order"`
+	Items    []OrderItemDetails `json:"items"`
+	Payments json.RawMessage    `json:"payments"`
+	Partial  bool               `json:"partial"`
+	Errors   []ComposeError     `json:"errors,omitempty"`
+}
+
+// orderDetails serves an order of the authenticated user with its products and
+// payments in one response. The order is required; products and payments are
+// fetched in parallel and a failure there only marks the response as partial.
+func orderDetails(gw *Gateway, policy retryPolicy) gin.HandlerFunc {
+	for _, service := range composeUpstreams["order_details"] {
+		gw.discovery.Watch(service)
+	}
+
+	return func(c *gin.Context) {
+		orderID := c.Param("id")
+
+		orderResult := gw.fetch(c, "order-service", "/api/v1/orders/"+url.PathEscape(orderID), policy)
+		if failure, failed := orderResult.failure("order-service", "order"); failed {
+			if orderResult.err == nil {
+				// Pass the order service's own response through, e.g. a 404
+				c.Data(orderResult.status, "application/json; charset=utf-8", orderResult.body)
+				return
+			}
+			c.JSON(failure.Status, gin.H{
+				"error": failure.Error,
+				"code":  failure.Code,
+			})
+			return
+		}
+
+		var order struct {
+			// order-service serializes the owner under its Go field name
+			UserID     string `json:"UserID"`
+			OrderItems []struct {
+				ProductID string  `json:"product_id"`
+				Quantity  int     `json:"quantity"`
+				Price     float64 `json:"price"`
+			} `json:"order_items"`
+		}
+		if err := json.Unmarshal(orderResult.body, &order); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":   "Invalid response from order service",
+				"code":    "INVALID_UPSTREAM_RESPONSE",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		// Products and payments are only fetched for the order's owner. Other
+		// users get the same answer as for an order that does not exist.
+		if order.UserID != middleware.UserID(c) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Order not found",
+				"details": fmt.Sprintf("Order with ID %s not found", orderID),
+				"code":    "ORDER_NOT_FOUND",
+			})
+			return
+		}
+
+		var productIDs []string
+		seen := make(map[string]bool)
+		for _, item := range order.OrderItems {
+			if !seen[item.ProductID] {
+				seen[item.ProductID] = true
+				productIDs = append(productIDs, item.ProductID)
+			}
+		}
+
+		var wg sync.WaitGroup
+		products := make([]fetchResult, len(productIDs))
+		for i, productID := range productIDs {
+			wg.Add(1)
+			go func(i int, productID string) {
+				defer wg.Done()
+				products[i] = gw.fetch(c, "product-service", "/api/v1/products/"+url.PathEscape(productID), policy)
+			}(i, productID)
+		}
+		var payments fetchResult
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payments = gw.fetch(c, "payment-service", "/api/v1/payments?order_id="+url.QueryEscape(orderID), policy)
+		}()
+		wg.Wait()
+
+		details := OrderDetails{
+			Order: orderResult.body,
+			Items: make([]OrderItemDetails, len(order.OrderItems)),
+		}
+
+		productByID := make(map[string]json.RawMessage, len(productIDs))
+		for i, productID := range productIDs {
+			if failure, failed := products[i].failure("product-service", fmt.Sprintf("product %s", productID)); failed {
+				details.Errors = append(details.Errors, failure)
+				continue
+			}
+			productByID[productID] = products[i].body
+		}
+		for i, item := range order.OrderItems {
+			details.Items[i] = OrderItemDetails{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Price:     item.Price,
+				Product:   productByID[item.ProductID],
+			}
+		}
+
+		if failure, failed := payments.failure("payment-service", "payments"); failed {
+			details.Errors = append(details.Errors, failure)
+		} else {
+			details.Payments = payments.body
+		}
+
+		details.Partial = len(details.Errors) > 0
+		c.JSON(http.StatusOK, details)
+	}
+}
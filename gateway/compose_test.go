@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOrderDetailsChecksTheOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const orderID, owner = "5b0c3c4e-8a7e-4b57-9d3c-1f2a3b4c5d6e", "owner"
+
+	order := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"ID":          orderID,
+			"UserID":      owner,
+			"order_items": []map[string]any{{"product_id": "p1", "quantity": 1, "price": 5}},
+		})
+	})
+	var fanOut atomic.Int32
+	counted := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fanOut.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	})
+	gw := newTestGateway(t, map[string][]registry.Instance{
+		"order-service":   testInstances(t, order, 1),
+		"product-service": testInstances(t, counted, 1),
+		"payment-service": testInstances(t, counted, 1),
+	})
+
+	r := gin.New()
+	r.GET("/orders/:id/details", func(c *gin.Context) {
+		// Stands in for the gateway's token authentication
+		userID := c.GetHeader(middleware.HeaderUserID)
+		c.Set("user_id", userID)
+		c.Next()
+	}, orderDetails(gw, retryPolicy{}))
+	gateway := serveTestGateway(t, r)
+
+	tests := []struct {
+		userID     string
+		wantStatus int
+		wantFanOut int32
+	}{
+		{"intruder", http.StatusNotFound, 0},
+		{owner, http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.userID, func(t *testing.T) {
+			fanOut.Store(0)
+			req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/orders/"+orderID+"/details", nil)
+			req.Header.Set(middleware.HeaderUserID, tt.userID)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.NewDecoder(resp.Body).Decode(&body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotFound && body.Code != "ORDER_NOT_FOUND" {
+				t.Errorf("code %q, want ORDER_NOT_FOUND", body.Code)
+			}
+			if got := fanOut.Load(); got != tt.wantFanOut {
+				t.Errorf("%d product and payment requests, want %d", got, tt.wantFanOut)
+			}
+		})
+	}
+}
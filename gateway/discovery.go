@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"e-commerce-platform/pkg/registry"
+)
+
+const (
+	// discoveryStaleAfter marks a cached entry stale when the registry has not answered for this long
+	discoveryStaleAfter = 2 * registry.WaitTime
+	// discoveryInitialWait is how long a first lookup waits for the watcher to fill the cache
+	discoveryInitialWait = 5 * time.Second
+	// discoveryMinBackoff and discoveryMaxBackoff bound the wait between queries of a failing registry
+	discoveryMinBackoff = time.Second
+	discoveryMaxBackoff = 30 * time.Second
+)
+
+// ErrDiscoveryPending is returned when a service has never been resolved yet
+var ErrDiscoveryPending = errors.New("service discovery has not completed")
+
+// serviceEntry is the cached view of one service kept up to date by a watcher
+type serviceEntry struct {
+	instances []*Instance
+	synced    bool
+	lastIndex uint64
+	syncedAt  time.Time
+	lastError error
+	errorAt   time.Time
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func (e *serviceEntry) markReady() {
+	e.readyOnce.Do(func() { close(e.ready) })
+}
+
+// ServiceStatus describes the cache state of a service for the admin endpoint
+type ServiceStatus struct {
+	Service    string     `json:"service"`
+	Instances  []Instance `json:"instances"`
+	Synced     bool       `json:"synced"`
+	SyncedAt   *time.Time `json:"synced_at,omitempty"`
+	AgeSeconds float64    `json:"age_seconds"`
+	Stale      bool       `json:"stale"`
+	LastIndex  uint64     `json:"last_index"`
+	LastError  string     `json:"last_error,omitempty"`
+	ErrorAt    *time.Time `json:"error_at,omitempty"`
+}
+
+// Discovery caches healthy instances per service. Each service is watched with
+// blocking registry queries, and the last known-good set is served while the registry is down.
+type Discovery struct {
+	registry registry.Registry
+	ctx      context.Context
+	// initialWait and minBackoff are discoveryInitialWait and discoveryMinBackoff
+	initialWait time.Duration
+	minBackoff  time.Duration
+
+	mu       sync.RWMutex
+	services map[string]*serviceEntry
+}
+
+// NewDiscovery creates a discovery cache whose watchers stop when ctx is cancelled
+func NewDiscovery(ctx context.Context, reg registry.Registry) *Discovery {
+	return &Discovery{
+		registry:    reg,
+		ctx:         ctx,
+		initialWait: discoveryInitialWait,
+		minBackoff:  discoveryMinBackoff,
+		services:    make(map[string]*serviceEntry),
+	}
+}
+
+// Watch starts watching a service if it is not watched already
+func (d *Discovery) Watch(serviceName string) {
+	d.entry(serviceName)
+}
+
+func (d *Discovery) entry(serviceName string) *serviceEntry {
+	d.mu.RLock()
+	entry, ok := d.services[serviceName]
+	d.mu.RUnlock()
+	if ok {
+		return entry
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if entry, ok := d.services[serviceName]; ok {
+		return entry
+	}
+
+	entry = &serviceEntry{ready: make(chan struct{})}
+	d.services[serviceName] = entry
+	go d.watch(serviceName, entry)
+	return entry
+}
+
+// Instances returns the cached healthy instances of a service. Once a service has
+// been resolved successfully, its last known-good set is returned even if the registry is unreachable.
+func (d *Discovery) Instances(serviceName string) ([]*Instance, error) {
+	entry := d.entry(serviceName)
+
+	// Only the first lookups of a service wait, and their timer is released
+	// as soon as the watcher is ready
+	select {
+	case <-entry.ready:
+	default:
+		timer := time.NewTimer(d.initialWait)
+		select {
+		case <-entry.ready:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if entry.synced {
+		return entry.instances, nil
+	}
+	if entry.lastError != nil {
+		return nil, entry.lastError
+	}
+	return nil, ErrDiscoveryPending
+}
+
+// watch keeps the entry in sync with the registry until the discovery context is cancelled
+func (d *Discovery) watch(serviceName string, entry *serviceEntry) {
+	backoff := d.minBackoff
+
+	for {
+		d.mu.RLock()
+		waitIndex := entry.lastIndex
+		d.mu.RUnlock()
+
+		entries, lastIndex, err := d.registry.Instances(d.ctx, serviceName, waitIndex)
+		if d.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Printf("Discovery watch for %s failed, serving cached instances: %v", serviceName, err)
+			d.mu.Lock()
+			entry.lastError = err
+			entry.errorAt = time.Now()
+			d.mu.Unlock()
+			entry.markReady()
+
+			select {
+			case <-time.After(backoff):
+			case <-d.ctx.Done():
+				return
+			}
+			backoff *= 2
+			if backoff > discoveryMaxBackoff {
+				backoff = discoveryMaxBackoff
+			}
+			continue
+		}
+		backoff = d.minBackoff
+
+		instances := make([]*Instance, 0, len(entries))
+		for _, e := range entries {
+			instances = append(instances, &Instance{
+				ID:      e.ID,
+				Address: e.Address,
+				Port:    e.Port,
+				Tags:    e.Tags,
+				Meta:    e.Meta,
+			})
+		}
+
+		d.mu.Lock()
+		// The registry may reset its index, in which case the next query must start over
+		if lastIndex < entry.lastIndex {
+			entry.lastIndex = 0
+		} else {
+			entry.lastIndex = lastIndex
+		}
+		entry.instances = instances
+		entry.synced = true
+		entry.syncedAt = time.Now()
+		entry.lastError = nil
+		d.mu.Unlock()
+		entry.markReady()
+	}
+}
+
+// Status reports the cache age and staleness of every watched service
+func (d *Discovery) Status() []ServiceStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := time.Now()
+	statuses := make([]ServiceStatus, 0, len(d.services))
+	for name, entry := range d.services {
+		status := ServiceStatus{
+			Service:   name,
+			Instances: make([]Instance, 0, len(entry.instances)),
+			Synced:    entry.synced,
+			LastIndex: entry.lastIndex,
+			Stale:     !entry.synced || entry.lastError != nil,
+		}
+		for _, instance := range entry.instances {
+			status.Instances = append(status.Instances, *instance)
+		}
+		if entry.synced {
+			syncedAt := entry.syncedAt
+			status.SyncedAt = &syncedAt
+			status.AgeSeconds = now.Sub(syncedAt).Seconds()
+			if now.Sub(syncedAt) > discoveryStaleAfter {
+				status.Stale = true
+			}
+		}
+		if entry.lastError != nil {
+			errorAt := entry.errorAt
+			status.LastError = entry.lastError.Error()
+			status.ErrorAt = &errorAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Service < statuses[j].Service
+	})
+	return statuses
+}
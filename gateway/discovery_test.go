@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/registry"
+)
+
+// errRegistryDown is returned by a flakyRegistry that is down
+var errRegistryDown = errors.New("registry unreachable")
+
+// flakyRegistry is a memory registry that fails while it is down. When hold is
+// not nil, queries wait until it is closed.
+type flakyRegistry struct {
+	*registry.Memory
+	down atomic.Bool
+	hold chan struct{}
+}
+
+func (r *flakyRegistry) Instances(ctx context.Context, service string, index uint64) ([]registry.Instance, uint64, error) {
+	if r.hold != nil {
+		select {
+		case <-r.hold:
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}
+	instances, lastIndex, err := r.Memory.Instances(ctx, service, index)
+	if r.down.Load() {
+		return nil, 0, errRegistryDown
+	}
+	return instances, lastIndex, err
+}
+
+// newTestDiscovery creates a discovery cache of reg that retries a failing
+// registry after a few milliseconds
+func newTestDiscovery(t *testing.T, reg registry.Registry) *Discovery {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d := NewDiscovery(ctx, reg)
+	d.minBackoff = 5 * time.Millisecond
+	return d
+}
+
+// register registers an instance of product-service with the given ID
+func register(t *testing.T, reg *registry.Memory, id string) {
+	t.Helper()
+	instance := registry.Instance{ID: id, Name: "product-service", Address: "10.0.0.1", Port: 8000}
+	if err := reg.Register(context.Background(), instance); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// instanceIDs returns the IDs of the cached instances of product-service
+func instanceIDs(t *testing.T, d *Discovery) string {
+	t.Helper()
+	instances, err := d.Instances("product-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// waitForInstances fails the test unless the cached instances of
+// product-service become want within a second
+func waitForInstances(t *testing.T, d *Discovery, want string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		got := instanceIDs(t, d)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instances %q, want %q", got, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// productStatus returns the cache status of product-service
+func productStatus(t *testing.T, d *Discovery) ServiceStatus {
+	t.Helper()
+	for _, status := range d.Status() {
+		if status.Service == "product-service" {
+			return status
+		}
+	}
+	t.Fatal("product-service is not watched")
+	return ServiceStatus{}
+}
+
+func TestDiscoveryWatchesChanges(t *testing.T) {
+	reg := registry.NewMemory()
+	register(t, reg, "a")
+	d := newTestDiscovery(t, reg)
+
+	waitForInstances(t, d, "a")
+	register(t, reg, "b")
+	waitForInstances(t, d, "a,b")
+	if err := reg.Deregister(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	waitForInstances(t, d, "b")
+
+	status := productStatus(t, d)
+	if !status.Synced || status.Stale || status.LastError != "" || len(status.Instances) != 1 {
+		t.Errorf("status %+v, want a fresh cache of one instance", status)
+	}
+
+	// An entry the registry has not refreshed for long is stale
+	d.mu.Lock()
+	d.services["product-service"].syncedAt = time.Now().Add(-discoveryStaleAfter - time.Second)
+	d.mu.Unlock()
+	if status := productStatus(t, d); !status.Stale {
+		t.Error("status is not stale after the registry went quiet")
+	}
+}
+
+func TestDiscoveryServesLastKnownInstances(t *testing.T) {
+	reg := &flakyRegistry{Memory: registry.NewMemory()}
+	register(t, reg.Memory, "a")
+	d := newTestDiscovery(t, reg)
+	waitForInstances(t, d, "a")
+
+	// The change wakes up the watcher, which finds the registry down
+	reg.down.Store(true)
+	register(t, reg.Memory, "b")
+	deadline := time.Now().Add(time.Second)
+	for productStatus(t, d).LastError == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("the failed query was not recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if got := instanceIDs(t, d); got != "a" {
+		t.Errorf("instances %q while the registry is down, want the last known a", got)
+	}
+	status := productStatus(t, d)
+	if !status.Stale || status.LastError != errRegistryDown.Error() || status.ErrorAt == nil {
+		t.Errorf("status %+v, want a stale cache with the registry error", status)
+	}
+
+	// Once the registry is back the change is picked up
+	reg.down.Store(false)
+	waitForInstances(t, d, "a,b")
+	if status := productStatus(t, d); status.Stale || status.LastError != "" {
+		t.Errorf("status %+v, want a fresh cache", status)
+	}
+}
+
+func TestDiscoveryInitialWait(t *testing.T) {
+	tests := []struct {
+		name string
+		// answerAfter is when the registry first answers, never when 0
+		answerAfter time.Duration
+		down        bool
+		instances   int
+		want        error
+		// maxWait bounds how long the first lookup may take
+		maxWait time.Duration
+	}{
+		{"answered within the wait", 20 * time.Millisecond, false, 1, nil, 500 * time.Millisecond},
+		{"service without instances", time.Millisecond, false, 0, nil, 500 * time.Millisecond},
+		{"registry down", time.Millisecond, true, 1, errRegistryDown, 500 * time.Millisecond},
+		{"no answer", 0, false, 1, ErrDiscoveryPending, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := &flakyRegistry{Memory: registry.NewMemory(), hold: make(chan struct{})}
+			reg.down.Store(tt.down)
+			if tt.instances > 0 {
+				register(t, reg.Memory, "a")
+			}
+			if tt.answerAfter > 0 {
+				time.AfterFunc(tt.answerAfter, func() { close(reg.hold) })
+			}
+			d := newTestDiscovery(t, reg)
+			d.initialWait = time.Second / 2
+
+			start := time.Now()
+			instances, err := d.Instances("product-service")
+			elapsed := time.Since(start)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("error %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && len(instances) != tt.instances {
+				t.Errorf("%d instances, want %d", len(instances), tt.instances)
+			}
+			if elapsed > tt.maxWait {
+				t.Errorf("first lookup took %s, want at most %s", elapsed, tt.maxWait)
+			}
+			if tt.want == ErrDiscoveryPending && elapsed < d.initialWait {
+				t.Errorf("gave up after %s, want to wait %s for the registry", elapsed, d.initialWait)
+			}
+
+			// Once the watcher is ready, lookups are answered from the cache at once
+			if tt.answerAfter > 0 {
+				start := time.Now()
+				d.Instances("product-service")
+				if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+					t.Errorf("second lookup took %s", elapsed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"e-commerce-platform/pkg/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testInstances starts count servers running handler and returns them as
+// registry instances, identified by their address
+func testInstances(t *testing.T, handler http.Handler, count int) []registry.Instance {
+	t.Helper()
+	var instances []registry.Instance
+	for i := 0; i < count; i++ {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		u, _ := url.Parse(server.URL)
+		host, portValue, _ := net.SplitHostPort(u.Host)
+		port, _ := strconv.Atoi(portValue)
+		instances = append(instances, registry.Instance{ID: u.Host, Address: host, Port: port})
+	}
+	return instances
+}
+
+// newTestGateway creates a gateway that discovers the given instances, with
+// every service configured with the default settings
+func newTestGateway(t *testing.T, services map[string][]registry.Instance) *Gateway {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	gw := NewGateway(NewDiscovery(ctx, registry.NewStatic(services)))
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	if err := gw.Configure(names); err != nil {
+		t.Fatal(err)
+	}
+	return gw
+}
+
+// serveTestGateway runs router on a test server. The reverse proxy needs a
+// CloseNotifier, which httptest.ResponseRecorder does not implement.
+func serveTestGateway(t *testing.T, router *gin.Engine) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
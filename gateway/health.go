@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"e-commerce-platform/pkg/health"
+)
+
+// systemProbeTimeout bounds each instance readiness probe of /health/system
+const systemProbeTimeout = 2 * time.Second
+
+// InstanceHealth is the readiness of one upstream instance
+type InstanceHealth struct {
+	ID        string                        `json:"id"`
+	Status    string                        `json:"status"`
+	LatencyMS float64                       `json:"latency_ms"`
+	Checks    map[string]health.CheckResult `json:"checks,omitempty"`
+	Error     string                        `json:"error,omitempty"`
+}
+
+// UpstreamHealth is the readiness of every instance of one upstream
+type UpstreamHealth struct {
+	Service   string           `json:"service"`
+	Status    string           `json:"status"`
+	Breaker   string           `json:"breaker,omitempty"`
+	Instances []InstanceHealth `json:"instances"`
+}
+
+// SystemHealth is the aggregated view served on /health/system
+type SystemHealth struct {
+	Status    string           `json:"status"`
+	CheckedAt time.Time        `json:"checked_at"`
+	Upstreams []UpstreamHealth `json:"upstreams"`
+}
+
+// SystemHealth probes /health/ready on every discovered instance of every upstream
+func (g *Gateway) SystemHealth(ctx context.Context) SystemHealth {
+	client := &http.Client{Transport: g.transport, Timeout: systemProbeTimeout}
+	services := g.discovery.Status()
+
+	report := SystemHealth{
+		CheckedAt: time.Now(),
+		Upstreams: make([]UpstreamHealth, len(services)),
+	}
+
+	var wg sync.WaitGroup
+	for i, service := range services {
+		upstreamHealth := UpstreamHealth{
+			Service:   service.Service,
+			Instances: make([]InstanceHealth, len(service.Instances)),
+		}
+		g.mu.Lock()
+		if up, ok := g.upstreams[service.Service]; ok {
+			upstreamHealth.Breaker = up.health.service.Status().State.String()
+		}
+		g.mu.Unlock()
+		report.Upstreams[i] = upstreamHealth
+
+		for j := range service.Instances {
+			wg.Add(1)
+			go func(i, j int, instance Instance) {
+				defer wg.Done()
+				report.Upstreams[i].Instances[j] = probeInstance(ctx, client, &instance)
+			}(i, j, service.Instances[j])
+		}
+	}
+	wg.Wait()
+
+	up, down := 0, 0
+	for i := range report.Upstreams {
+		upstream := &report.Upstreams[i]
+		healthy := 0
+		for _, instance := range upstream.Instances {
+			if instance.Status == health.StatusUp {
+				healthy++
+			}
+		}
+		upstream.Status = aggregateStatus(healthy, len(upstream.Instances))
+		switch upstream.Status {
+		case health.StatusUp:
+			up++
+		case health.StatusDown:
+			down++
+		}
+	}
+
+	report.Status = health.StatusDegraded
+	if down == len(report.Upstreams) {
+		report.Status = health.StatusDown
+	} else if up == len(report.Upstreams) {
+		report.Status = health.StatusUp
+	}
+	return report
+}
+
+// aggregateStatus is UP when everything is healthy, DOWN when nothing is, and DEGRADED in between
+func aggregateStatus(healthy, total int) string {
+	switch {
+	case total == 0 || healthy == 0:
+		return health.StatusDown
+	case healthy == total:
+		return health.StatusUp
+	default:
+		return health.StatusDegraded
+	}
+}
+
+func probeInstance(ctx context.Context, client *http.Client, instance *Instance) InstanceHealth {
+	result := InstanceHealth{ID: instance.ID, Status: health.StatusDown}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/health/ready", instance.Host()), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	var report health.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err == nil {
+		result.Checks = report.Checks
+	}
+	if resp.StatusCode == http.StatusOK {
+		result.Status = health.StatusUp
+	} else {
+		result.Error = fmt.Sprintf("readiness returned %d", resp.StatusCode)
+	}
+	return result
+}
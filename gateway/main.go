@@ -5,19 +5,23 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
+	"e-commerce-platform/pkg/config"
+	"e-commerce-platform/pkg/health"
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/metrics"
+	"e-commerce-platform/pkg/middleware"
+	pkgredis "e-commerce-platform/pkg/redis"
+	"e-commerce-platform/pkg/registry"
+	"e-commerce-platform/pkg/tracing"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/hashicorp/consul/api"
-	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 )
 
 // validateUUID middleware checks if the :id parameter is a valid UUID
@@ -41,132 +45,184 @@ func validateUUID(errorCode string) gin.HandlerFunc {
 	}
 }
 
+// Config is the configuration of the gateway, see config.Load
+type Config struct {
+	Port int `env:"PORT" default:"8081" min:"1" max:"65535"`
+	// JWTSecret verifies the tokens issued by user-service, which signs them
+	// with the same secret
+	JWTSecret string `env:"JWT_SECRET" required:"true" secret:"true" insecure:"your-secret-key,your-default-secret-key"`
+	// RoutesFile is the route table, reloaded when it changes
+	RoutesFile string `env:"ROUTES_FILE"`
+
+	// Rate limiting, API keys and the shared response cache need Redis
+	RedisHost     string `env:"REDIS_HOST"`
+	RedisPort     int    `env:"REDIS_PORT" default:"6379" min:"1" max:"65535"`
+	RedisPassword string `env:"REDIS_PASSWORD" secret:"true"`
+}
+
 func main() {
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file:", err)
+	// Configuration comes from the environment, .env, secret files and CONFIG_FILE
+	cfg := Config{RoutesFile: defaultRoutesFilePath}
+	if err := config.Load(&cfg); err != nil {
+		log.Fatalf("invalid configuration of api-gateway:\n%v", err)
 	}
+	config.Log("api-gateway", cfg)
 
-	// Get the PORT from the environment, or default to 8081
-	port, err := strconv.Atoi(os.Getenv("PORT"))
-	if err != nil {
-		log.Fatal("Error: PORT must be a number:", err)
-	}
-	if port == 0 {
-		port = 8081
+	// Traces are exported as configured by TRACING_EXPORTER
+	if _, err := tracing.InitFromEnv("gateway"); err != nil {
+		log.Fatal(err)
 	}
 
-	// Initialize Gin router
-	r := gin.Default()
+	// Tokens are issued by user-service and verified here with the same secret
+	auth := requireAuth(cfg.JWTSecret)
 
-	// Consul client config
-	consulConfig := api.DefaultConfig()
-	consulConfig.Address = os.Getenv("CONSUL_HTTP_ADDR")
-	if consulConfig.Address == "" {
-		consulConfig.Address = "http://localhost:8500"
+	// Rate limiting, API keys and the shared response cache are enabled when Redis is configured
+	var redisClient *redis.Client
+	if cfg.RedisHost != "" {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", cfg.RedisHost, cfg.RedisPort),
+			Password: cfg.RedisPassword,
+		})
+		if err := redisClient.Ping(context.Background()).Err(); err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer redisClient.Close()
+	} else {
+		log.Println("REDIS_HOST not set, rate limits follow their failure policy, API keys are disabled and responses are cached in memory")
 	}
 
-	consulClient, err := api.NewClient(consulConfig)
+	// Services are discovered through the registry selected by REGISTRY (Consul by default)
+	reg, err := registry.FromEnv()
 	if err != nil {
-		log.Fatalf("Failed to create Consul client: %v", err)
-	}
-
-	// Register API Gateway with Consul
-	registration := new(api.AgentServiceRegistration)
-	registration.ID = "api-gateway"              // Unique ID for this instance
-	registration.Name = "api-gateway"            // Service name
-	registration.Port = port                     // API Gateway port
-	registration.Address = "api-gateway"         // Host IP or network interface
-	registration.Check = &api.AgentServiceCheck{ // Simple health check
-		HTTP:     fmt.Sprintf("http://gateway:%d/health", registration.Port),
-		Interval: "10s",
-		Timeout:  "1s",
+		log.Fatalf("Failed to create service registry: %v", err)
 	}
 
-	err = consulClient.Agent().ServiceRegister(registration)
-	if err != nil {
+	// Register API Gateway with the registry
+	instance := registry.InstanceFromEnv("api-gateway", cfg.Port)
+	if err := reg.Register(context.Background(), instance); err != nil {
 		log.Fatalf("Failed to register service: %v", err)
 	}
 
 	// Deregister API Gateway on exit
-	defer consulClient.Agent().ServiceDeregister(registration.ID)
-
-	// Basic health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "UP"})
-	})
-
-	// Routes
-	v1 := r.Group("/api/v1")
-	{
-		// Product routes
-		products := v1.Group("/products")
-		{
-			products.GET("", proxyToService(consulClient, "product-service", "/api/v1/products"))
-			products.POST("", proxyToService(consulClient, "product-service", "/api/v1/products"))
-			products.GET("/:id", validateUUID("INVALID_PRODUCT_ID"), proxyToService(consulClient, "product-service", "/api/v1/products/:id"))
-			products.PUT("/:id", validateUUID("INVALID_PRODUCT_ID"), proxyToService(consulClient, "product-service", "/api/v1/products/:id"))
-			products.DELETE("/:id", validateUUID("INVALID_PRODUCT_ID"), proxyToService(consulClient, "product-service", "/api/v1/products/:id"))
-		}
+	defer reg.Deregister(context.Background(), instance.ID)
 
-		// Order routes with UUID validation
-		orders := v1.Group("/orders")
-		{
-			// Base endpoints
-			orders.GET("", proxyToService(consulClient, "order-service", "/api/v1/orders"))
-			orders.POST("", proxyToService(consulClient, "order-service", "/api/v1/orders"))
-
-			// Endpoints with ID parameter
-			orders.GET("/:id", validateUUID("INVALID_ORDER_ID"), proxyToService(consulClient, "order-service", "/api/v1/orders"))
-			orders.PUT("/:id", validateUUID("INVALID_ORDER_ID"), proxyToService(consulClient, "order-service", "/api/v1/orders"))
-			orders.DELETE("/:id", validateUUID("INVALID_ORDER_ID"), proxyToService(consulClient, "order-service", "/api/v1/orders"))
-		}
+	// Background workers such as discovery watches and route reloads stop on exit
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
 
-		// User routes
-		users := v1.Group("/users")
-		{
-			// Public routes
-			users.POST("/register", proxyToService(consulClient, "user-service", "/register"))
-			users.POST("/login", proxyToService(consulClient, "user-service", "/login"))
-			users.POST("/forgot-password", proxyToService(consulClient, "user-service", "/forgot-password"))
-			users.POST("/reset-password", proxyToService(consulClient, "user-service", "/reset-password"))
-
-			// Protected routes
-			users.GET("/profile", proxyToService(consulClient, "user-service", "/profile"))
-			users.PUT("/profile", proxyToService(consulClient, "user-service", "/profile"))
-			users.PUT("/profile/change-password", proxyToService(consulClient, "user-service", "/profile/change-password")) // Updated path
-			users.DELETE("/profile", proxyToService(consulClient, "user-service", "/profile"))
-
-			// Address routes
-			users.POST("/addresses", proxyToService(consulClient, "user-service", "/addresses"))
-			users.GET("/addresses", proxyToService(consulClient, "user-service", "/addresses"))
-			users.PUT("/addresses/:id", proxyToService(consulClient, "user-service", "/addresses/:id"))
-			users.DELETE("/addresses/:id", proxyToService(consulClient, "user-service", "/addresses/:id"))
-			users.PUT("/addresses/:id/default", proxyToService(consulClient, "user-service", "/addresses"))
+	// Service discovery is served from a cache kept up to date by registry watches
+	discovery := NewDiscovery(workersCtx, reg)
+
+	// Upstream proxies and load balancers are shared across requests
+	gw := NewGateway(discovery)
+
+	// API keys of partner and machine clients are kept in Redis
+	var apiKeys *APIKeyStore
+	if redisClient != nil {
+		apiKeys = NewAPIKeyStore(redisClient)
+	}
+
+	// Cached responses survive route reloads. With Redis they are shared between
+	// gateway instances and purged by invalidation events from the services.
+	var responseCache *ResponseCache
+	if redisClient != nil {
+		cacheClient := pkgredis.NewFromClient(redisClient)
+		responseCache = NewResponseCache(cacheClient)
+		go responseCache.Listen(workersCtx, cacheClient)
+	} else {
+		responseCache = NewResponseCache(nil)
+	}
+
+	// The gateway is ready when it can reach the registry, and Redis when rate limiting is enabled
+	checker := health.NewChecker("api-gateway")
+	checker.Add("registry", reg.Ping)
+	if redisClient != nil {
+		checker.Add("redis", health.Redis(redisClient))
+	}
+
+	var routes *RouteManager
+	buildRouter := func(table *RouteTable) (*gin.Engine, error) {
+		// Initialize Gin router
+		r := gin.New()
+		r.Use(gin.Recovery(), logging.RequestID(), logging.AccessLog("gateway"), metrics.Middleware("gateway"), tracing.Middleware())
+
+		// Identity headers may only be set by the gateway itself
+		r.Use(stripIdentityHeaders())
+
+		// Liveness, readiness and the aggregated view of every upstream
+		checker.Register(r)
+		r.GET("/health/system", func(c *gin.Context) {
+			report := gw.SystemHealth(c.Request.Context())
+			status := http.StatusOK
+			if report.Status == health.StatusDown {
+				status = http.StatusServiceUnavailable
+			}
+			c.JSON(status, report)
+		})
+
+		// Prometheus metrics
+		r.GET("/metrics", metrics.Handler())
+
+		// OpenAPI document generated from the route table, and its docs page
+		if err := registerOpenAPI(r, table); err != nil {
+			return nil, err
 		}
 
-		// Inventory routes
-		inventory := v1.Group("/inventory")
+		// Admin endpoints
+		admin := r.Group("/admin", auth, middleware.RequireRole("admin"))
 		{
-			inventory.POST("/items", proxyToService(consulClient, "inventory-service", "/api/v1/inventory/items"))
-			inventory.GET("/items", proxyToService(consulClient, "inventory-service", "/api/v1/inventory/items"))
-			inventory.GET("/items/:id", validateUUID("INVALID_INVENTORY_ID"), proxyToService(consulClient, "inventory-service", "/api/v1/inventory/items/:id"))
-			inventory.PUT("/items/:id/stock", validateUUID("INVALID_INVENTORY_ID"), proxyToService(consulClient, "inventory-service", "/api/v1/inventory/items/:id/stock"))
-			inventory.GET("/items/:id/transactions", validateUUID("INVALID_INVENTORY_ID"), proxyToService(consulClient, "inventory-service", "/api/v1/inventory/items/:id/transactions"))
+			admin.GET("/discovery", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"services": discovery.Status()})
+			})
+			admin.GET("/routes", func(c *gin.Context) {
+				c.JSON(http.StatusOK, routes.Status())
+			})
+			admin.GET("/breakers", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"upstreams": gw.BreakerStatus()})
+			})
+			admin.GET("/canaries", func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"upstreams": gw.CanaryStatus()})
+			})
+			registerAPIKeyAdmin(admin, apiKeys, table.RateLimits)
+			admin.DELETE("/cache/:group", func(c *gin.Context) {
+				group := c.Param("group")
+				if err := responseCache.Purge(c.Request.Context(), group); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{
+						"error":   "Failed to purge response cache",
+						"code":    "CACHE_PURGE_FAILED",
+						"details": err.Error(),
+					})
+					return
+				}
+				c.JSON(http.StatusOK, gin.H{"message": "Cache group purged", "group": group})
+			})
 		}
 
-		// Payment routes
-		payments := v1.Group("/payments")
-		{
-			payments.POST("", proxyToService(consulClient, "payment-service", "/api/v1/payments"))
-			payments.GET("/:id", validateUUID("INVALID_PAYMENT_ID"), proxyToService(consulClient, "payment-service", "/api/v1/payments/:id"))
+		if err := registerRoutes(r, gw, table, auth, apiKeys, redisClient, responseCache); err != nil {
+			return nil, err
 		}
+
+		// Canary weights take effect together with the routes of the same table
+		gw.SetCanaries(table.Canaries)
+		return r, nil
+	}
+
+	// Routes are declared in the route table file and rebuilt on every reload
+	routes, err = NewRouteManager(cfg.RoutesFile, buildRouter)
+	if err != nil {
+		log.Fatalf("Failed to load routes: %v", err)
 	}
+	go routes.Watch(workersCtx)
 
 	// Configure graceful shutdown
 	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: r,
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           routes,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		// Leave room for the slowest route to answer with its own timeout error
+		WriteTimeout: maxRouteTimeout + 5*time.Second,
+		IdleTimeout:  120 * time.Second,
 	}
 
 	// Handle shutdown gracefully
@@ -194,76 +250,6 @@ func main() {
 	log.Println("Server exiting")
 }
 
-// serviceName - consul service name
-// targetPath - path which will be forwarded to a service along with path parameters
-func proxyToService(consulClient *api.Client, serviceName, targetPath string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		log.Printf("Incoming request to gateway: %s %s", c.Request.Method, c.Request.URL.Path)
-
-		services, _, err := consulClient.Health().Service(serviceName, "", true, nil)
-		if err != nil {
-			log.Printf("Error discovering service: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to discover service",
-				"code":  "SERVICE_DISCOVERY_ERROR",
-			})
-			return
-		}
-
-		if len(services) == 0 {
-			log.Printf("No healthy instances found for service: %s", serviceName)
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "Service unavailable",
-				"code":  "SERVICE_UNAVAILABLE",
-			})
-			return
-		}
-
-		service := services[0].Service
-		targetURL := &url.URL{
-			Scheme: "http",
-			Host:   fmt.Sprintf("%s:%d", service.Address, service.Port),
-		}
-
-		proxy := httputil.NewSingleHostReverseProxy(targetURL)
-		originalDirector := proxy.Director
-		proxy.Director = func(req *http.Request) {
-			originalDirector(req)
-			req.URL.Scheme = targetURL.Scheme
-			req.URL.Host = targetURL.Host
-
-			// Preserve the full path from the gateway
-			req.URL.Path = targetPath
-			// Replace :id with the actual ID value
-			if strings.Contains(targetPath, ":id") {
-				id := c.Param("id")
-				req.URL.Path = strings.ReplaceAll(req.URL.Path, ":id", id)
-			}
-
-			// Add any additional path segments from the original request
-			if c.Param("path") != "" {
-				req.URL.Path += c.Param("path")
-			}
-
-			req.URL.RawQuery = c.Request.URL.RawQuery
-			req.Header.Set("X-Forwarded-Host", c.Request.Host)
-
-			log.Printf("Forwarding request to: %s %s", req.Method, req.URL.String())
-		}
-
-		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-			log.Printf("Proxy error: %v", err)
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error":   "Failed to proxy request",
-				"code":    "PROXY_ERROR",
-				"details": err.Error(),
-			})
-		}
-
-		proxy.ServeHTTP(c.Writer, c.Request)
-	}
-}
-
 // placeholderHandler creates a simple handler that returns a message indicating which service it's for.
 func placeholderHandler(serviceName string) gin.HandlerFunc {
 	return func(c *gin.Context) {
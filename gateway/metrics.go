@@ -0,0 +1,36 @@
+package main
+
+import "e-commerce-platform/pkg/metrics"
+
+var (
+	upstreamSelections = metrics.NewCounterVec(
+		"gateway_upstream_selections_total",
+		"Number of requests sent to each upstream instance, including retries.",
+		"service", "instance",
+	)
+	upstreamResponses = metrics.NewCounterVec(
+		"gateway_upstream_responses_total",
+		"Number of upstream attempts by service version and result (success or error).",
+		"service", "version", "result",
+	)
+	upstreamRetries = metrics.NewCounterVec(
+		"gateway_upstream_retries_total",
+		"Number of retried upstream requests.",
+		"service",
+	)
+	proxyErrors = metrics.NewCounterVec(
+		"gateway_proxy_errors_total",
+		"Number of requests the gateway could not proxy, by reason.",
+		"service", "reason",
+	)
+	cacheRequests = metrics.NewCounterVec(
+		"gateway_cache_requests_total",
+		"Number of requests to cached routes, by result (hit, miss or bypass).",
+		"service", "result",
+	)
+	cachePurges = metrics.NewCounterVec(
+		"gateway_cache_purges_total",
+		"Number of response cache purges, by group.",
+		"group",
+	)
+)
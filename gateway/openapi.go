@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+const schemaRefPrefix = "#/components/schemas/"
+
+//go:embed openapi_schemas.yaml
+var schemasYAML []byte
+
+// Schema is the subset of the OpenAPI 3.0 schema object used by the request schemas
+type Schema struct {
+	Ref              string             `yaml:"$ref" json:"$ref,omitempty"`
+	Type             string             `yaml:"type" json:"type,omitempty"`
+	Format           string             `yaml:"format" json:"format,omitempty"`
+	Description      string             `yaml:"description" json:"description,omitempty"`
+	Properties       map[string]*Schema `yaml:"properties" json:"properties,omitempty"`
+	Required         []string           `yaml:"required" json:"required,omitempty"`
+	Items            *Schema            `yaml:"items" json:"items,omitempty"`
+	Enum             []interface{}      `yaml:"enum" json:"enum,omitempty"`
+	Minimum          *float64           `yaml:"minimum" json:"minimum,omitempty"`
+	ExclusiveMinimum bool               `yaml:"exclusiveMinimum" json:"exclusiveMinimum,omitempty"`
+	Maximum          *float64           `yaml:"maximum" json:"maximum,omitempty"`
+	MinLength        *int               `yaml:"minLength" json:"minLength,omitempty"`
+	MaxLength        *int               `yaml:"maxLength" json:"maxLength,omitempty"`
+	MinItems         *int               `yaml:"minItems" json:"minItems,omitempty"`
+	Nullable         bool               `yaml:"nullable" json:"nullable,omitempty"`
+}
+
+// requestSchemas are the named schemas routes can reference with request_body
+var requestSchemas = mustLoadSchemas(schemasYAML)
+
+func mustLoadSchemas(data []byte) map[string]*Schema {
+	var schemas map[string]*Schema
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&schemas); err != nil {
+		panic(fmt.Sprintf("invalid openapi_schemas.yaml: %v", err))
+	}
+	for name, schema := range schemas {
+		if err := checkRefs(schema, schemas); err != nil {
+			panic(fmt.Sprintf("invalid schema %s in openapi_schemas.yaml: %v", name, err))
+		}
+	}
+	return schemas
+}
+
+func checkRefs(schema *Schema, schemas map[string]*Schema) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		if _, ok := schemas[strings.TrimPrefix(schema.Ref, schemaRefPrefix)]; !ok {
+			return fmt.Errorf("unknown $ref %s", schema.Ref)
+		}
+	}
+	for _, property := range schema.Properties {
+		if err := checkRefs(property, schemas); err != nil {
+			return err
+		}
+	}
+	return checkRefs(schema.Items, schemas)
+}
+
+// Validate checks a decoded JSON value against the schema and returns one
+// message per violation, prefixed with the JSON path of the offending value
+func (s *Schema) Validate(value interface{}) []string {
+	return s.validate("$", value, requestSchemas)
+}
+
+func (s *Schema) validate(path string, value interface{}, schemas map[string]*Schema) []string {
+	if s.Ref != "" {
+		return schemas[strings.TrimPrefix(s.Ref, schemaRefPrefix)].validate(path, value, schemas)
+	}
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s must not be null", path)}
+	}
+
+	var errs []string
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an object", path)}
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				errs = append(errs, property.validate(path+"."+name, object[name], schemas)...)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an array", path)}
+		}
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			errs = append(errs, fmt.Sprintf("%s must have at least %d items", path, *s.MinItems))
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				errs = append(errs, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, schemas)...)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a string", path)}
+		}
+		if s.MinLength != nil && len([]rune(str)) < *s.MinLength {
+			errs = append(errs, fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && len([]rune(str)) > *s.MaxLength {
+			errs = append(errs, fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength))
+		}
+		if err := checkFormat(s.Format, str); err != nil {
+			errs = append(errs, fmt.Sprintf("%s %v", path, err))
+		}
+	case "integer", "number":
+		number, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a %s", path, s.Type)}
+		}
+		if s.Type == "integer" && number != float64(int64(number)) {
+			return []string{fmt.Sprintf("%s must be an integer", path)}
+		}
+		if s.Minimum != nil {
+			if s.ExclusiveMinimum && number <= *s.Minimum {
+				errs = append(errs, fmt.Sprintf("%s must be greater than %v", path, *s.Minimum))
+			} else if number < *s.Minimum {
+				errs = append(errs, fmt.Sprintf("%s must be at least %v", path, *s.Minimum))
+			}
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			errs = append(errs, fmt.Sprintf("%s must be at most %v", path, *s.Maximum))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s must be a boolean", path)}
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		allowed := false
+		for _, option := range s.Enum {
+			if option == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			errs = append(errs, fmt.Sprintf("%s must be one of %v", path, s.Enum))
+		}
+	}
+	return errs
+}
+
+func checkFormat(format, value string) error {
+	switch format {
+	case "uuid":
+		if _, err := uuid.Parse(value); err != nil {
+			return fmt.Errorf("must be a UUID")
+		}
+	case "email":
+		if _, err := mail.ParseAddress(value); err != nil {
+			return fmt.Errorf("must be an email address")
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return fmt.Errorf("must be an RFC 3339 date-time")
+		}
+	}
+	return nil
+}
+
+// validateBody rejects requests whose JSON body does not match the route's request schema
+func validateBody(schemaName string) gin.HandlerFunc {
+	schema := requestSchemas[schemaName]
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRetryBodyBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Failed to read request body",
+				"code":    "INVALID_REQUEST_BODY",
+				"details": err.Error(),
+			})
+			return
+		}
+		if len(body) > maxRetryBodyBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "Request body too large",
+				"code":  "REQUEST_BODY_TOO_LARGE",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   "Request body must be valid JSON",
+				"code":    "INVALID_REQUEST_BODY",
+				"details": err.Error(),
+			})
+			return
+		}
+		if errs := schema.Validate(value); len(errs) > 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":   fmt.Sprintf("Request body does not match %s", schemaName),
+				"code":    "INVALID_REQUEST_BODY",
+				"details": errs,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// paramPattern matches Gin path parameters
+var paramPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// BuildOpenAPI generates the OpenAPI 3 document of the gateway from its route table
+func BuildOpenAPI(table *RouteTable) gin.H {
+	paths := make(map[string]gin.H)
+	for _, route := range table.Routes {
+		path := paramPattern.ReplaceAllString(route.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = gin.H{}
+		}
+		paths[path][strings.ToLower(route.Method)] = buildOperation(route)
+	}
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "E-Commerce Platform API",
+			"version":     "1.0.0",
+			"description": "Public API of the e-commerce platform, served through the API gateway.",
+		},
+		"servers": []gin.H{{"url": "/"}},
+		"paths":   paths,
+		"components": gin.H{
+			"schemas": requestSchemas,
+			"securitySchemes": gin.H{
+				"bearerAuth": gin.H{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     gin.H{"type": "apiKey", "in": "header", "name": HeaderAPIKey},
+			},
+		},
+	}
+}
+
+func buildOperation(route RouteConfig) gin.H {
+	service := route.Service
+	if service == "" {
+		service = "gateway"
+	}
+	operation := gin.H{
+		"operationId": operationID(route),
+		"tags":        []string{service},
+	}
+	if route.Summary != "" {
+		operation["summary"] = route.Summary
+	}
+
+	var parameters []gin.H
+	for _, match := range paramPattern.FindAllStringSubmatch(route.Path, -1) {
+		schema := gin.H{"type": "string"}
+		if match[1] == "id" && route.ValidateID != "" {
+			schema["format"] = "uuid"
+		}
+		parameters = append(parameters, gin.H{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	if parameters != nil {
+		operation["parameters"] = parameters
+	}
+
+	if route.RequestBody != "" {
+		operation["requestBody"] = gin.H{
+			"required": true,
+			"content": gin.H{
+				"application/json": gin.H{
+					"schema": gin.H{"$ref": schemaRefPrefix + route.RequestBody},
+				},
+			},
+		}
+	}
+
+	var security []gin.H
+	if !route.Auth {
+		security = append(security, gin.H{})
+	} else {
+		security = append(security, gin.H{"bearerAuth": []string{}})
+	}
+	if len(route.Scopes) > 0 {
+		security = append(security, gin.H{"apiKey": route.Scopes})
+	}
+	operation["security"] = security
+
+	errorResponse := func(description string) gin.H {
+		return gin.H{
+			"description": description,
+			"content": gin.H{
+				"application/json": gin.H{"schema": gin.H{"$ref": schemaRefPrefix + "Error"}},
+			},
+		}
+	}
+	responses := gin.H{
+		successStatus(route.Method): gin.H{"description": "Successful response"},
+		"429":                       errorResponse("Rate limit exceeded"),
+		"502":                       errorResponse("Upstream error"),
+		"503":                       errorResponse("Service unavailable"),
+		"504":                       errorResponse("Upstream timeout"),
+	}
+	if route.RequestBody != "" || route.ValidateID != "" {
+		responses["400"] = errorResponse("Invalid request")
+	}
+	if route.Auth || len(route.Scopes) > 0 {
+		responses["401"] = errorResponse("Missing or invalid credentials")
+		responses["403"] = errorResponse("Insufficient permissions")
+	}
+	if strings.Contains(route.Path, ":") {
+		responses["404"] = errorResponse("Not found")
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+func successStatus(method string) string {
+	if method == http.MethodPost {
+		return "201"
+	}
+	return "200"
+}
+
+// operationID derives a stable ID such as get_api_v1_orders_id from a route
+func operationID(route RouteConfig) string {
+	var parts []string
+	for _, segment := range strings.Split(route.Path, "/") {
+		segment = strings.TrimLeft(segment, ":*")
+		segment = strings.ReplaceAll(segment, "-", "_")
+		if segment != "" {
+			parts = append(parts, segment)
+		}
+	}
+	return strings.ToLower(route.Method) + "_" + strings.Join(parts, "_")
+}
+
+// docsPage renders the OpenAPI document with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>E-Commerce Platform API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
+
+// registerOpenAPI serves the OpenAPI document of the loaded route table and its docs page
+func registerOpenAPI(r gin.IRouter, table *RouteTable) error {
+	spec, err := json.Marshal(BuildOpenAPI(table))
+	if err != nil {
+		return fmt.Errorf("failed to build OpenAPI document: %w", err)
+	}
+
+	r.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+	})
+	r.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+	})
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// testSchema exercises every keyword the request schemas use
+const testSchema = `
+type: object
+required: [id, quantity]
+properties:
+  id:
+    type: string
+    format: uuid
+  email:
+    type: string
+    format: email
+  at:
+    type: string
+    format: date-time
+  name:
+    type: string
+    minLength: 2
+    maxLength: 4
+  quantity:
+    type: integer
+    minimum: 1
+    maximum: 10
+  price:
+    type: number
+    minimum: 0
+    exclusiveMinimum: true
+  status:
+    type: string
+    enum: [pending, paid]
+  tags:
+    type: array
+    minItems: 1
+    items:
+      type: string
+  note:
+    type: string
+    nullable: true
+  active:
+    type: boolean
+  item:
+    $ref: '#/components/schemas/OrderItemRequest'
+`
+
+func TestSchemaValidate(t *testing.T) {
+	var schema Schema
+	if err := yaml.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	const valid = `"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "quantity": 2`
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"valid", `{` + valid + `}`, nil},
+		{"every property valid", `{` + valid + `, "email": "a@example.com", "at": "2024-05-01T10:00:00Z",
+			"name": "äöü", "price": 0.5, "status": "paid", "tags": ["new"], "note": null, "active": true,
+			"item": {"product_id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "quantity": 1}}`, nil},
+		{"unknown properties are allowed", `{` + valid + `, "extra": 1}`, nil},
+		{"not an object", `[]`, []string{"$ must be an object"}},
+		{"required", `{}`, []string{"$.id is required", "$.quantity is required"}},
+		{"null", `{` + valid + `, "name": null}`, []string{"$.name must not be null"}},
+		{"wrong type", `{` + valid + `, "name": 12, "active": "yes", "tags": "new"}`,
+			[]string{"$.active must be a boolean", "$.name must be a string", "$.tags must be an array"}},
+		{"uuid", `{"id": "42", "quantity": 2}`, []string{"$.id must be a UUID"}},
+		{"email", `{` + valid + `, "email": "nobody"}`, []string{"$.email must be an email address"}},
+		{"date-time", `{` + valid + `, "at": "yesterday"}`, []string{"$.at must be an RFC 3339 date-time"}},
+		{"minLength", `{` + valid + `, "name": "a"}`, []string{"$.name must be at least 2 characters"}},
+		{"maxLength", `{` + valid + `, "name": "abcde"}`, []string{"$.name must be at most 4 characters"}},
+		{"integer", `{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "quantity": 1.5}`, []string{"$.quantity must be an integer"}},
+		{"number", `{` + valid + `, "price": "free"}`, []string{"$.price must be a number"}},
+		{"minimum", `{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "quantity": 0}`, []string{"$.quantity must be at least 1"}},
+		{"maximum", `{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "quantity": 11}`, []string{"$.quantity must be at most 10"}},
+		{"exclusiveMinimum", `{` + valid + `, "price": 0}`, []string{"$.price must be greater than 0"}},
+		{"enum", `{` + valid + `, "status": "lost"}`, []string{"$.status must be one of [pending paid]"}},
+		{"minItems", `{` + valid + `, "tags": []}`, []string{"$.tags must have at least 1 items"}},
+		{"items", `{` + valid + `, "tags": ["a", 2]}`, []string{"$.tags[1] must be a string"}},
+		{"$ref", `{` + valid + `, "item": {"quantity": 0}}`, []string{"$.item.product_id is required", "$.item.quantity must be at least 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.body), &value); err != nil {
+				t.Fatal(err)
+			}
+			got := schema.Validate(value)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("violations %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// The upstream echoes the body it received
+	r := gin.New()
+	r.POST("/orders", validateBody("CreateOrderRequest"), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusCreated, "application/json", body)
+	})
+
+	validOrder := `{"items": [{"product_id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "quantity": 2}]}`
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		details []string
+	}{
+		{"valid", validOrder, http.StatusCreated, nil},
+		{"schema violations", `{"items": [{"product_id": "42"}]}`, http.StatusBadRequest,
+			[]string{"$.items[0].quantity is required", "$.items[0].product_id must be a UUID"}},
+		{"missing items", `{}`, http.StatusBadRequest, []string{"$.items is required"}},
+		{"not JSON", `{"items": [`, http.StatusBadRequest, nil},
+		{"empty body", ``, http.StatusBadRequest, nil},
+		{"too large", `{"items": [], "padding": "` + strings.Repeat("x", maxRetryBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusCreated {
+				if rec.Body.String() != tt.body {
+					t.Errorf("upstream received %q, want the original body", rec.Body.String())
+				}
+				return
+			}
+
+			var body struct {
+				Code    string   `json:"code"`
+				Details []string `json:"details"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if want := "INVALID_REQUEST_BODY"; tt.status == http.StatusBadRequest && body.Code != want {
+				t.Errorf("code %q, want %q", body.Code, want)
+			}
+			if tt.details != nil && strings.Join(body.Details, "\n") != strings.Join(tt.details, "\n") {
+				t.Errorf("details %q, want %q", body.Details, tt.details)
+			}
+		})
+	}
+}
+
+func TestLoadSchemasChecksRefs(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a schema with an unknown $ref was loaded")
+		}
+	}()
+	mustLoadSchemas([]byte(`
+Order:
+  type: object
+  properties:
+    item:
+      $ref: '#/components/schemas/Missing'
+`))
+}
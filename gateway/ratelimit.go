@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// rateLimiters holds the limiters built from the rate-limit tiers of one route table
+type rateLimiters struct {
+	// tiers count requests by the key configured for each tier
+	tiers map[string]gin.HandlerFunc
+	// apiKeys count requests per API key with the tier of the key
+	apiKeys map[string]gin.HandlerFunc
+	// roles maps user roles to their tier
+	roles map[string]string
+}
+
+// newRateLimiters builds a limiter per tier and key kind. Without Redis each
+// tier follows its failure policy: local tiers are enforced by this gateway
+// instance, closed tiers reject requests and open tiers are not limited.
+func newRateLimiters(redisClient *redis.Client, table *RouteTable) *rateLimiters {
+	limiters := &rateLimiters{
+		tiers:   make(map[string]gin.HandlerFunc),
+		apiKeys: make(map[string]gin.HandlerFunc),
+		roles:   table.RoleRateLimits,
+	}
+
+	for tier, limit := range table.RateLimits {
+		// The table has been validated, so parsing cannot fail here
+		algorithm, _ := middleware.ParseAlgorithm(limit.Algorithm)
+		key, _ := middleware.ParseKey(limit.Key)
+		policy, _ := middleware.ParseFailurePolicy(limit.FailurePolicy)
+		if redisClient == nil && policy != middleware.FailLocal {
+			log.Printf("REDIS_HOST not set, rate limit tier %s fails %s", tier, policy)
+		}
+
+		limiters.tiers[tier] = middleware.NewTierRateLimiter(redisClient, tier, limit.Requests, limit.Window).
+			WithAlgorithm(algorithm).
+			WithClientKey(key).
+			WithFailurePolicy(policy).
+			Middleware()
+		limiters.apiKeys[tier] = middleware.NewTierRateLimiter(redisClient, tier, limit.Requests, limit.Window).
+			WithAlgorithm(algorithm).
+			WithClientKey(middleware.KeyByAPIKey).
+			WithFailurePolicy(policy).
+			Middleware()
+	}
+	return limiters
+}
+
+// forRoute limits requests once they have been authenticated. API key clients
+// are limited per key with the tier of their key. Users whose role is listed in
+// role_rate_limits get that role's tier on auth routes that use the default tier.
+// Everyone else is limited with the route's tier.
+func (l *rateLimiters) forRoute(route RouteConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := l.pick(c, route)
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		limiter(c)
+	}
+}
+
+func (l *rateLimiters) pick(c *gin.Context, route RouteConfig) gin.HandlerFunc {
+	if middleware.ClientID(c) != "" {
+		if limiter, ok := l.apiKeys[c.GetString("api_key_tier")]; ok {
+			return limiter
+		}
+		return l.apiKeys[defaultRateLimitTier]
+	}
+	if route.RateLimit == defaultRateLimitTier && middleware.UserID(c) != "" {
+		if tier, ok := l.roles[middleware.UserRole(c)]; ok {
+			return l.tiers[tier]
+		}
+	}
+	return l.tiers[route.RateLimit]
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"e-commerce-platform/pkg/tracing"
+)
+
+const (
+	// maxRetryBodyBytes is the largest request body buffered for replay. Larger
+	// requests are proxied once without retries.
+	maxRetryBodyBytes = 1 << 20
+
+	retryBackoffBase = 25 * time.Millisecond
+	retryBackoffMax  = 250 * time.Millisecond
+
+	// retryBudgetReserve is the number of retries an upstream may spend before
+	// the budget has to be earned by regular traffic
+	retryBudgetReserve = 10
+)
+
+// retryPolicy is the retry configuration of one route
+type retryPolicy struct {
+	retries       int
+	perTryTimeout time.Duration
+}
+
+// retryableRequest reports whether a request may be sent more than once.
+// Only idempotent methods qualify, unless the client supplied an Idempotency-Key.
+func retryableRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// bufferBody reads the request body into memory so it can be replayed on retry.
+// It reports false, leaving the body readable, when the body is too large.
+func bufferBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.ContentLength > maxRetryBodyBytes {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxRetryBodyBytes+1))
+	if err != nil || len(body) > maxRetryBodyBytes {
+		req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+		return nil, false
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// retryBudget caps retries to a share of the requests sent to an upstream, so
+// that retries cannot multiply the load on a service that is already failing
+type retryBudget struct {
+	ratio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// newRetryBudget allows retries for up to percent of an upstream's requests
+func newRetryBudget(percent int) *retryBudget {
+	return &retryBudget{
+		ratio:  float64(percent) / 100,
+		tokens: retryBudgetReserve,
+	}
+}
+
+// deposit earns a fraction of a retry for every request sent
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetReserve {
+		b.tokens = retryBudgetReserve
+	}
+}
+
+// withdraw spends one retry, reporting false when the budget is exhausted
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryBackoff returns a full-jitter exponential backoff for the given retry
+func retryBackoff(retry int) time.Duration {
+	backoff := retryBackoffBase << retry
+	if backoff > retryBackoffMax || backoff <= 0 {
+		backoff = retryBackoffMax
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
+
+// retryTransport sends the proxied request to the instance chosen for it and,
+// when the route allows it, retries failed attempts against another instance.
+// The reverse proxy only writes to the client once RoundTrip returns, so a
+// failed attempt never reaches the client.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := req.Context().Value(proxyTargetKey{}).(*proxyTarget)
+	up := target.upstream
+
+	for {
+		resp, err := t.attempt(req, target)
+		target.complete(resp, err)
+		if !target.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		candidates := up.health.available(target.untried())
+		if len(candidates) == 0 || !up.budget.withdraw() {
+			return resp, err
+		}
+
+		timer := time.NewTimer(retryBackoff(target.retries))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C:
+		}
+
+		instance, finish, acquireErr := up.acquire(candidates)
+		if acquireErr != nil {
+			return resp, err
+		}
+
+		log.Printf("Retrying %s %s on %s (retry %d of %d): %s",
+			req.Method, req.URL.Path, instance.Host(), target.retries+1, target.policy.retries, attemptError(resp, err))
+		upstreamRetries.WithLabelValues(up.name).Inc()
+		if resp != nil {
+			resp.Body.Close()
+		}
+		target.instance = instance
+		target.finish = finish
+		target.tried = append(target.tried, instance)
+		target.retries++
+	}
+}
+
+// attempt sends one copy of the request to the target's current instance
+func (t *retryTransport) attempt(req *http.Request, target *proxyTarget) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if target.policy.perTryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, target.policy.perTryTimeout)
+	}
+
+	// Every attempt is its own client span, so retries show up in the trace
+	ctx, span := tracing.Start(ctx, "proxy "+target.upstream.name, tracing.KindClient)
+	defer span.End()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("upstream.instance", target.instance.ID)
+	span.SetAttribute("upstream.retry", target.retries)
+
+	attemptReq := req.Clone(ctx)
+	attemptReq.URL.Host = target.instance.Host()
+	if target.retries > 0 && req.Body != nil {
+		attemptReq.Body = io.NopCloser(bytes.NewReader(target.body))
+	}
+	tracing.Inject(ctx, attemptReq.Header)
+
+	resp, err := t.base.RoundTrip(attemptReq)
+	if err != nil {
+		span.SetError(err)
+		cancel()
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(errors.New(resp.Status))
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the per-try timeout once the response has been read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func attemptError(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
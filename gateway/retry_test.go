@@ -0,0 +1,243 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingInstance is an upstream instance that counts its requests and
+// answers them with status, after delay
+type countingInstance struct {
+	status   int
+	delay    time.Duration
+	requests atomic.Int64
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (i *countingInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.requests.Add(1)
+	body, _ := io.ReadAll(r.Body)
+	i.mu.Lock()
+	i.bodies = append(i.bodies, string(body))
+	i.mu.Unlock()
+
+	select {
+	case <-time.After(i.delay):
+	case <-r.Context().Done():
+		return
+	}
+	w.WriteHeader(i.status)
+}
+
+// newRetryGateway serves every method on /products from the given instances of
+// product-service with policy
+func newRetryGateway(t *testing.T, policy retryPolicy, instances ...http.Handler) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	var discovered []registry.Instance
+	for _, instance := range instances {
+		discovered = append(discovered, testInstances(t, instance, 1)...)
+	}
+	gw := newTestGateway(t, map[string][]registry.Instance{"product-service": discovered})
+
+	r := gin.New()
+	r.Any("/products", proxyToService(gw, "product-service", "/products", policy))
+	return serveTestGateway(t, r).URL
+}
+
+// send sends a request with body to the gateway and returns the response status
+func send(t *testing.T, method, url, body string, header http.Header) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRetriesOnlyIdempotentRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		header   http.Header
+		attempts int64
+	}{
+		{"GET", http.MethodGet, nil, 2},
+		{"PUT", http.MethodPut, nil, 2},
+		{"POST", http.MethodPost, nil, 1},
+		{"PATCH", http.MethodPatch, nil, 1},
+		{"POST with Idempotency-Key", http.MethodPost, http.Header{"Idempotency-Key": {"order-1"}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &countingInstance{status: http.StatusServiceUnavailable}
+			b := &countingInstance{status: http.StatusServiceUnavailable}
+			url := newRetryGateway(t, retryPolicy{retries: 3}, a, b)
+
+			if status := send(t, tt.method, url+"/products", `{"name":"lamp"}`, tt.header); status != http.StatusServiceUnavailable {
+				t.Errorf("status %d, want the upstream's %d", status, http.StatusServiceUnavailable)
+			}
+			// Retries never go back to an instance that was already tried
+			if got := a.requests.Load() + b.requests.Load(); got != tt.attempts {
+				t.Errorf("upstream received %d attempts, want %d", got, tt.attempts)
+			}
+			if tt.attempts > 1 && (a.requests.Load() != 1 || b.requests.Load() != 1) {
+				t.Errorf("instances received %d and %d attempts, want one each", a.requests.Load(), b.requests.Load())
+			}
+			// Every attempt carries the whole body
+			for _, instance := range []*countingInstance{a, b} {
+				for _, body := range instance.bodies {
+					if body != `{"name":"lamp"}` {
+						t.Errorf("attempt carried body %q", body)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRetriesOnlyOnGatewayErrors(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int64
+	}{
+		{http.StatusOK, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusTooManyRequests, 1},
+		{http.StatusInternalServerError, 1},
+		{http.StatusNotImplemented, 1},
+		{http.StatusBadGateway, 2},
+		{http.StatusServiceUnavailable, 2},
+		{http.StatusGatewayTimeout, 2},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			a := &countingInstance{status: tt.status}
+			b := &countingInstance{status: tt.status}
+			url := newRetryGateway(t, retryPolicy{retries: 1}, a, b)
+
+			if status := send(t, http.MethodGet, url+"/products", "", nil); status != tt.status {
+				t.Errorf("status %d, want %d", status, tt.status)
+			}
+			if got := a.requests.Load() + b.requests.Load(); got != tt.attempts {
+				t.Errorf("upstream received %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetriesConnectErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	healthy := &countingInstance{status: http.StatusOK}
+	up := testInstances(t, healthy, 1)
+
+	// An instance that refuses connections
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(closed.URL, "http://"))
+	portNumber, _ := strconv.Atoi(port)
+	down := []registry.Instance{{Address: host, Port: portNumber}}
+
+	gw := newTestGateway(t, map[string][]registry.Instance{"product-service": append(down, up...)})
+	r := gin.New()
+	r.GET("/products", proxyToService(gw, "product-service", "/products", retryPolicy{retries: 1}))
+	url := serveTestGateway(t, r).URL
+
+	// Round robin sends one of the two requests to the closed instance first
+	for i := 0; i < 2; i++ {
+		if status := send(t, http.MethodGet, url+"/products", "", nil); status != http.StatusOK {
+			t.Errorf("request %d: status %d, want the retry on the healthy instance to answer", i, status)
+		}
+	}
+	if got := healthy.requests.Load(); got != 2 {
+		t.Errorf("healthy instance received %d requests, want 2", got)
+	}
+}
+
+func TestPerTryTimeout(t *testing.T) {
+	hung := &countingInstance{status: http.StatusOK, delay: time.Second}
+	healthy := &countingInstance{status: http.StatusOK}
+	url := newRetryGateway(t, retryPolicy{retries: 1, perTryTimeout: 50 * time.Millisecond}, hung, healthy)
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if status := send(t, http.MethodGet, url+"/products", "", nil); status != http.StatusOK {
+			t.Errorf("request %d: status %d, want %d", i, status, http.StatusOK)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("request %d took %s, want the hung attempt abandoned after the per-try timeout", i, elapsed)
+		}
+	}
+	// Every request ends on the healthy instance, whether or not it was tried first
+	if hung.requests.Load() == 0 || healthy.requests.Load() != 2 {
+		t.Errorf("hung and healthy instance received %d and %d requests, want at least 1 and 2", hung.requests.Load(), healthy.requests.Load())
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	// Failures must not open breakers or eject instances before the budget runs out
+	t.Setenv("CB_FAILURE_THRESHOLD_PRODUCT_SERVICE", "1000")
+	t.Setenv("CB_SERVICE_FAILURE_THRESHOLD_PRODUCT_SERVICE", "1000")
+	t.Setenv("OUTLIER_MIN_REQUESTS_PRODUCT_SERVICE", "1000")
+	t.Setenv("RETRY_BUDGET_PERCENT_PRODUCT_SERVICE", "1")
+
+	a := &countingInstance{status: http.StatusServiceUnavailable}
+	b := &countingInstance{status: http.StatusServiceUnavailable}
+	url := newRetryGateway(t, retryPolicy{retries: 1}, a, b)
+
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		send(t, http.MethodGet, url+"/products", "", nil)
+	}
+
+	// The reserve pays for the first retries, and 1% of 20 requests earns none back
+	retries := a.requests.Load() + b.requests.Load() - requests
+	if retries != retryBudgetReserve {
+		t.Errorf("%d requests were retried, want the reserve of %d", retries, retryBudgetReserve)
+	}
+}
+
+func TestRetryBudgetRefills(t *testing.T) {
+	budget := newRetryBudget(50)
+	for i := 0; i < retryBudgetReserve; i++ {
+		if !budget.withdraw() {
+			t.Fatalf("retry %d was refused within the reserve", i+1)
+		}
+	}
+	if budget.withdraw() {
+		t.Fatal("retry allowed beyond the reserve")
+	}
+
+	// Two requests at 50% earn one retry
+	budget.deposit()
+	if budget.withdraw() {
+		t.Error("retry allowed after earning half of one")
+	}
+	budget.deposit()
+	budget.deposit()
+	if !budget.withdraw() {
+		t.Error("retry refused after earning one")
+	}
+}
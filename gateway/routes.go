@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultRouteTimeout   = 30 * time.Second
+	maxRouteTimeout       = 60 * time.Second
+	defaultRouteRetries   = 2
+	maxRouteRetries       = 5
+	defaultRateLimitTier  = "default"
+	routesPollInterval    = 2 * time.Second
+	defaultRoutesFilePath = "routes.yaml"
+)
+
+// RouteConfig describes one public gateway route and where it is proxied to.
+// Routes with a handler are served by a composition handler of the gateway
+// instead of being proxied to a single service.
+type RouteConfig struct {
+	Method        string        `yaml:"method" json:"method"`
+	Path          string        `yaml:"path" json:"path"`
+	Summary       string        `yaml:"summary" json:"summary,omitempty"`
+	Service       string        `yaml:"service" json:"service,omitempty"`
+	UpstreamPath  string        `yaml:"upstream_path" json:"upstream_path,omitempty"`
+	Handler       string        `yaml:"handler" json:"handler,omitempty"`
+	Auth          bool          `yaml:"auth" json:"auth"`
+	Timeout       time.Duration `yaml:"timeout" json:"timeout"`
+	Retries       *int          `yaml:"retries" json:"retries"`
+	PerTryTimeout time.Duration `yaml:"per_try_timeout" json:"per_try_timeout,omitempty"`
+	RateLimit     string        `yaml:"rate_limit" json:"rate_limit"`
+	ValidateID    string        `yaml:"validate_id" json:"validate_id,omitempty"`
+	Cache         *CacheConfig  `yaml:"cache" json:"cache,omitempty"`
+	Invalidates   []string      `yaml:"invalidates" json:"invalidates,omitempty"`
+	Scopes        []string      `yaml:"scopes" json:"scopes,omitempty"`
+	RequestBody   string        `yaml:"request_body" json:"request_body,omitempty"`
+}
+
+// RateLimitConfig is the quota of a rate-limit tier, the algorithm that
+// enforces it, what requests are counted by and what to do without Redis
+type RateLimitConfig struct {
+	Requests      int           `yaml:"requests" json:"requests"`
+	Window        time.Duration `yaml:"window" json:"window"`
+	Algorithm     string        `yaml:"algorithm" json:"algorithm,omitempty"`
+	Key           string        `yaml:"key" json:"key,omitempty"`
+	FailurePolicy string        `yaml:"failure_policy" json:"failure_policy,omitempty"`
+}
+
+// RouteTable is the declarative routing configuration of the gateway. It is
+// read from YAML, and since JSON is valid YAML a .json file works as well.
+type RouteTable struct {
+	DefaultTimeout time.Duration `yaml:"default_timeout" json:"default_timeout"`
+	DefaultRetries *int          `yaml:"default_retries" json:"default_retries"`
+	// ValidateRequests checks request bodies against the route's request_body schema before proxying
+	ValidateRequests bool                       `yaml:"validate_requests" json:"validate_requests"`
+	RateLimits       map[string]RateLimitConfig `yaml:"rate_limits" json:"rate_limits"`
+	// RoleRateLimits maps user roles to the tier their requests are limited with
+	// on auth routes that use the default tier
+	RoleRateLimits map[string]string `yaml:"role_rate_limits" json:"role_rate_limits,omitempty"`
+	// Canaries splits the traffic of a service between its versions by Consul tag
+	Canaries map[string][]CanaryConfig `yaml:"canaries" json:"canaries,omitempty"`
+	Routes   []RouteConfig             `yaml:"routes" json:"routes"`
+}
+
+var routeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// LoadRouteTable reads, defaults and validates a route table file
+func LoadRouteTable(path string) (*RouteTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read route table: %w", err)
+	}
+
+	var table RouteTable
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&table); err != nil {
+		return nil, fmt.Errorf("failed to parse route table %s: %w", path, err)
+	}
+
+	if table.DefaultTimeout == 0 {
+		table.DefaultTimeout = defaultRouteTimeout
+	}
+	if table.DefaultRetries == nil {
+		retries := defaultRouteRetries
+		table.DefaultRetries = &retries
+	}
+	for i := range table.Routes {
+		route := &table.Routes[i]
+		route.Method = strings.ToUpper(route.Method)
+		if route.Timeout == 0 {
+			route.Timeout = table.DefaultTimeout
+		}
+		if route.Retries == nil {
+			route.Retries = table.DefaultRetries
+		}
+		if route.RateLimit == "" {
+			route.RateLimit = defaultRateLimitTier
+		}
+		if route.Cache != nil && route.Cache.Group == "" {
+			route.Cache.Group = route.Service
+		}
+	}
+
+	if err := table.validate(); err != nil {
+		return nil, fmt.Errorf("invalid route table %s: %w", path, err)
+	}
+	return &table, nil
+}
+
+func (t *RouteTable) validate() error {
+	if len(t.Routes) == 0 {
+		return fmt.Errorf("no routes defined")
+	}
+	for tier, limit := range t.RateLimits {
+		if limit.Requests < 1 || limit.Window <= 0 {
+			return fmt.Errorf("rate limit tier %q needs positive requests and window", tier)
+		}
+		if _, err := middleware.ParseAlgorithm(limit.Algorithm); err != nil {
+			return fmt.Errorf("rate limit tier %q: %w", tier, err)
+		}
+		if _, err := middleware.ParseKey(limit.Key); err != nil {
+			return fmt.Errorf("rate limit tier %q: %w", tier, err)
+		}
+		if _, err := middleware.ParseFailurePolicy(limit.FailurePolicy); err != nil {
+			return fmt.Errorf("rate limit tier %q: %w", tier, err)
+		}
+	}
+	for role, tier := range t.RoleRateLimits {
+		if _, ok := t.RateLimits[tier]; !ok {
+			return fmt.Errorf("role_rate_limits: unknown rate limit tier %q for role %q", tier, role)
+		}
+	}
+
+	seen := make(map[string]bool, len(t.Routes))
+	for i, route := range t.Routes {
+		name := fmt.Sprintf("route %d (%s %s)", i, route.Method, route.Path)
+		if !routeMethods[route.Method] {
+			return fmt.Errorf("%s: unsupported method", name)
+		}
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("%s: path must start with /", name)
+		}
+		if route.Handler != "" {
+			if _, ok := composeHandlers[route.Handler]; !ok {
+				return fmt.Errorf("%s: unknown handler %q", name, route.Handler)
+			}
+			// Only the listed upstreams are configured for the handler
+			if len(composeUpstreams[route.Handler]) == 0 {
+				return fmt.Errorf("%s: handler %q lists no upstreams", name, route.Handler)
+			}
+			if route.Service != "" || route.UpstreamPath != "" {
+				return fmt.Errorf("%s: handler cannot be combined with service or upstream_path", name)
+			}
+		} else {
+			if route.Service == "" {
+				return fmt.Errorf("%s: service is required", name)
+			}
+			if !strings.HasPrefix(route.UpstreamPath, "/") {
+				return fmt.Errorf("%s: upstream_path must start with /", name)
+			}
+		}
+		if route.Timeout < 0 || route.Timeout > maxRouteTimeout {
+			return fmt.Errorf("%s: timeout must be between 0 and %s", name, maxRouteTimeout)
+		}
+		if *route.Retries < 0 || *route.Retries > maxRouteRetries {
+			return fmt.Errorf("%s: retries must be between 0 and %d", name, maxRouteRetries)
+		}
+		if route.PerTryTimeout < 0 || route.PerTryTimeout > route.Timeout {
+			return fmt.Errorf("%s: per_try_timeout must be positive and not exceed timeout", name)
+		}
+		if route.Cache != nil {
+			if route.Method != http.MethodGet {
+				return fmt.Errorf("%s: cache is only supported on GET routes", name)
+			}
+			if route.Auth {
+				return fmt.Errorf("%s: cache is not supported on routes that require auth", name)
+			}
+			if route.Cache.TTL <= 0 || route.Cache.TTL > maxCacheTTL {
+				return fmt.Errorf("%s: cache ttl must be between 0 and %s", name, maxCacheTTL)
+			}
+			if route.Cache.Group == "" {
+				return fmt.Errorf("%s: cache group is required", name)
+			}
+		}
+		if route.RequestBody != "" {
+			if _, ok := requestSchemas[route.RequestBody]; !ok {
+				return fmt.Errorf("%s: unknown request_body schema %q", name, route.RequestBody)
+			}
+			if route.Method != http.MethodPost && route.Method != http.MethodPut && route.Method != http.MethodPatch {
+				return fmt.Errorf("%s: request_body is only supported on POST, PUT and PATCH routes", name)
+			}
+		}
+		for _, scope := range route.Scopes {
+			if !scopePattern.MatchString(scope) {
+				return fmt.Errorf("%s: scope %q must look like resource:read or resource:write", name, scope)
+			}
+		}
+		for _, group := range route.Invalidates {
+			if group == "" {
+				return fmt.Errorf("%s: invalidates contains an empty group", name)
+			}
+		}
+		if _, ok := t.RateLimits[route.RateLimit]; !ok && route.RateLimit != defaultRateLimitTier {
+			return fmt.Errorf("%s: unknown rate limit tier %q", name, route.RateLimit)
+		}
+
+		params := pathParams(route.Path)
+		for param := range pathParams(route.UpstreamPath) {
+			if !params[param] {
+				return fmt.Errorf("%s: upstream_path uses :%s which is not in path", name, param)
+			}
+		}
+		if route.ValidateID != "" && !params["id"] {
+			return fmt.Errorf("%s: validate_id requires an :id parameter", name)
+		}
+
+		key := route.Method + " " + route.Path
+		if seen[key] {
+			return fmt.Errorf("%s: duplicate route", name)
+		}
+		seen[key] = true
+	}
+
+	// Canaries can only split the traffic of an upstream the routes configure
+	services := make(map[string]bool)
+	for _, service := range t.Upstreams() {
+		services[service] = true
+	}
+	for service, canaries := range t.Canaries {
+		if !services[service] {
+			return fmt.Errorf("canaries of %s: no route uses this service", service)
+		}
+		if err := validateCanaries(service, canaries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathParams returns the names of the :param and *param segments of a path
+func pathParams(path string) map[string]bool {
+	params := make(map[string]bool)
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			params[segment[1:]] = true
+		}
+	}
+	return params
+}
+
+// Upstreams returns the services the routes of the table call, sorted
+func (t *RouteTable) Upstreams() []string {
+	services := make(map[string]bool)
+	for _, route := range t.Routes {
+		if route.Handler != "" {
+			for _, service := range composeUpstreams[route.Handler] {
+				services[service] = true
+			}
+		} else {
+			services[route.Service] = true
+		}
+	}
+	names := make([]string, 0, len(services))
+	for service := range services {
+		names = append(names, service)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registerRoutes wires every route of the table onto the router
+func registerRoutes(r gin.IRouter, gw *Gateway, table *RouteTable, auth gin.HandlerFunc, keys *APIKeyStore, redisClient *redis.Client, cache *ResponseCache) (err error) {
+	// Gin panics on conflicting routes, report them as a load error instead
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("failed to register routes: %v", recovered)
+		}
+	}()
+
+	// Breaker, retry and balancing settings of every upstream are checked up front
+	if err := gw.Configure(table.Upstreams()); err != nil {
+		return err
+	}
+
+	limiters := newRateLimiters(redisClient, table)
+
+	for _, route := range table.Routes {
+		handlers := []gin.HandlerFunc{
+			authenticate(auth, keys, route),
+			limiters.forRoute(route),
+		}
+		if route.ValidateID != "" {
+			handlers = append(handlers, validateUUID(route.ValidateID))
+		}
+		if table.ValidateRequests && route.RequestBody != "" {
+			handlers = append(handlers, validateBody(route.RequestBody))
+		}
+		policy := retryPolicy{
+			retries:       *route.Retries,
+			perTryTimeout: route.PerTryTimeout,
+		}
+		if len(route.Invalidates) > 0 {
+			handlers = append(handlers, cache.Invalidate(route.Invalidates))
+		}
+		if route.Cache != nil {
+			handlers = append(handlers, cache.Middleware(route.Service, *route.Cache))
+		}
+		handlers = append(handlers, withTimeout(route.Timeout))
+		if route.Handler != "" {
+			handlers = append(handlers, composeHandlers[route.Handler](gw, policy))
+		} else {
+			handlers = append(handlers, proxyToService(gw, route.Service, route.UpstreamPath, policy))
+		}
+		r.Handle(route.Method, route.Path, handlers...)
+	}
+	return nil
+}
+
+// withTimeout bounds how long a route may wait for its upstream
+func withTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// RouteManager serves requests with the router built from the current route
+// table and swaps in a new router when the table is reloaded. Requests already
+// in flight finish on the router they started on.
+type RouteManager struct {
+	path  string
+	build func(*RouteTable) (*gin.Engine, error)
+
+	engine atomic.Pointer[gin.Engine]
+
+	mu       sync.Mutex
+	table    *RouteTable
+	loadedAt time.Time
+	modTime  time.Time
+	size     int64
+}
+
+// NewRouteManager loads the route table at path and builds the first router
+func NewRouteManager(path string, build func(*RouteTable) (*gin.Engine, error)) (*RouteManager, error) {
+	m := &RouteManager{path: path, build: build}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ServeHTTP dispatches the request to the current router
+func (m *RouteManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.engine.Load().ServeHTTP(w, r)
+}
+
+// Reload re-reads the route table. If it is invalid the current router is kept.
+func (m *RouteManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat route table: %w", err)
+	}
+
+	table, err := LoadRouteTable(m.path)
+	if err != nil {
+		return err
+	}
+	engine, err := m.build(table)
+	if err != nil {
+		return err
+	}
+
+	m.engine.Store(engine)
+	m.table = table
+	m.loadedAt = time.Now()
+	m.modTime = info.ModTime()
+	m.size = info.Size()
+	log.Printf("Loaded %d routes from %s", len(table.Routes), m.path)
+	return nil
+}
+
+// changed reports whether the route table file differs from the loaded one
+func (m *RouteManager) changed() bool {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !info.ModTime().Equal(m.modTime) || info.Size() != m.size
+}
+
+// Watch reloads the route table on SIGHUP or when the file changes, until ctx is cancelled
+func (m *RouteManager) Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(routesPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("Received SIGHUP, reloading routes from %s", m.path)
+		case <-ticker.C:
+			if !m.changed() {
+				continue
+			}
+			log.Printf("Route table %s changed, reloading", m.path)
+		}
+
+		if err := m.Reload(); err != nil {
+			log.Printf("Failed to reload routes, keeping current table: %v", err)
+			// Do not retry the same broken file on every tick
+			if info, statErr := os.Stat(m.path); statErr == nil {
+				m.mu.Lock()
+				m.modTime = info.ModTime()
+				m.size = info.Size()
+				m.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Status describes the loaded route table for the admin endpoint
+func (m *RouteManager) Status() gin.H {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return gin.H{
+		"file":      m.path,
+		"loaded_at": m.loadedAt,
+		"table":     m.table,
+	}
+}
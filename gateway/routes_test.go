@@ -0,0 +1,222 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/registry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeRouteTable writes a route table file into the test's directory
+func writeRouteTable(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const productRoutes = `
+default_timeout: 10s
+routes:
+  - method: get
+    path: /api/v1/products
+    service: product-service
+    upstream_path: /api/v1/products
+    cache:
+      ttl: 1m
+  - method: POST
+    path: /api/v1/orders
+    service: order-service
+    upstream_path: /api/v1/orders
+    retries: 0
+    rate_limit: strict
+rate_limits:
+  strict:
+    requests: 10
+    window: 1m
+`
+
+func TestLoadRouteTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", productRoutes, ""},
+		{"unknown field", "routes:\n  - method: GET\n    path: /a\n    service: a\n    upstream_path: /a\n    retry: 1\n", "field retry not found"},
+		{"invalid", "routes: []\n", "no routes defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "routes.yaml")
+			writeRouteTable(t, path, tt.content)
+
+			table, err := LoadRouteTable(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			products, orders := table.Routes[0], table.Routes[1]
+			if products.Method != http.MethodGet {
+				t.Errorf("method %q, want it uppercased", products.Method)
+			}
+			if products.Timeout != 10*time.Second || *products.Retries != defaultRouteRetries {
+				t.Errorf("timeout %s and retries %d, want the table defaults", products.Timeout, *products.Retries)
+			}
+			if products.RateLimit != defaultRateLimitTier {
+				t.Errorf("rate limit %q, want %q", products.RateLimit, defaultRateLimitTier)
+			}
+			if products.Cache.Group != "product-service" {
+				t.Errorf("cache group %q, want the service", products.Cache.Group)
+			}
+			if *orders.Retries != 0 || orders.RateLimit != "strict" {
+				t.Errorf("retries %d and rate limit %q, want the route's own", *orders.Retries, orders.RateLimit)
+			}
+		})
+	}
+}
+
+func TestRouteTableValidate(t *testing.T) {
+	retries, tooMany := 1, maxRouteRetries+1
+	proxied := func(modify func(*RouteConfig)) RouteConfig {
+		route := RouteConfig{
+			Method:       http.MethodGet,
+			Path:         "/api/v1/products/:id",
+			Service:      "product-service",
+			UpstreamPath: "/api/v1/products/:id",
+			Timeout:      time.Second,
+			Retries:      &retries,
+			RateLimit:    defaultRateLimitTier,
+		}
+		if modify != nil {
+			modify(&route)
+		}
+		return route
+	}
+	details := RouteConfig{
+		Method:    http.MethodGet,
+		Path:      "/api/v1/orders/:id/details",
+		Handler:   "order_details",
+		Timeout:   time.Second,
+		Retries:   &retries,
+		RateLimit: defaultRateLimitTier,
+	}
+
+	tests := []struct {
+		name     string
+		routes   []RouteConfig
+		canaries map[string][]CanaryConfig
+		wantErr  string
+	}{
+		{"valid", []RouteConfig{proxied(nil), details}, nil, ""},
+		{"no routes", nil, nil, "no routes defined"},
+		{"unsupported method", []RouteConfig{proxied(func(r *RouteConfig) { r.Method = "TRACE" })}, nil, "unsupported method"},
+		{"relative path", []RouteConfig{proxied(func(r *RouteConfig) { r.Path = "products" })}, nil, "path must start with /"},
+		{"missing service", []RouteConfig{proxied(func(r *RouteConfig) { r.Service = "" })}, nil, "service is required"},
+		{"unknown handler", []RouteConfig{{Method: http.MethodGet, Path: "/x", Handler: "missing", Timeout: time.Second, Retries: &retries}}, nil, "unknown handler"},
+		{"handler with service", []RouteConfig{proxied(func(r *RouteConfig) { r.Handler = "order_details" })}, nil, "cannot be combined"},
+		{"too many retries", []RouteConfig{proxied(func(r *RouteConfig) { r.Retries = &tooMany })}, nil, "retries must be between"},
+		{"per try timeout above timeout", []RouteConfig{proxied(func(r *RouteConfig) { r.PerTryTimeout = 2 * time.Second })}, nil, "per_try_timeout"},
+		{"unknown path parameter", []RouteConfig{proxied(func(r *RouteConfig) { r.UpstreamPath = "/api/v1/products/:sku" })}, nil, "uses :sku"},
+		{"unknown rate limit tier", []RouteConfig{proxied(func(r *RouteConfig) { r.RateLimit = "missing" })}, nil, "unknown rate limit tier"},
+		{"duplicate route", []RouteConfig{proxied(nil), proxied(nil)}, nil, "duplicate route"},
+		{"canary of a composed upstream", []RouteConfig{details}, map[string][]CanaryConfig{"payment-service": {{Tag: "v2", Weight: 10}}}, ""},
+		{"canary of an unrouted service", []RouteConfig{proxied(nil)}, map[string][]CanaryConfig{"user-service": {{Tag: "v2", Weight: 10}}}, "no route uses this service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := RouteTable{Routes: tt.routes, Canaries: tt.canaries}
+			err := table.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailedReloadKeepsTheCurrentTable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	writeRouteTable(t, path, productRoutes)
+
+	// Routes answer with their upstream path; building fails for invalid upstream settings
+	gw := newTestGateway(t, nil)
+	build := func(table *RouteTable) (*gin.Engine, error) {
+		if err := gw.Configure(table.Upstreams()); err != nil {
+			return nil, err
+		}
+		r := gin.New()
+		for _, route := range table.Routes {
+			r.Handle(route.Method, route.Path, func(c *gin.Context) { c.String(http.StatusOK, route.UpstreamPath) })
+		}
+		return r, nil
+	}
+	routes, err := NewRouteManager(path, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		env     map[string]string
+	}{
+		{"invalid table", "routes: []\n", nil},
+		{"invalid upstream settings", strings.ReplaceAll(productRoutes, "product-service", "catalog-service"), map[string]string{"LB_STRATEGY_CATALOG_SERVICE": "random"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			writeRouteTable(t, path, tt.content)
+			if err := routes.Reload(); err == nil {
+				t.Fatal("reload succeeded, want an error")
+			}
+
+			rec := httptest.NewRecorder()
+			routes.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/products", nil))
+			if rec.Code != http.StatusOK || rec.Body.String() != "/api/v1/products" {
+				t.Errorf("got %d %q, want the route of the previous table", rec.Code, rec.Body.String())
+			}
+			if table := routes.Status()["table"].(*RouteTable); len(table.Routes) != 2 {
+				t.Errorf("status reports %d routes, want the 2 of the previous table", len(table.Routes))
+			}
+		})
+	}
+}
+
+func TestUnconfiguredUpstreamIsBadGateway(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gw := newTestGateway(t, map[string][]registry.Instance{
+		"product-service": testInstances(t, http.NotFoundHandler(), 1),
+	})
+
+	r := gin.New()
+	r.GET("/users", proxyToService(gw, "user-service", "/users", retryPolicy{}))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), "UPSTREAM_NOT_CONFIGURED") {
+		t.Errorf("got %d %s, want 502 UPSTREAM_NOT_CONFIGURED", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"e-commerce-platform/pkg/registry"
+	"e-commerce-platform/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// callerTraceparent is the trace context sent by the client in these tests
+const callerTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// upstreamRecorder is a stand-in upstream that records the traceparent of every
+// request it receives. It answers the requests listed in fail with a 503.
+type upstreamRecorder struct {
+	mu           sync.Mutex
+	traceparents []string
+	fail         map[int]bool
+}
+
+func (u *upstreamRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	u.traceparents = append(u.traceparents, r.Header.Get(tracing.HeaderTraceparent))
+	fail := u.fail[len(u.traceparents)]
+	u.mu.Unlock()
+
+	if fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (u *upstreamRecorder) received() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.traceparents...)
+}
+
+// newTracedGateway serves GET /products from instances copies of upstream,
+// registered as product-service, with spans recorded by the returned exporter
+func newTracedGateway(t *testing.T, upstream http.Handler, instances int, policy retryPolicy) (*httptest.Server, *tracing.InMemoryExporter) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	gw := newTestGateway(t, map[string][]registry.Instance{
+		"product-service": testInstances(t, upstream, instances),
+	})
+
+	exporter := tracing.NewInMemoryExporter()
+	tracing.Init("gateway", exporter)
+	t.Cleanup(func() { tracing.Init("gateway", nil) })
+
+	r := gin.New()
+	r.Use(tracing.Middleware())
+	r.GET("/products", proxyToService(gw, "product-service", "/products", policy))
+	return serveTestGateway(t, r), exporter
+}
+
+// getProducts sends GET /products to the gateway as a caller in the middle of a trace
+func getProducts(t *testing.T, gateway *httptest.Server) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/products", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(tracing.HeaderTraceparent, callerTraceparent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	return resp
+}
+
+// spansOfKind returns the recorded spans of one kind, oldest first
+func spansOfKind(spans []*tracing.Span, kind string) []*tracing.Span {
+	var matching []*tracing.Span
+	for _, span := range spans {
+		if span.Kind == kind {
+			matching = append(matching, span)
+		}
+	}
+	return matching
+}
+
+func TestProxyPropagatesTraceparent(t *testing.T) {
+	upstream := &upstreamRecorder{}
+	gateway, exporter := newTracedGateway(t, upstream, 1, retryPolicy{})
+	caller, _ := tracing.ParseTraceparent(callerTraceparent)
+	resp := getProducts(t, gateway)
+
+	spans := exporter.Spans()
+	servers, clients := spansOfKind(spans, tracing.KindServer), spansOfKind(spans, tracing.KindClient)
+	if len(servers) != 1 || len(clients) != 1 {
+		t.Fatalf("recorded %d server and %d client spans, want 1 of each", len(servers), len(clients))
+	}
+	server, client := servers[0], clients[0]
+
+	if server.TraceID != caller.TraceID || server.ParentSpanID != caller.SpanID {
+		t.Errorf("server span continues %s/%s, want the caller's %s/%s", server.TraceID, server.ParentSpanID, caller.TraceID, caller.SpanID)
+	}
+	if client.TraceID != caller.TraceID || client.ParentSpanID != server.SpanID {
+		t.Errorf("client span continues %s/%s, want %s/%s", client.TraceID, client.ParentSpanID, caller.TraceID, server.SpanID)
+	}
+
+	received := upstream.received()
+	if len(received) != 1 {
+		t.Fatalf("upstream received %d requests, want 1", len(received))
+	}
+	if want := client.Context().Traceparent(); received[0] != want {
+		t.Errorf("upstream received traceparent %q, want %q", received[0], want)
+	}
+	if got := resp.Header.Get(tracing.HeaderTraceparent); got != server.Context().Traceparent() {
+		t.Errorf("response traceparent %q, want %q", got, server.Context().Traceparent())
+	}
+}
+
+func TestRetryAttemptsAreSiblingSpans(t *testing.T) {
+	// The first attempt fails and is retried on the other instance
+	upstream := &upstreamRecorder{fail: map[int]bool{1: true}}
+	gateway, exporter := newTracedGateway(t, upstream, 2, retryPolicy{retries: 1})
+	getProducts(t, gateway)
+
+	spans := exporter.Spans()
+	servers, attempts := spansOfKind(spans, tracing.KindServer), spansOfKind(spans, tracing.KindClient)
+	if len(servers) != 1 || len(attempts) != 2 {
+		t.Fatalf("recorded %d server and %d attempt spans, want 1 and 2", len(servers), len(attempts))
+	}
+	server := servers[0]
+
+	received := upstream.received()
+	if len(received) != 2 {
+		t.Fatalf("upstream received %d requests, want 2", len(received))
+	}
+	wantStatus := []string{"error", "ok"}
+	for i, attempt := range attempts {
+		if attempt.TraceID != server.TraceID || attempt.ParentSpanID != server.SpanID {
+			t.Errorf("attempt %d is a child of %s/%s, want the server span %s/%s", i, attempt.TraceID, attempt.ParentSpanID, server.TraceID, server.SpanID)
+		}
+		if got := attempt.Attributes["upstream.retry"]; got != i {
+			t.Errorf("attempt %d has upstream.retry %v", i, got)
+		}
+		if attempt.Status != wantStatus[i] {
+			t.Errorf("attempt %d has status %s, want %s", i, attempt.Status, wantStatus[i])
+		}
+		if want := attempt.Context().Traceparent(); received[i] != want {
+			t.Errorf("attempt %d sent traceparent %q, want %q", i, received[i], want)
+		}
+	}
+	if attempts[0].Attributes["upstream.instance"] == attempts[1].Attributes["upstream.instance"] {
+		t.Error("the retry was sent to the instance that failed")
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"e-commerce-platform/pkg/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upstream holds the long-lived proxy and balancing state for one Consul service
+type upstream struct {
+	name     string
+	balancer Balancer
+	health   *healthTracker
+	budget   *retryBudget
+	versions *versionStats
+	proxy    *httputil.ReverseProxy
+}
+
+// proxyTarget carries the per-request routing decision into the shared proxy
+type proxyTarget struct {
+	upstream  *upstream
+	version   string
+	instances []*Instance
+	path      string
+	policy    retryPolicy
+	retryable bool
+	body      []byte
+
+	instance *Instance
+	finish   func(status int, err error)
+	tried    []*Instance
+	retries  int
+}
+
+// complete records the outcome of the current attempt against its instance
+func (t *proxyTarget) complete(resp *http.Response, err error) {
+	if t.finish == nil {
+		return
+	}
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	t.finish(status, err)
+	t.finish = nil
+	if breakerOutcome(status, err) != OutcomeIgnored {
+		t.upstream.versions.record(t.version, err != nil || status >= http.StatusInternalServerError)
+	}
+}
+
+// release frees the current instance without recording an outcome, in case
+// the proxy gave up before reaching the upstream
+func (t *proxyTarget) release() {
+	if t.finish != nil {
+		t.finish(0, context.Canceled)
+		t.finish = nil
+	}
+}
+
+// shouldRetry reports whether a failed attempt may be repeated on another instance
+func (t *proxyTarget) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if !t.retryable || t.retries >= t.policy.retries || req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// untried returns the discovered instances that no attempt has been sent to yet
+func (t *proxyTarget) untried() []*Instance {
+	remaining := t.instances
+	for _, instance := range t.tried {
+		remaining = removeInstance(remaining, instance)
+	}
+	return remaining
+}
+
+type proxyTargetKey struct{}
+
+// Gateway owns service discovery and the upstreams discovered through it
+type Gateway struct {
+	discovery *Discovery
+	transport http.RoundTripper
+
+	mu        sync.Mutex
+	upstreams map[string]*upstream
+	canaries  map[string][]CanaryConfig
+	// configs are the validated settings of the upstreams in the route table
+	configs map[string]UpstreamConfig
+}
+
+// NewGateway creates a gateway with a pooled transport shared by all upstreams
+func NewGateway(discovery *Discovery) *Gateway {
+	return &Gateway{
+		discovery: discovery,
+		transport: newUpstreamTransport(),
+		upstreams: make(map[string]*upstream),
+		configs:   make(map[string]UpstreamConfig),
+	}
+}
+
+// Configure loads and validates the settings of the given upstreams, so that
+// invalid values fail the route table load instead of being found on the
+// first request
+func (g *Gateway) Configure(services []string) error {
+	configs := make(map[string]UpstreamConfig, len(services))
+	var errs []error
+	for _, name := range services {
+		cfg, err := loadUpstreamConfig(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		configs[name] = cfg
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for name, cfg := range configs {
+		g.configs[name] = cfg
+	}
+	return nil
+}
+
+// newUpstreamTransport keeps enough idle connections around to reuse them across requests
+func newUpstreamTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          512,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// errUpstreamNotConfigured is returned for a service whose settings were not
+// loaded with the route table
+var errUpstreamNotConfigured = errors.New("upstream is not configured")
+
+// upstream returns the upstream for a service, creating it on first use.
+// Every upstream a route or compose handler uses is configured when the route
+// table loads, so errUpstreamNotConfigured points at a gap in that check.
+func (g *Gateway) upstream(serviceName string) (*upstream, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if up, ok := g.upstreams[serviceName]; ok {
+		return up, nil
+	}
+
+	cfg, ok := g.configs[serviceName]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", serviceName, errUpstreamNotConfigured)
+	}
+	// The strategy is one of the balancers, checked by its oneof tag
+	balancer, _ := newBalancer(cfg.Strategy)
+
+	up := &upstream{
+		name:     serviceName,
+		balancer: balancer,
+		health:   newHealthTracker(cfg.resilience()),
+		budget:   newRetryBudget(cfg.RetryBudgetPercent),
+		versions: newVersionStats(serviceName),
+		proxy:    g.newProxy(serviceName),
+	}
+	g.upstreams[serviceName] = up
+	return up, nil
+}
+
+// newProxy builds the reverse proxy for a service. The destination instance and
+// path are chosen per request and passed in through the request context.
+func (g *Gateway) newProxy(serviceName string) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Transport: &retryTransport{base: g.transport},
+		Director: func(req *http.Request) {
+			target := req.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			req.Header.Set("X-Forwarded-Host", req.Host)
+			req.URL.Scheme = "http"
+			req.URL.Host = target.instance.Host()
+			req.URL.Path = target.path
+			req.URL.RawPath = ""
+
+			log.Printf("Forwarding request %s to: %s %s", logging.RequestIDFromContext(req.Context()), req.Method, req.URL.String())
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Proxy error for %s: %v", serviceName, err)
+			if errors.Is(err, context.DeadlineExceeded) {
+				proxyErrors.WithLabelValues(serviceName, "timeout").Inc()
+				writeJSON(w, http.StatusGatewayTimeout, gin.H{
+					"error": "Upstream request timed out",
+					"code":  "UPSTREAM_TIMEOUT",
+				})
+				return
+			}
+			proxyErrors.WithLabelValues(serviceName, "connection").Inc()
+			writeJSON(w, http.StatusBadGateway, gin.H{
+				"error":   "Failed to proxy request",
+				"code":    "PROXY_ERROR",
+				"details": err.Error(),
+			})
+		},
+	}
+}
+
+// serviceName - consul service name
+// targetPath - path which will be forwarded to a service along with path parameters
+// policy - how failed attempts of retryable requests are retried
+func proxyToService(gw *Gateway, serviceName, targetPath string, policy retryPolicy) gin.HandlerFunc {
+	// Start watching the service as soon as a route references it
+	gw.discovery.Watch(serviceName)
+
+	return func(c *gin.Context) {
+		target, err := gw.newTarget(serviceName, buildTargetPath(c, targetPath), policy, canaryPin(c.Request))
+		if err != nil {
+			status, body := targetErrorResponse(err)
+			c.JSON(status, body)
+			return
+		}
+		defer target.release()
+
+		if policy.retries > 0 && retryableRequest(c.Request) {
+			target.body, target.retryable = bufferBody(c.Request)
+		}
+
+		ctx := context.WithValue(c.Request.Context(), proxyTargetKey{}, target)
+		target.upstream.proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+	}
+}
+
+// errNoInstances is returned when discovery knows no healthy instance of a service
+var errNoInstances = errors.New("no healthy instances")
+
+// newTarget resolves the instances of a service, picks the version that serves
+// the request and admits it to one of that version's instances through the
+// circuit breakers. Retries stay on the same version. The caller must release the target.
+func (g *Gateway) newTarget(serviceName, path string, policy retryPolicy, pin string) (*proxyTarget, error) {
+	up, err := g.upstream(serviceName)
+	if err != nil {
+		log.Printf("Cannot route to %s: %v", serviceName, err)
+		proxyErrors.WithLabelValues(serviceName, "not_configured").Inc()
+		return nil, err
+	}
+
+	instances, err := g.discovery.Instances(serviceName)
+	if err != nil {
+		log.Printf("Error discovering service: %v", err)
+		proxyErrors.WithLabelValues(serviceName, "discovery").Inc()
+		return nil, fmt.Errorf("failed to discover %s: %w", serviceName, err)
+	}
+
+	if len(instances) == 0 {
+		log.Printf("No healthy instances found for service: %s", serviceName)
+		proxyErrors.WithLabelValues(serviceName, "no_instances").Inc()
+		return nil, errNoInstances
+	}
+
+	up.health.prune(instances)
+	version, instances := selectVersion(instances, g.canariesOf(serviceName), pin)
+
+	instance, finish, err := up.acquire(instances)
+	if err != nil {
+		log.Printf("Circuit open for service %s: %v", serviceName, err)
+		proxyErrors.WithLabelValues(serviceName, "circuit_open").Inc()
+		return nil, err
+	}
+	up.budget.deposit()
+
+	return &proxyTarget{
+		upstream:  up,
+		version:   version,
+		instances: instances,
+		path:      path,
+		policy:    policy,
+		instance:  instance,
+		finish:    finish,
+		tried:     []*Instance{instance},
+	}, nil
+}
+
+// targetErrorResponse maps a newTarget error to the gateway's error response
+func targetErrorResponse(err error) (int, gin.H) {
+	switch {
+	case errors.Is(err, errNoInstances):
+		return http.StatusServiceUnavailable, gin.H{
+			"error": "Service unavailable",
+			"code":  "SERVICE_UNAVAILABLE",
+		}
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable, gin.H{
+			"error": "Service temporarily unavailable",
+			"code":  "CIRCUIT_OPEN",
+		}
+	case errors.Is(err, errUpstreamNotConfigured):
+		return http.StatusBadGateway, gin.H{
+			"error": "No upstream configured for the service",
+			"code":  "UPSTREAM_NOT_CONFIGURED",
+		}
+	default:
+		return http.StatusInternalServerError, gin.H{
+			"error": "Failed to discover service",
+			"code":  "SERVICE_DISCOVERY_ERROR",
+		}
+	}
+}
+
+// acquire admits a request through the service breaker and picks an instance
+// that is neither ejected nor behind an open breaker. finish must be called
+// with the upstream's response status or transport error once it has completed.
+func (up *upstream) acquire(instances []*Instance) (*Instance, func(status int, err error), error) {
+	candidates := up.health.available(instances)
+	if len(candidates) == 0 {
+		return nil, nil, ErrCircuitOpen
+	}
+
+	serviceDone, err := up.health.service.Acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for len(candidates) > 0 {
+		instance, release := up.balancer.Pick(candidates)
+		instanceDone, err := up.health.instance(instance.ID).breaker.Acquire()
+		if err != nil {
+			// Another request took the last half-open probe, try the others
+			release()
+			candidates = removeInstance(candidates, instance)
+			continue
+		}
+
+		upstreamSelections.WithLabelValues(up.name, instance.ID).Inc()
+		return instance, func(status int, err error) {
+			release()
+			outcome := breakerOutcome(status, err)
+			instanceDone(outcome)
+			serviceDone(outcome)
+			if outcome != OutcomeIgnored {
+				up.health.record(instance, len(instances), err != nil || status >= 500)
+			}
+		}, nil
+	}
+
+	serviceDone(OutcomeIgnored)
+	return nil, nil, ErrCircuitOpen
+}
+
+// breakerOutcome classifies a proxied request. Transport errors and the
+// gateway-style 502/503/504 statuses count against the breakers; a client
+// that went away says nothing about the upstream.
+func breakerOutcome(status int, err error) Outcome {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return OutcomeIgnored
+	case err != nil:
+		return OutcomeFailure
+	case status == http.StatusBadGateway,
+		status == http.StatusServiceUnavailable,
+		status == http.StatusGatewayTimeout:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+func removeInstance(instances []*Instance, removed *Instance) []*Instance {
+	remaining := make([]*Instance, 0, len(instances))
+	for _, instance := range instances {
+		if instance.ID != removed.ID {
+			remaining = append(remaining, instance)
+		}
+	}
+	return remaining
+}
+
+// BreakerStatus reports breaker and ejection state for every upstream in use
+func (g *Gateway) BreakerStatus() []UpstreamStatus {
+	g.mu.Lock()
+	upstreams := make(map[string]*upstream, len(g.upstreams))
+	names := make([]string, 0, len(g.upstreams))
+	for name, up := range g.upstreams {
+		upstreams[name] = up
+		names = append(names, name)
+	}
+	g.mu.Unlock()
+	sort.Strings(names)
+
+	statuses := make([]UpstreamStatus, 0, len(names))
+	for _, name := range names {
+		statuses = append(statuses, upstreams[name].health.status(name))
+	}
+	return statuses
+}
+
+// buildTargetPath fills the :param and *param placeholders of the upstream
+// path template with the values matched on the public path
+func buildTargetPath(c *gin.Context, targetPath string) string {
+	segments := strings.Split(targetPath, "/")
+	for i, segment := range segments {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			segments[i] = strings.TrimPrefix(c.Param(segment[1:]), "/")
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// writeJSON writes a JSON error body outside of a gin handler
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+// pkg/config/config.go
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"e-commerce-platform/pkg/logging"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Development is the APP_ENV under which insecure defaults are accepted. Any
+// other environment, including an unset APP_ENV, refuses them.
+const Development = "development"
+
+// sources are the places a value can come from, highest precedence first: the
+// environment, a NAME_FILE secret file, .env, then CONFIG_FILE
+type sources struct {
+	// dotenv holds the names whose value was set from .env
+	dotenv map[string]bool
+	// file holds the values of CONFIG_FILE by name
+	file     map[string]string
+	filePath string
+}
+
+var (
+	loadSources sync.Once
+	shared      *sources
+	sourcesErr  error
+)
+
+// getSources reads .env and CONFIG_FILE once per process
+func getSources() (*sources, error) {
+	loadSources.Do(func() {
+		shared, sourcesErr = readSources()
+	})
+	return shared, sourcesErr
+}
+
+func readSources() (*sources, error) {
+	src := &sources{dotenv: map[string]bool{}, file: map[string]string{}}
+
+	// .env is optional, containers get their environment from the orchestrator.
+	// Its values are exported for code that reads the environment directly, but
+	// never override variables that are already set.
+	dotenv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load .env: %w", err)
+	}
+	for name, value := range dotenv {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		os.Setenv(name, value)
+		src.dotenv[name] = true
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return src, nil
+	}
+	file, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	src.file, src.filePath = file, path
+	return src, nil
+}
+
+// readFile reads a YAML or JSON file of values keyed by variable name:
+//
+//	PORT: 8000
+//	DB_HOST: postgres
+//	SERVICE_TAGS: [order, api]
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch value := value.(type) {
+		case nil:
+			values[name] = ""
+		case map[string]any:
+			return nil, fmt.Errorf("config file %s: %s must be a value or a list, not a map", path, name)
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+// lookup returns the value of name and where it came from, or an empty origin
+// when it is not set anywhere
+func (s *sources) lookup(name string) (value, origin string, err error) {
+	fileName := name + "_FILE"
+	value, inEnv := os.LookupEnv(name)
+	path, hasFile := os.LookupEnv(fileName)
+	fromEnv := inEnv && !s.dotenv[name]
+	switch {
+	case fromEnv && hasFile && !s.dotenv[fileName]:
+		return "", "", fmt.Errorf("%s and %s are both set, set only one", name, fileName)
+	case fromEnv:
+		return value, "environment", nil
+	case hasFile:
+		// A secret file overrides a development value from .env
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read %s: %w", fileName, err)
+		}
+		// Secret files usually end with a newline
+		return strings.TrimRight(string(data), "\r\n"), "secret file " + path, nil
+	case inEnv:
+		return value, ".env", nil
+	}
+	if value, ok := s.file[name]; ok {
+		return value, "config file " + s.filePath, nil
+	}
+	return "", "", nil
+}
+
+// environment returns APP_ENV, which defaults to production
+func (s *sources) environment() (string, error) {
+	env, origin, err := s.lookup("APP_ENV")
+	if err != nil {
+		return "", err
+	}
+	if origin == "" || env == "" {
+		return "production", nil
+	}
+	return env, nil
+}
+
+// Load fills the fields of the struct dst points to from their sources.
+// Fields name their variable with an env tag; struct fields without one are
+// loaded recursively. A value is taken from, in order of precedence:
+//
+//   - the environment
+//   - the file named by NAME_FILE, e.g. DB_PASSWORD_FILE=/run/secrets/db
+//   - a .env file in the working directory
+//   - the YAML or JSON file named by CONFIG_FILE
+//   - the value the field already holds, then its default tag
+//
+// Setting both NAME and NAME_FILE in the environment is an error.
+// Further tags validate the result, and every invalid field is reported:
+//
+//	required:"true"     the value must not be empty or zero
+//	min:"1" max:"10"    bounds of numbers and durations
+//	oneof:"up check"    the allowed values of a string
+//	secret:"true"       redacted by Log
+//	insecure:"a,b"      values refused unless APP_ENV is development
+//
+// Supported types are strings, bools, integers, floats, time.Duration and
+// comma separated []string.
+func Load(dst any) error {
+	return load(dst, "")
+}
+
+// LoadFor loads dst like Load, but NAME_<SUFFIX> takes precedence over NAME
+// for every field, so settings can be overridden per instance of something,
+// e.g. LB_STRATEGY_ORDER_SERVICE over LB_STRATEGY with suffix ORDER_SERVICE
+func LoadFor(dst any, suffix string) error {
+	return load(dst, suffix)
+}
+
+func load(dst any, suffix string) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", dst)
+	}
+	src, err := getSources()
+	if err != nil {
+		return err
+	}
+	env, err := src.environment()
+	if err != nil {
+		return err
+	}
+	fields, err := fieldsOf(target.Elem())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, f := range fields {
+		value, origin, err := src.lookup(f.name)
+		if suffix != "" {
+			if specific, specificOrigin, specificErr := src.lookup(f.name + "_" + suffix); specificErr != nil || specificOrigin != "" {
+				f.name, value, origin, err = f.name+"_"+suffix, specific, specificOrigin, specificErr
+			}
+		}
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+			continue
+		case origin != "":
+			if err := parse(f.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s from %s: %w", f.name, origin, err))
+				continue
+			}
+		case f.value.IsZero() && f.tag.Get("default") != "":
+			if err := parse(f.value, f.tag.Get("default")); err != nil {
+				return fmt.Errorf("config: invalid default of %s: %w", f.name, err)
+			}
+		}
+		if err := f.validate(env == Development); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns the variables of the struct cfg points to, or of cfg
+// itself, with the values of secret fields replaced
+func Redacted(cfg any) map[string]string {
+	target := reflect.ValueOf(cfg)
+	if target.Kind() == reflect.Pointer {
+		target = target.Elem()
+	}
+	values := map[string]string{}
+	if target.Kind() != reflect.Struct {
+		return values
+	}
+	fields, err := fieldsOf(target)
+	if err != nil {
+		return values
+	}
+	for _, f := range fields {
+		values[f.name] = f.display()
+	}
+	return values
+}
+
+// Log logs the effective configuration of a service in one line, with the
+// values of secret fields redacted
+func Log(service string, cfg any) {
+	var env string
+	if src, err := getSources(); err == nil {
+		env, _ = src.environment()
+	}
+	values := Redacted(cfg)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attrs := make([]any, 0, 2*len(names))
+	for _, name := range names {
+		attrs = append(attrs, name, values[name])
+	}
+	logging.Logger.Info("configuration loaded", "service", service, "environment", env, slog.Group("config", attrs...))
+}
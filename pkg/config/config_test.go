@@ -0,0 +1,192 @@
+// pkg/config/config_test.go
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// unsetenv unsets name until the test ends
+func unsetenv(t *testing.T, name string) {
+	t.Helper()
+	t.Setenv(name, "")
+	os.Unsetenv(name)
+}
+
+// withSources runs the test in a temporary directory holding a .env with the
+// contents dotenv and a CONFIG_FILE with the contents file, where they are not
+// empty. The directory also holds a secret file named secret, and variables
+// are set in the environment from env.
+func withSources(t *testing.T, env map[string]string, dotenv, file string) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	write := func(name, contents string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("secret", "secret\n")
+
+	unsetenv(t, "APP_ENV")
+	unsetenv(t, "CONFIG_FILE")
+	if dotenv != "" {
+		write(".env", dotenv)
+		// Loading exports the values of .env, which must not leak into other tests
+		for _, line := range strings.Split(dotenv, "\n") {
+			if name, _, ok := strings.Cut(line, "="); ok {
+				unsetenv(t, name)
+			}
+		}
+	}
+	if file != "" {
+		write("config.yaml", file)
+		t.Setenv("CONFIG_FILE", filepath.Join(dir, "config.yaml"))
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	// The sources are read again by the next Load
+	loadSources = sync.Once{}
+	t.Cleanup(func() { loadSources = sync.Once{} })
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	type settings struct {
+		Value string `env:"VALUE" default:"default"`
+	}
+	tests := []struct {
+		name   string
+		env    map[string]string
+		dotenv string
+		file   string
+		suffix string
+		want   string
+	}{
+		{"default", nil, "", "", "", "default"},
+		{"config file", nil, "", "VALUE: file", "", "file"},
+		{".env over config file", nil, "VALUE=dotenv", "VALUE: file", "", "dotenv"},
+		{"secret file over .env", map[string]string{"VALUE_FILE": "secret"}, "VALUE=dotenv", "VALUE: file", "", "secret"},
+		{"secret file named in .env", nil, "VALUE_FILE=secret", "VALUE: file", "", "secret"},
+		{"environment over everything", map[string]string{"VALUE": "env"}, "VALUE=dotenv", "VALUE: file", "", "env"},
+		{"environment over a secret file named in .env", map[string]string{"VALUE": "env"}, "VALUE_FILE=secret", "", "", "env"},
+		{"suffix over environment", map[string]string{"VALUE": "env"}, "", "VALUE_ORDER: file", "ORDER", "file"},
+		{"environment without the suffix", map[string]string{"VALUE": "env"}, "", "", "ORDER", "env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSources(t, tt.env, tt.dotenv, tt.file)
+			var cfg settings
+			if err := LoadFor(&cfg, tt.suffix); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Value != tt.want {
+				t.Errorf("VALUE is %q, want %q", cfg.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadValueAndFileConflict(t *testing.T) {
+	type settings struct {
+		Value string `env:"VALUE"`
+	}
+	withSources(t, map[string]string{"VALUE": "env", "VALUE_FILE": "secret"}, "", "")
+	var cfg settings
+	err := Load(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "VALUE and VALUE_FILE are both set") {
+		t.Errorf("error %v, want VALUE and VALUE_FILE reported as both set", err)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	type settings struct {
+		Name     string        `env:"NAME" required:"true"`
+		Workers  int           `env:"WORKERS" min:"1" max:"10" default:"2"`
+		Timeout  time.Duration `env:"TIMEOUT" min:"1s" max:"1m" default:"5s"`
+		Mode     string        `env:"MODE" oneof:"up check" default:"up"`
+		Password string        `env:"PASSWORD" secret:"true" insecure:"postgres,changeme" default:"s3cret"`
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+		// want are the parts of the error, none when the settings are valid
+		want []string
+	}{
+		{"valid", map[string]string{"NAME": "orders"}, nil},
+		{"required missing", nil, []string{"NAME must be set"}},
+		{"below min", map[string]string{"NAME": "orders", "WORKERS": "0"}, []string{"WORKERS must be at least 1, got 0"}},
+		{"above max", map[string]string{"NAME": "orders", "WORKERS": "11"}, []string{"WORKERS must be at most 10, got 11"}},
+		{"duration below min", map[string]string{"NAME": "orders", "TIMEOUT": "500ms"}, []string{"TIMEOUT must be at least 1s, got 500ms"}},
+		{"duration above max", map[string]string{"NAME": "orders", "TIMEOUT": "2m"}, []string{"TIMEOUT must be at most 1m, got 2m0s"}},
+		{"not one of", map[string]string{"NAME": "orders", "MODE": "down"}, []string{`MODE must be one of up, check, got "down"`}},
+		{"insecure in production", map[string]string{"NAME": "orders", "PASSWORD": "changeme"}, []string{"PASSWORD is set to a well-known default"}},
+		{"insecure in development", map[string]string{"NAME": "orders", "PASSWORD": "changeme", "APP_ENV": Development}, nil},
+		{"unparsable", map[string]string{"NAME": "orders", "WORKERS": "many"}, []string{"WORKERS from environment: must be a whole number"}},
+		{"every invalid field", map[string]string{"WORKERS": "0", "MODE": "down"}, []string{"NAME must be set", "WORKERS must be at least 1", "MODE must be one of"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSources(t, tt.env, "", "")
+			var cfg settings
+			err := Load(&cfg)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("error %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+			if strings.Contains(err.Error(), "changeme") {
+				t.Errorf("error %q repeats the secret", err)
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	type settings struct {
+		Host     string   `env:"DB_HOST"`
+		Password string   `env:"DB_PASSWORD" secret:"true"`
+		Token    string   `env:"TOKEN" secret:"true"`
+		Tags     []string `env:"TAGS"`
+	}
+	cfg := settings{Host: "postgres", Password: "s3cret", Tags: []string{"order", "api"}}
+	want := map[string]string{
+		"DB_HOST":     "postgres",
+		"DB_PASSWORD": redacted,
+		// An unset secret is shown as unset
+		"TOKEN": "",
+		"TAGS":  "order,api",
+	}
+	got := Redacted(&cfg)
+	if len(got) != len(want) {
+		t.Errorf("redacted %d variables, want %d", len(got), len(want))
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s is %q, want %q", name, got[name], value)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// pkg/config/fields.go
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// redacted replaces the value of a secret field that is set
+const redacted = "[redacted]"
+
+// field is a struct field loaded from the variable name
+type field struct {
+	name  string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// fieldsOf returns the fields of a struct with an env tag, recursing into
+// struct fields without one
+func fieldsOf(v reflect.Value) ([]field, error) {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := sf.Tag.Get("env")
+		if name == "" {
+			if sf.Type.Kind() == reflect.Struct {
+				nested, err := fieldsOf(v.Field(i))
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, nested...)
+			}
+			continue
+		}
+		if !supported(sf.Type) {
+			return nil, fmt.Errorf("config: %s of type %s is not supported", name, sf.Type)
+		}
+		fields = append(fields, field{name: name, value: v.Field(i), tag: sf.Tag})
+	}
+	return fields, nil
+}
+
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+// parse sets v to value. Errors do not repeat the value, which may be a secret.
+func parse(v reflect.Value, value string) error {
+	// Strings are kept as they are, a password may start or end with a space
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	value = strings.TrimSpace(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.New("must be a duration such as 15s")
+			}
+			v.SetInt(int64(parsed))
+			return nil
+		}
+		parsed, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		v.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive whole number")
+		}
+		v.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(parsed)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	}
+	return nil
+}
+
+// validate checks the field against its required, min, max, oneof and
+// insecure tags
+func (f field) validate(dev bool) error {
+	if f.tag.Get("required") == "true" && f.value.IsZero() {
+		return fmt.Errorf("%s must be set", f.name)
+	}
+
+	for _, bound := range []string{"min", "max"} {
+		limit := f.tag.Get(bound)
+		if limit == "" {
+			continue
+		}
+		parsed := reflect.New(f.value.Type()).Elem()
+		if err := parse(parsed, limit); err != nil {
+			return fmt.Errorf("config: invalid %s of %s: %w", bound, f.name, err)
+		}
+		value, limitValue := number(f.value), number(parsed)
+		if bound == "min" && value < limitValue {
+			return fmt.Errorf("%s must be at least %s, got %s", f.name, limit, f.display())
+		}
+		if bound == "max" && value > limitValue {
+			return fmt.Errorf("%s must be at most %s, got %s", f.name, limit, f.display())
+		}
+	}
+
+	if oneOf := f.tag.Get("oneof"); oneOf != "" && f.value.Kind() == reflect.String {
+		allowed := strings.Fields(oneOf)
+		if !slices.Contains(allowed, f.value.String()) {
+			return fmt.Errorf("%s must be one of %s, got %q", f.name, strings.Join(allowed, ", "), f.value.String())
+		}
+	}
+
+	if insecure := f.tag.Get("insecure"); insecure != "" && !dev && f.value.Kind() == reflect.String {
+		if slices.Contains(strings.Split(insecure, ","), f.value.String()) {
+			return fmt.Errorf("%s is set to a well-known default, which is only allowed with APP_ENV=%s", f.name, Development)
+		}
+	}
+	return nil
+}
+
+// number returns a numeric value as a float64 for comparison, 0 for other kinds
+func number(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return 0
+}
+
+// display formats the value for logs, redacting secrets
+func (f field) display() string {
+	if f.tag.Get("secret") == "true" {
+		if f.value.IsZero() {
+			return ""
+		}
+		return redacted
+	}
+	switch value := f.value.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case []string:
+		return strings.Join(value, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
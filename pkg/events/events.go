@@ -0,0 +1,225 @@
+// pkg/events/events.go
+
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/metrics"
+	"e-commerce-platform/pkg/redis"
+)
+
+// Event types published by the services. The payload of each is the struct in
+// payloads.go with the same name.
+const (
+	TypeOrderCreated     = "order.created"
+	TypeOrderUpdated     = "order.updated"
+	TypeOrderDeleted     = "order.deleted"
+	TypePaymentCompleted = "payment.completed"
+	TypePaymentFailed    = "payment.failed"
+	TypeStockChanged     = "inventory.stock_changed"
+	TypeStockAlertRaised = "inventory.stock_alert_raised"
+	TypeProductCreated   = "product.created"
+	TypeProductUpdated   = "product.updated"
+	TypeProductDeleted   = "product.deleted"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultRetryBackoff   = time.Second
+	defaultHandlerTimeout = 30 * time.Second
+	maxRetryBackoff       = 30 * time.Second
+)
+
+// Event is the envelope every domain event is published in
+type Event struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Version of the payload schema of Type. Consumers should ignore versions they do not know.
+	Version    int       `json:"version"`
+	Source     string    `json:"source"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// CorrelationID is the request ID of the request that caused the event
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// New creates a version 1 event of eventType with data as its payload. The
+// correlation ID is the request ID carried by ctx.
+func New(ctx context.Context, source, eventType string, data any) (Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %w", eventType, err)
+	}
+	return Event{
+		ID:            newID(),
+		Type:          eventType,
+		Version:       1,
+		Source:        source,
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: logging.RequestIDFromContext(ctx),
+		Data:          payload,
+	}, nil
+}
+
+// FromClient returns a Redis Streams bus on client, or an in-process bus when
+// client is nil
+func FromClient(client *redis.Client, options Options) Bus {
+	if client == nil {
+		return NewMemory(options)
+	}
+	return NewRedis(client.Redis(), options)
+}
+
+// Decode unmarshals the payload of the event into v
+func (e Event) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %s event %s: %w", e.Type, e.ID, err)
+	}
+	return nil
+}
+
+// newID returns a random UUID (version 4)
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Handler processes one event. Returning an error retries the event, up to the
+// bus's maximum attempts, after which it is dead-lettered. Errors wrapping
+// ErrPermanent are dead-lettered without retries.
+type Handler func(ctx context.Context, event Event) error
+
+// ErrPermanent marks handler errors that retrying cannot fix, e.g. undecodable payloads
+var ErrPermanent = errors.New("permanent failure")
+
+// Publisher publishes events
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+// Bus publishes events and delivers them to consumer groups. Every group
+// receives every event of the types it subscribed to, and each event is handled
+// by one consumer of the group.
+type Bus interface {
+	Publisher
+	// Subscribe handles events of the given types as a member of group until
+	// ctx is cancelled
+	Subscribe(ctx context.Context, group string, handler Handler, types ...string) error
+}
+
+// DeadLetter is an event that could not be handled
+type DeadLetter struct {
+	Event    Event     `json:"event"`
+	Group    string    `json:"group"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Options configures how a bus delivers and retries events
+type Options struct {
+	// Consumer names this process within its consumer groups, defaulting to host name and PID
+	Consumer string
+	// MaxAttempts is how often a consumer group tries an event before it is dead-lettered
+	MaxAttempts int
+	// RetryBackoff is the wait before the first retry. It doubles with every attempt.
+	RetryBackoff time.Duration
+	// HandlerTimeout bounds a single attempt
+	HandlerTimeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.Consumer == "" {
+		host, _ := os.Hostname()
+		o.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaultMaxAttempts
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = defaultRetryBackoff
+	}
+	if o.HandlerTimeout <= 0 {
+		o.HandlerTimeout = defaultHandlerTimeout
+	}
+	return o
+}
+
+var (
+	eventsPublished = metrics.NewCounterVec(
+		"events_published_total",
+		"Number of domain events published, by type.",
+		"type",
+	)
+	eventsHandled = metrics.NewCounterVec(
+		"events_handled_total",
+		"Number of domain event deliveries, by type, consumer group and result (ok, retry, dead_letter).",
+		"type", "group", "result",
+	)
+)
+
+// handle runs handler for event with retries and returns the error of the last
+// attempt, or nil once an attempt succeeds. It gives up early when ctx is done.
+func handle(ctx context.Context, options Options, group string, handler Handler, event Event) (attempts int, err error) {
+	ctx = logging.WithRequestID(ctx, event.CorrelationID)
+	backoff := options.RetryBackoff
+	for attempts = 1; ; attempts++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, options.HandlerTimeout)
+		err = safeHandle(attemptCtx, handler, event)
+		cancel()
+		if err == nil {
+			eventsHandled.WithLabelValues(event.Type, group, "ok").Inc()
+			return attempts, nil
+		}
+		if errors.Is(err, ErrPermanent) || attempts >= options.MaxAttempts {
+			return attempts, err
+		}
+
+		eventsHandled.WithLabelValues(event.Type, group, "retry").Inc()
+		logging.Logger.Warn("event handler failed, retrying",
+			"event_id", event.ID, "type", event.Type, "group", group, "attempt", attempts, "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return attempts, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+	}
+}
+
+// safeHandle turns a handler panic into an error, so one bad event cannot stop a consumer
+func safeHandle(ctx context.Context, handler Handler, event Event) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+	return handler(ctx, event)
+}
+
+// deadLetter records that event could not be handled
+func deadLetter(event Event, group string, attempts int, err error) DeadLetter {
+	eventsHandled.WithLabelValues(event.Type, group, "dead_letter").Inc()
+	logging.Logger.Error("event dead-lettered",
+		"event_id", event.ID, "type", event.Type, "group", group, "attempts", attempts, "error", err.Error())
+	return DeadLetter{
+		Event:    event,
+		Group:    group,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+}
@@ -0,0 +1,137 @@
+// pkg/events/memory.go
+
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Memory is a bus local to one process, for tests and for running services
+// without Redis. It delivers like the Redis bus, including retries and dead
+// letters, but events are lost when the process exits.
+type Memory struct {
+	options Options
+
+	mu sync.Mutex
+	// queues holds the undelivered events of each event type and group
+	queues      map[string]map[string][]Event
+	published   []Event
+	deadLetters []DeadLetter
+	changed     chan struct{}
+}
+
+// NewMemory creates an empty in-process bus
+func NewMemory(options Options) *Memory {
+	return &Memory{
+		options: options.withDefaults(),
+		queues:  make(map[string]map[string][]Event),
+		changed: make(chan struct{}),
+	}
+}
+
+// Publish queues events for every group subscribed to their types
+func (b *Memory) Publish(ctx context.Context, events ...Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, event := range events {
+		for group, queue := range b.queues[event.Type] {
+			b.queues[event.Type][group] = append(queue, event)
+		}
+		b.published = append(b.published, event)
+		eventsPublished.WithLabelValues(event.Type).Inc()
+	}
+	b.notify()
+	return nil
+}
+
+// notify wakes up waiting subscribers. b.mu must be held.
+func (b *Memory) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Subscribe handles events of the given types as a member of group until ctx
+// is cancelled. A group receives the events published after it first subscribed.
+func (b *Memory) Subscribe(ctx context.Context, group string, handler Handler, types ...string) error {
+	if len(types) == 0 {
+		return errors.New("subscribe needs at least one event type")
+	}
+
+	b.mu.Lock()
+	for _, eventType := range types {
+		if b.queues[eventType] == nil {
+			b.queues[eventType] = make(map[string][]Event)
+		}
+		if _, ok := b.queues[eventType][group]; !ok {
+			b.queues[eventType][group] = []Event{}
+		}
+	}
+	b.mu.Unlock()
+
+	for {
+		b.mu.Lock()
+		event, ok := b.next(group, types)
+		changed := b.changed
+		b.mu.Unlock()
+
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-changed:
+			}
+			continue
+		}
+
+		attempts, err := handle(ctx, b.options, group, handler, event)
+		if err == nil {
+			continue
+		}
+		b.mu.Lock()
+		if ctx.Err() != nil {
+			// Like an unacknowledged stream entry, the event goes to another consumer
+			b.queues[event.Type][group] = append([]Event{event}, b.queues[event.Type][group]...)
+			b.notify()
+			b.mu.Unlock()
+			return nil
+		}
+		b.deadLetters = append(b.deadLetters, deadLetter(event, group, attempts, err))
+		b.mu.Unlock()
+	}
+}
+
+// next pops the oldest queued event of group among types. b.mu must be held.
+func (b *Memory) next(group string, types []string) (Event, bool) {
+	var oldest Event
+	oldestType := ""
+	for _, eventType := range types {
+		queue := b.queues[eventType][group]
+		if len(queue) == 0 {
+			continue
+		}
+		if oldestType == "" || queue[0].OccurredAt.Before(oldest.OccurredAt) {
+			oldest, oldestType = queue[0], eventType
+		}
+	}
+	if oldestType == "" {
+		return Event{}, false
+	}
+	b.queues[oldestType][group] = b.queues[oldestType][group][1:]
+	return oldest, true
+}
+
+// Published returns every event published so far, in order
+func (b *Memory) Published() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Event(nil), b.published...)
+}
+
+// DeadLetters returns every dead-lettered event so far, in order
+func (b *Memory) DeadLetters() []DeadLetter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]DeadLetter(nil), b.deadLetters...)
+}
@@ -0,0 +1,209 @@
+// pkg/events/memory_test.go
+
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testOptions retry quickly, so failing handlers finish within the test
+var testOptions = Options{Consumer: "test", MaxAttempts: 3, RetryBackoff: time.Millisecond}
+
+// subscribe runs a consumer of bus until the test ends
+func subscribe(t *testing.T, bus *Memory, group string, handler Handler, types ...string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := bus.Subscribe(ctx, group, handler, types...); err != nil {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// publish publishes count events of eventType
+func publish(t *testing.T, bus *Memory, eventType string, count int) []Event {
+	t.Helper()
+	var published []Event
+	for i := 0; i < count; i++ {
+		event, err := New(context.Background(), "test", eventType, map[string]int{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bus.Publish(context.Background(), event); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, event)
+	}
+	return published
+}
+
+// eventually fails the test unless condition holds within a second
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// recorder counts the deliveries of each event ID
+type recorder struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{counts: map[string]int{}}
+}
+
+func (r *recorder) handler(err error) Handler {
+	return func(ctx context.Context, event Event) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.counts[event.ID]++
+		return err
+	}
+}
+
+func (r *recorder) deliveries() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.counts))
+	for id, count := range r.counts {
+		counts[id] = count
+	}
+	return counts
+}
+
+func (r *recorder) total() int {
+	total := 0
+	for _, count := range r.deliveries() {
+		total += count
+	}
+	return total
+}
+
+func TestMemoryConsumerGroups(t *testing.T) {
+	bus := NewMemory(testOptions)
+
+	// Two consumers share the orders group, notifications is a group of its own
+	orders, notifications := newRecorder(), newRecorder()
+	subscribe(t, bus, "orders", orders.handler(nil), TypePaymentCompleted)
+	subscribe(t, bus, "orders", orders.handler(nil), TypePaymentCompleted)
+	subscribe(t, bus, "notifications", notifications.handler(nil), TypePaymentCompleted)
+	eventually(t, func() bool {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		return len(bus.queues[TypePaymentCompleted]) == 2
+	})
+
+	published := publish(t, bus, TypePaymentCompleted, 20)
+	publish(t, bus, TypePaymentFailed, 5)
+
+	for name, group := range map[string]*recorder{"orders": orders, "notifications": notifications} {
+		eventually(t, func() bool { return group.total() >= len(published) })
+		// Let a duplicate delivery show up, if there is one
+		time.Sleep(10 * time.Millisecond)
+
+		deliveries := group.deliveries()
+		if len(deliveries) != len(published) {
+			t.Errorf("%s received %d events, want %d", name, len(deliveries), len(published))
+		}
+		for _, event := range published {
+			if deliveries[event.ID] != 1 {
+				t.Errorf("%s handled event %s %d times, want once", name, event.ID, deliveries[event.ID])
+			}
+		}
+	}
+	if dead := bus.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead-lettered %d events, want none", len(dead))
+	}
+}
+
+func TestMemoryRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		failures   int
+		attempts   int
+		deadLetter bool
+	}{
+		{"recovers", errors.New("database unavailable"), 2, 3, false},
+		{"gives up after MaxAttempts", errors.New("database unavailable"), 10, 3, true},
+		{"permanent error", fmt.Errorf("%w: malformed payload", ErrPermanent), 10, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewMemory(testOptions)
+
+			var mu sync.Mutex
+			attempts := 0
+			handled := make(chan struct{})
+			subscribe(t, bus, "orders", func(ctx context.Context, event Event) error {
+				mu.Lock()
+				defer mu.Unlock()
+				attempts++
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				close(handled)
+				return nil
+			}, TypePaymentCompleted)
+			eventually(t, func() bool {
+				bus.mu.Lock()
+				defer bus.mu.Unlock()
+				return len(bus.queues[TypePaymentCompleted]) == 1
+			})
+
+			event := publish(t, bus, TypePaymentCompleted, 1)[0]
+			if tt.deadLetter {
+				eventually(t, func() bool { return len(bus.DeadLetters()) == 1 })
+			} else {
+				select {
+				case <-handled:
+				case <-time.After(time.Second):
+					t.Fatal("event was not handled")
+				}
+			}
+
+			mu.Lock()
+			got := attempts
+			mu.Unlock()
+			if got != tt.attempts {
+				t.Errorf("handler ran %d times, want %d", got, tt.attempts)
+			}
+
+			dead := bus.DeadLetters()
+			if !tt.deadLetter {
+				if len(dead) != 0 {
+					t.Errorf("dead-lettered %d events, want none", len(dead))
+				}
+				return
+			}
+			letter := dead[0]
+			if letter.Event.ID != event.ID || letter.Group != "orders" {
+				t.Errorf("dead-lettered event %s of group %s, want %s of orders", letter.Event.ID, letter.Group, event.ID)
+			}
+			if letter.Attempts != tt.attempts {
+				t.Errorf("dead letter records %d attempts, want %d", letter.Attempts, tt.attempts)
+			}
+			if letter.Error != tt.err.Error() {
+				t.Errorf("dead letter records error %q, want %q", letter.Error, tt.err.Error())
+			}
+		})
+	}
+}
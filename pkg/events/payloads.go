@@ -0,0 +1,95 @@
+// pkg/events/payloads.go
+
+package events
+
+// OrderItem is one line of an order in order events
+type OrderItem struct {
+	ProductID string  `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+// OrderCreated is the payload of order.created
+type OrderCreated struct {
+	OrderID     string      `json:"order_id"`
+	UserID      string      `json:"user_id"`
+	TotalAmount float64     `json:"total_amount"`
+	Items       []OrderItem `json:"items"`
+}
+
+// OrderUpdated is the payload of order.updated
+type OrderUpdated struct {
+	OrderID       string      `json:"order_id"`
+	Status        string      `json:"status"`
+	PaymentStatus string      `json:"payment_status"`
+	TotalAmount   float64     `json:"total_amount"`
+	Items         []OrderItem `json:"items"`
+}
+
+// OrderDeleted is the payload of order.deleted
+type OrderDeleted struct {
+	OrderID string `json:"order_id"`
+}
+
+// PaymentCompleted is the payload of payment.completed
+type PaymentCompleted struct {
+	PaymentID     string  `json:"payment_id"`
+	OrderID       string  `json:"order_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	PaymentMethod string  `json:"payment_method"`
+	TransactionID string  `json:"transaction_id"`
+}
+
+// PaymentFailed is the payload of payment.failed
+type PaymentFailed struct {
+	PaymentID     string  `json:"payment_id"`
+	OrderID       string  `json:"order_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	PaymentMethod string  `json:"payment_method"`
+	Reason        string  `json:"reason"`
+}
+
+// StockChanged is the payload of inventory.stock_changed
+type StockChanged struct {
+	ItemID    string `json:"item_id"`
+	ProductID string `json:"product_id"`
+	// TransactionType is received, shipped, adjusted or damaged
+	TransactionType string `json:"transaction_type"`
+	Quantity        int    `json:"quantity"`
+	PreviousStock   int    `json:"previous_stock"`
+	NewStock        int    `json:"new_stock"`
+	Reference       string `json:"reference,omitempty"`
+}
+
+// StockAlertRaised is the payload of inventory.stock_alert_raised
+type StockAlertRaised struct {
+	AlertID   string `json:"alert_id"`
+	ItemID    string `json:"item_id"`
+	ProductID string `json:"product_id"`
+	// AlertType is low_stock, expired or damaged
+	AlertType string `json:"alert_type"`
+	Message   string `json:"message"`
+}
+
+// ProductCreated is the payload of product.created
+type ProductCreated struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Stock     int64   `json:"stock"`
+}
+
+// ProductUpdated is the payload of product.updated
+type ProductUpdated struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Price     float64 `json:"price"`
+	Stock     int64   `json:"stock"`
+}
+
+// ProductDeleted is the payload of product.deleted
+type ProductDeleted struct {
+	ProductID string `json:"product_id"`
+}
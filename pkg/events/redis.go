@@ -0,0 +1,255 @@
+// pkg/events/redis.go
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"e-commerce-platform/pkg/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamPrefix namespaces the stream of each event type, e.g. events:order.created
+	streamPrefix = "events:"
+	// DeadLetterStream holds events that could not be handled, with the group and error
+	DeadLetterStream = "events:dead-letter"
+	// streamMaxLen bounds each stream. Trimming is approximate, so streams stay slightly longer.
+	streamMaxLen = 100000
+	// readBlock is how long a consumer waits for new events per read
+	readBlock = 5 * time.Second
+	// readCount is the maximum number of events read at once
+	readCount = 10
+	// claimIdle is how long an event stays unacknowledged before another
+	// consumer of the group takes it over, e.g. after its consumer crashed
+	claimIdle = time.Minute
+)
+
+// Redis is a bus on Redis Streams. Each event type has its own stream and
+// each subscriber group a consumer group on it. Events are acknowledged once
+// handled or dead-lettered, so events of a crashed consumer are redelivered to
+// another consumer of its group after claimIdle.
+type Redis struct {
+	client  *redis.Client
+	options Options
+}
+
+// NewRedis creates a bus on the given client
+func NewRedis(client *redis.Client, options Options) *Redis {
+	return &Redis{client: client, options: options.withDefaults()}
+}
+
+// Stream returns the stream events of eventType are published to
+func Stream(eventType string) string {
+	return streamPrefix + eventType
+}
+
+// Publish appends events to the streams of their types
+func (b *Redis) Publish(ctx context.Context, events ...Event) error {
+	pipe := b.client.Pipeline()
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: Stream(event.Type),
+			MaxLen: streamMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"event": data},
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to publish events: %w", err)
+	}
+	for _, event := range events {
+		eventsPublished.WithLabelValues(event.Type).Inc()
+	}
+	return nil
+}
+
+// Subscribe handles events of the given types as a member of group until ctx
+// is cancelled. A new group receives the events published after it was first
+// created. Events are handled one at a time; call Subscribe from several
+// goroutines to handle them concurrently.
+func (b *Redis) Subscribe(ctx context.Context, group string, handler Handler, types ...string) error {
+	if len(types) == 0 {
+		return errors.New("subscribe needs at least one event type")
+	}
+
+	streams := make([]string, len(types))
+	for i, eventType := range types {
+		streams[i] = Stream(eventType)
+		err := b.client.XGroupCreateMkStream(ctx, streams[i], group, "$").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group %s on %s: %w", group, streams[i], err)
+		}
+	}
+
+	// XREADGROUP takes every stream followed by the ID to read from, > for new events
+	args := make([]string, 0, 2*len(streams))
+	args = append(args, streams...)
+	for range streams {
+		args = append(args, ">")
+	}
+
+	lastClaim := time.Now()
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= claimIdle/2 {
+			b.claim(ctx, group, streams, handler)
+			lastClaim = time.Now()
+		}
+
+		results, err := b.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: b.options.Consumer,
+			Streams:  args,
+			Count:    readCount,
+			Block:    readBlock,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			logging.Logger.Error("failed to read events", "group", group, "error", err.Error())
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		for _, result := range results {
+			for _, message := range result.Messages {
+				b.process(ctx, group, result.Stream, message, handler, 0)
+			}
+		}
+	}
+	return nil
+}
+
+// claim takes over events that another consumer of group left unacknowledged
+// for claimIdle and handles them. Events that were already delivered
+// MaxAttempts times are dead-lettered, so an event that crashes its consumer
+// cannot crash every consumer of the group in turn.
+func (b *Redis) claim(ctx context.Context, group string, streams []string, handler Handler) {
+	for _, stream := range streams {
+		start := "0-0"
+		for ctx.Err() == nil {
+			messages, next, err := b.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   stream,
+				Group:    group,
+				Consumer: b.options.Consumer,
+				MinIdle:  claimIdle,
+				Start:    start,
+				Count:    readCount,
+			}).Result()
+			if err != nil {
+				logging.Logger.Error("failed to claim idle events", "stream", stream, "group", group, "error", err.Error())
+				break
+			}
+			for _, message := range messages {
+				b.process(ctx, group, stream, message, handler, b.deliveries(ctx, stream, group, message.ID))
+			}
+			if next == "0-0" || len(messages) == 0 {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// deliveries returns how often a pending event has been delivered to group
+func (b *Redis) deliveries(ctx context.Context, stream, group, id string) int {
+	pending, err := b.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return int(pending[0].RetryCount)
+}
+
+// process handles one message and acknowledges it once it is handled or
+// dead-lettered. It is left pending when ctx is cancelled mid-way.
+func (b *Redis) process(ctx context.Context, group, stream string, message redis.XMessage, handler Handler, deliveries int) {
+	var event Event
+	var attempts int
+	var err error
+
+	raw, _ := message.Values["event"].(string)
+	switch {
+	case json.Unmarshal([]byte(raw), &event) != nil:
+		event = Event{ID: message.ID, Type: strings.TrimPrefix(stream, streamPrefix), Data: json.RawMessage(fmt.Sprintf("%q", raw))}
+		err = fmt.Errorf("%w: undecodable event %s", ErrPermanent, message.ID)
+	case deliveries > b.options.MaxAttempts:
+		attempts = deliveries
+		err = fmt.Errorf("delivered %d times without being acknowledged", deliveries)
+	default:
+		attempts, err = handle(ctx, b.options, group, handler, event)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+	}
+
+	if err != nil {
+		if dlErr := b.deadLetter(ctx, deadLetter(event, group, attempts, err)); dlErr != nil {
+			logging.Logger.Error("failed to dead-letter event", "event_id", event.ID, "error", dlErr.Error())
+			return
+		}
+	}
+	if err := b.client.XAck(ctx, stream, group, message.ID).Err(); err != nil {
+		logging.Logger.Error("failed to acknowledge event", "event_id", event.ID, "group", group, "error", err.Error())
+	}
+}
+
+func (b *Redis) deadLetter(ctx context.Context, letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	return b.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: DeadLetterStream,
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"dead_letter": data,
+			"type":        letter.Event.Type,
+			"group":       letter.Group,
+		},
+	}).Err()
+}
+
+// DeadLetters returns up to count of the most recent dead-lettered events, newest first
+func (b *Redis) DeadLetters(ctx context.Context, count int64) ([]DeadLetter, error) {
+	messages, err := b.client.XRevRangeN(ctx, DeadLetterStream, "+", "-", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dead letters: %w", err)
+	}
+	letters := make([]DeadLetter, 0, len(messages))
+	for _, message := range messages {
+		raw, _ := message.Values["dead_letter"].(string)
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(raw), &letter); err != nil {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
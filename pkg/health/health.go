@@ -0,0 +1,199 @@
+// pkg/health/health.go
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusUp       = "UP"
+	StatusDown     = "DOWN"
+	StatusDegraded = "DEGRADED"
+)
+
+// checkTimeout bounds each dependency check so readiness answers within the Consul check timeout
+const checkTimeout = 800 * time.Millisecond
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one dependency check
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the body of the readiness endpoint
+type Report struct {
+	Service string                 `json:"service"`
+	Status  string                 `json:"status"`
+	Checks  map[string]CheckResult `json:"checks"`
+}
+
+// Checker runs the readiness checks of a service
+type Checker struct {
+	service string
+
+	mu     sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+// NewChecker creates a checker without any dependencies
+func NewChecker(service string) *Checker {
+	return &Checker{
+		service: service,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Add registers a dependency that must be healthy for the service to be ready
+func (h *Checker) Add(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Run executes every check concurrently
+func (h *Checker) Run(ctx context.Context) Report {
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checks := make(map[string]Check, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	report := Report{
+		Service: h.service,
+		Status:  StatusUp,
+		Checks:  make(map[string]CheckResult, len(names)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			result := CheckResult{
+				Status:    StatusUp,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = StatusDown
+			}
+		}(name, checks[name])
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Live reports that the process is up. It does not look at dependencies, so a
+// failing database does not get the service restarted.
+func (h *Checker) Live() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"service": h.service, "status": StatusUp})
+	}
+}
+
+// Ready answers 200 when every dependency is healthy and 503 otherwise
+func (h *Checker) Ready() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := h.Run(c.Request.Context())
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
+
+// Register mounts /health and /health/live (liveness) and /health/ready (readiness)
+func (h *Checker) Register(r gin.IRouter) {
+	r.GET("/health", h.Live())
+	r.GET("/health/live", h.Live())
+	r.GET("/health/ready", h.Ready())
+}
+
+// DB pings the database behind a GORM connection
+func DB(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+// Redis pings a go-redis client
+func Redis(client *redis.Client) Check {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+var httpClient = &http.Client{Timeout: checkTimeout}
+
+// HTTP expects a 2xx response from target
+func HTTP(target string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Service checks the liveness endpoint of another service given any URL on it,
+// e.g. its API base URL. Liveness is used rather than readiness so that one
+// failing dependency does not take down every service that calls it.
+func Service(baseURL string) Check {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return func(context.Context) error {
+			return fmt.Errorf("invalid service URL %q", baseURL)
+		}
+	}
+	return HTTP(fmt.Sprintf("%s://%s/health/live", u.Scheme, u.Host))
+}
@@ -0,0 +1,142 @@
+// pkg/logging/logging.go
+
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestID correlates one request across the gateway and every service it touches
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied request IDs before they are trusted
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// Logger writes one JSON object per line to stdout
+var Logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// NewRequestID generates a random 128-bit request ID
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID accepts short IDs made of printable ASCII without spaces
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID accepts the caller's X-Request-ID or generates a new one. The ID is
+// stored in the gin context as "request_id", in the request context for outbound
+// calls, on the request headers so proxies forward it, and on the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Request.Header.Set(HeaderRequestID, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// AccessLog writes a JSON access log line for every request once it has completed
+func AccessLog(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("service", service),
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", c.Writer.Status()),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_id", c.GetString("user_id")),
+			slog.String("client_id", c.GetString("client_id")),
+			slog.String("request_id", c.GetString("request_id")),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		Logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Transport sets X-Request-ID on outbound requests from the ID in their context
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestIDFromContext(req.Context()); id != "" && req.Header.Get(HeaderRequestID) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(HeaderRequestID, id)
+	}
+	return t.Base.RoundTrip(req)
+}
+
+// NewHTTPClient returns a client for service-to-service calls that propagates the request ID
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: NewTransport(nil),
+	}
+}
@@ -0,0 +1,105 @@
+// pkg/metrics/metrics.go
+
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric exposed on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = NewCounterVec(
+		"http_requests_total",
+		"Number of HTTP requests handled, by route template and status.",
+		"service", "method", "route", "status",
+	)
+	requestDuration = NewHistogramVec(
+		"http_request_duration_seconds",
+		"Latency of HTTP requests, by route template and status.",
+		prometheus.DefBuckets,
+		"service", "method", "route", "status",
+	)
+	requestsInFlight = NewGaugeVec(
+		"http_requests_in_flight",
+		"Number of HTTP requests currently being handled.",
+		"service",
+	)
+
+	// RateLimitRejections counts requests rejected by pkg/middleware.RateLimiter
+	RateLimitRejections = NewCounterVec(
+		"rate_limit_rejections_total",
+		"Number of requests rejected by the rate limiter, by tier.",
+		"tier",
+	)
+
+	// RateLimitErrors counts rate limit checks that could not reach Redis, by tier and failure policy
+	RateLimitErrors = NewCounterVec(
+		"rate_limit_errors_total",
+		"Number of rate limit checks that failed to reach Redis, by tier and failure policy.",
+		"tier", "policy",
+	)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	Registry.MustRegister(counter)
+	return counter
+}
+
+// NewGaugeVec creates and registers a gauge
+func NewGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	Registry.MustRegister(gauge)
+	return gauge
+}
+
+// NewHistogramVec creates and registers a histogram
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	Registry.MustRegister(histogram)
+	return histogram
+}
+
+// Middleware records request counts, latencies and in-flight requests. Requests
+// are labeled by route template rather than path so IDs do not blow up cardinality.
+func Middleware(service string) gin.HandlerFunc {
+	inFlight := requestsInFlight.WithLabelValues(service)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requestsTotal.WithLabelValues(service, c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(service, c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() gin.HandlerFunc {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return gin.WrapH(handler)
+}
@@ -0,0 +1,45 @@
+// pkg/middleware/identity_test.go
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"user", map[string]string{HeaderUserID: "user-1", HeaderUserRole: "user"}, http.StatusOK},
+		{"key with the scope", map[string]string{HeaderClientID: "key-1", HeaderScopes: "inventory:read inventory:write"}, http.StatusOK},
+		{"key without the scope", map[string]string{HeaderClientID: "key-1", HeaderScopes: "inventory:read"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(Identity())
+			router.POST("/", RequireScope("inventory:write"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// pkg/middleware/ratelimit_keys.go
+
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc returns the key a request is counted under. Requests for which it
+// returns an empty string are not limited.
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP counts requests per client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser counts requests per authenticated user and skips anonymous requests
+func KeyByUser(c *gin.Context) string {
+	if userID := UserID(c); userID != "" {
+		return "user:" + userID
+	}
+	return ""
+}
+
+// KeyByAPIKey counts requests per API key and skips requests without one
+func KeyByAPIKey(c *gin.Context) string {
+	if clientID := ClientID(c); clientID != "" {
+		return "apikey:" + clientID
+	}
+	return ""
+}
+
+// KeyByRoute counts requests per method and route template, so every client
+// shares one quota for the route
+func KeyByRoute(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		route = c.Request.URL.Path
+	}
+	return "route:" + c.Request.Method + " " + route
+}
+
+// KeyByClient counts requests per API key or user, falling back to the client
+// IP for anonymous requests
+func KeyByClient(c *gin.Context) string {
+	if key := KeyByAPIKey(c); key != "" {
+		return key
+	}
+	if key := KeyByUser(c); key != "" {
+		return key
+	}
+	return KeyByIP(c)
+}
+
+// CombineKeys counts requests per combination of keys, e.g. per IP and route.
+// A request is skipped when any of the keys is empty.
+func CombineKeys(fns ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) string {
+		parts := make([]string, 0, len(fns))
+		for _, fn := range fns {
+			part := fn(c)
+			if part == "" {
+				return ""
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, "|")
+	}
+}
+
+var keyFuncs = map[string]KeyFunc{
+	"ip":      KeyByIP,
+	"user":    KeyByUser,
+	"api_key": KeyByAPIKey,
+	"route":   KeyByRoute,
+	"client":  KeyByClient,
+}
+
+// ParseKey returns the key function named by spec: ip, user, api_key, route or
+// client, or several of them joined with +, e.g. "ip+route". An empty spec keys by IP.
+func ParseKey(spec string) (KeyFunc, error) {
+	if spec == "" {
+		return KeyByIP, nil
+	}
+
+	names := strings.Split(spec, "+")
+	fns := make([]KeyFunc, 0, len(names))
+	for _, name := range names {
+		fn, ok := keyFuncs[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown rate limit key %q", name)
+		}
+		fns = append(fns, fn)
+	}
+	if len(fns) == 1 {
+		return fns[0], nil
+	}
+	return CombineKeys(fns...), nil
+}
@@ -0,0 +1,77 @@
+// pkg/middleware/ratelimit_local.go
+
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// localSweepSize is the number of tracked clients above which idle buckets are dropped
+const localSweepSize = 10000
+
+// localBucket is the token bucket of one client
+type localBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// localLimiter is an in-memory token bucket per client. It only sees the
+// requests of its own process, so it is a degraded stand-in for Redis.
+type localLimiter struct {
+	capacity float64
+	window   time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*localBucket
+}
+
+func newLocalLimiter(maxRequests int, window time.Duration) *localLimiter {
+	return &localLimiter{
+		capacity: float64(maxRequests),
+		window:   window,
+		buckets:  make(map[string]*localBucket),
+	}
+}
+
+// allow counts one request for key, refilling its bucket over the window
+func (l *localLimiter) allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if len(l.buckets) >= localSweepSize {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &localBucket{tokens: l.capacity, last: now}
+		l.buckets[key] = bucket
+	}
+
+	rate := l.capacity / float64(l.window)
+	bucket.tokens = math.Min(l.capacity, bucket.tokens+float64(now.Sub(bucket.last))*rate)
+	bucket.last = now
+
+	result := Result{Limit: int(l.capacity)}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+		result.Remaining = int(bucket.tokens)
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	}
+	result.Reset = time.Duration(math.Ceil((l.capacity - bucket.tokens) / rate))
+	return result
+}
+
+// sweep drops buckets that have been idle long enough to be full again. l.mu must be held.
+func (l *localLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= l.window {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -4,63 +4,322 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"e-commerce-platform/pkg/metrics"
+
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
 
+// Algorithm decides how requests are counted against a limit
+type Algorithm string
+
+const (
+	// FixedWindow counts requests in consecutive windows that start with the first request
+	FixedWindow Algorithm = "fixed_window"
+	// SlidingWindow keeps a log of request times and admits a request when fewer
+	// than the limit fall within the last window
+	SlidingWindow Algorithm = "sliding_window"
+	// TokenBucket refills the limit over the window and allows bursts up to the limit
+	TokenBucket Algorithm = "token_bucket"
+)
+
+// ParseAlgorithm returns the named algorithm, defaulting to SlidingWindow for an empty name
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch Algorithm(name) {
+	case "":
+		return SlidingWindow, nil
+	case FixedWindow, SlidingWindow, TokenBucket:
+		return Algorithm(name), nil
+	default:
+		return "", fmt.Errorf("unknown rate limit algorithm %q", name)
+	}
+}
+
+// FailurePolicy decides what happens to requests while Redis cannot be reached
+type FailurePolicy string
+
+const (
+	// FailOpen lets requests through unlimited
+	FailOpen FailurePolicy = "open"
+	// FailClosed rejects requests with 503 RATE_LIMIT_UNAVAILABLE
+	FailClosed FailurePolicy = "closed"
+	// FailLocal enforces the limit with an in-memory token bucket per process
+	FailLocal FailurePolicy = "local"
+)
+
+// ParseFailurePolicy returns the named policy, defaulting to FailLocal for an empty name
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	switch FailurePolicy(name) {
+	case "":
+		return FailLocal, nil
+	case FailOpen, FailClosed, FailLocal:
+		return FailurePolicy(name), nil
+	default:
+		return "", fmt.Errorf("unknown rate limit failure policy %q", name)
+	}
+}
+
+// errNoRedis stands in for a Redis error when a limiter has no client
+var errNoRedis = errors.New("no Redis client")
+
+// Rate limit response headers
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// The scripts read the clock from Redis so every gateway and service instance
+// agrees on it, and return {allowed, remaining, retry after ms, reset ms}.
+var (
+	fixedWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+  redis.call('PEXPIRE', KEYS[1], window)
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+  redis.call('PEXPIRE', KEYS[1], window)
+  ttl = window
+end
+if count > limit then
+  return {0, 0, ttl, ttl}
+end
+return {1, limit - count, 0, ttl}
+`)
+
+	slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[3])
+  redis.call('PEXPIRE', KEYS[1], window)
+  count = count + 1
+  allowed = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local reset = tonumber(oldest[2]) + window - now
+if allowed == 1 then
+  return {1, limit - count, 0, reset}
+end
+return {0, 0, reset, reset}
+`)
+
+	tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local rate = capacity / window
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = capacity
+  ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window)
+local reset = math.ceil((capacity - tokens) / rate)
+if allowed == 1 then
+  return {1, math.floor(tokens), 0, reset}
+end
+return {0, 0, math.ceil((1 - tokens) / rate), reset}
+`)
+)
+
+// Result is the outcome of one rate limit check
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a rejected client should wait before trying again
+	RetryAfter time.Duration
+	// Reset is how long until the full limit is available again
+	Reset time.Duration
+}
+
 type RateLimiter struct {
-	redisClient *redis.Client
-	maxRequests int
-	window      time.Duration
+	redisClient   *redis.Client
+	maxRequests   int
+	window        time.Duration
+	keyPrefix     string
+	tier          string
+	algorithm     Algorithm
+	clientKey     KeyFunc
+	failurePolicy FailurePolicy
+	local         *localLimiter
 }
 
+// NewRateLimiter allows maxRequests per window and client IP, counted with a
+// sliding window. While Redis is unreachable the limit is enforced per process.
+// With a nil client, every request is handled by the failure policy.
 func NewRateLimiter(redisClient *redis.Client, maxRequests int, window time.Duration) *RateLimiter {
 	return &RateLimiter{
-		redisClient: redisClient,
-		maxRequests: maxRequests,
-		window:      window,
+		redisClient:   redisClient,
+		maxRequests:   maxRequests,
+		window:        window,
+		keyPrefix:     "rate_limit",
+		tier:          "default",
+		algorithm:     SlidingWindow,
+		clientKey:     KeyByIP,
+		failurePolicy: FailLocal,
+		local:         newLocalLimiter(maxRequests, window),
 	}
 }
 
-func (rl *RateLimiter) Middleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get client IP or API key (you can modify this based on your authentication)
-		clientID := c.ClientIP()
+// NewTierRateLimiter creates a rate limiter whose counters are kept apart from other tiers
+func NewTierRateLimiter(redisClient *redis.Client, tier string, maxRequests int, window time.Duration) *RateLimiter {
+	rl := NewRateLimiter(redisClient, maxRequests, window)
+	rl.keyPrefix = fmt.Sprintf("rate_limit:%s", tier)
+	rl.tier = tier
+	return rl
+}
 
-		// Create a key for Redis
-		key := fmt.Sprintf("rate_limit:%s", clientID)
+// WithClientKey counts requests per value returned by fn instead of per client IP.
+// Requests for which fn returns an empty string are not limited.
+func (rl *RateLimiter) WithClientKey(fn KeyFunc) *RateLimiter {
+	rl.clientKey = fn
+	return rl
+}
 
-		// Get the current count
-		ctx := context.Background()
-		count, err := rl.redisClient.Get(ctx, key).Int()
-		if err != nil && err != redis.Nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limiting error"})
-			c.Abort()
-			return
+// WithFailurePolicy sets how requests are handled while Redis is unreachable
+func (rl *RateLimiter) WithFailurePolicy(policy FailurePolicy) *RateLimiter {
+	rl.failurePolicy = policy
+	return rl
+}
+
+// WithAlgorithm counts requests with the given algorithm instead of a sliding window
+func (rl *RateLimiter) WithAlgorithm(algorithm Algorithm) *RateLimiter {
+	rl.algorithm = algorithm
+	return rl
+}
+
+// Allow atomically counts one request for clientID and reports whether it is within the limit
+func (rl *RateLimiter) Allow(ctx context.Context, clientID string) (Result, error) {
+	key := fmt.Sprintf("%s:%s:%s", rl.keyPrefix, rl.algorithm, clientID)
+	window := rl.window.Milliseconds()
+
+	var values []int64
+	var err error
+	switch rl.algorithm {
+	case FixedWindow:
+		values, err = fixedWindowScript.Run(ctx, rl.redisClient, []string{key}, rl.maxRequests, window).Int64Slice()
+	case TokenBucket:
+		values, err = tokenBucketScript.Run(ctx, rl.redisClient, []string{key}, rl.maxRequests, window).Int64Slice()
+	default:
+		values, err = slidingWindowScript.Run(ctx, rl.redisClient, []string{key}, rl.maxRequests, window, requestMember()).Int64Slice()
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(values) != 4 {
+		return Result{}, fmt.Errorf("failed to check rate limit: unexpected script result %v", values)
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      rl.maxRequests,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// requestMember returns a unique sliding window log entry, so requests within
+// the same millisecond are all counted
+func requestMember() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// SetRateLimitHeaders describes the client's quota on the response. Retry-After
+// is only set on rejected requests.
+func SetRateLimitHeaders(c *gin.Context, result Result) {
+	c.Header(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	c.Header(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	c.Header(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
 		}
+		c.Header(HeaderRetryAfter, strconv.Itoa(retryAfter))
+	}
+}
 
-		if count >= rl.maxRequests {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded",
-				"code":  "RATE_LIMIT_EXCEEDED",
-			})
-			c.Abort()
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID := rl.clientKey(c)
+		if clientID == "" {
+			c.Next()
 			return
 		}
 
-		// Increment the counter
-		pipe := rl.redisClient.Pipeline()
-		pipe.Incr(ctx, key)
-		if count == 0 {
-			pipe.Expire(ctx, key, rl.window)
+		// Without Redis the failure policy applies to every request, which is
+		// expected rather than an error
+		var result Result
+		var err error
+		if rl.redisClient == nil {
+			err = errNoRedis
+		} else if result, err = rl.Allow(c.Request.Context(), clientID); err != nil {
+			metrics.RateLimitErrors.WithLabelValues(rl.tier, string(rl.failurePolicy)).Inc()
+			log.Printf("Rate limiter %s unavailable, failing %s: %v", rl.tier, rl.failurePolicy, err)
 		}
-		_, err = pipe.Exec(ctx)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Rate limiting error"})
+			switch rl.failurePolicy {
+			case FailOpen:
+				c.Next()
+				return
+			case FailClosed:
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+					"error": "Rate limiting unavailable",
+					"code":  "RATE_LIMIT_UNAVAILABLE",
+				})
+				return
+			default:
+				result = rl.local.allow(clientID)
+			}
+		}
+
+		SetRateLimitHeaders(c, result)
+		if !result.Allowed {
+			metrics.RateLimitRejections.WithLabelValues(rl.tier).Inc()
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Rate limit exceeded",
+				"code":  "RATE_LIMIT_EXCEEDED",
+			})
 			c.Abort()
 			return
 		}
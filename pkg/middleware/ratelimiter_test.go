@@ -0,0 +1,150 @@
+// pkg/middleware/ratelimiter_test.go
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+var algorithms = []Algorithm{FixedWindow, SlidingWindow, TokenBucket}
+
+// newTestRedis starts a Redis stand-in whose clock is frozen, so the scripts
+// see no time pass between requests
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	server.SetTime(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestAllowConcurrentBurst(t *testing.T) {
+	const limit, burst = 10, 50
+
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			rl := NewRateLimiter(newTestRedis(t), limit, time.Minute).WithAlgorithm(algorithm)
+
+			var allowed atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < burst; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					result, err := rl.Allow(context.Background(), "client")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if result.Allowed {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := allowed.Load(); got != limit {
+				t.Fatalf("allowed %d of %d requests, want %d", got, burst, limit)
+			}
+			// Other clients have their own quota
+			result, err := rl.Allow(context.Background(), "other")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Allowed {
+				t.Fatal("request of another client was rejected")
+			}
+		})
+	}
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// A token bucket of 2 per minute refills one token every 30 seconds
+	tests := []struct {
+		algorithm  Algorithm
+		retryAfter string
+	}{
+		{FixedWindow, "60"},
+		{SlidingWindow, "60"},
+		{TokenBucket, "30"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			rl := NewRateLimiter(newTestRedis(t), 2, time.Minute).WithAlgorithm(tt.algorithm)
+			router := gin.New()
+			router.GET("/", rl.Middleware(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			want := []struct {
+				status     int
+				remaining  string
+				retryAfter string
+			}{
+				{http.StatusOK, "1", ""},
+				{http.StatusOK, "0", ""},
+				{http.StatusTooManyRequests, "0", tt.retryAfter},
+			}
+			for i, w := range want {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+				if rec.Code != w.status {
+					t.Errorf("request %d: status %d, want %d", i+1, rec.Code, w.status)
+				}
+				if got := rec.Header().Get(HeaderRateLimitLimit); got != "2" {
+					t.Errorf("request %d: %s %q, want 2", i+1, HeaderRateLimitLimit, got)
+				}
+				if got := rec.Header().Get(HeaderRateLimitRemaining); got != w.remaining {
+					t.Errorf("request %d: %s %q, want %q", i+1, HeaderRateLimitRemaining, got, w.remaining)
+				}
+				if got := rec.Header().Get(HeaderRetryAfter); got != w.retryAfter {
+					t.Errorf("request %d: %s %q, want %q", i+1, HeaderRetryAfter, got, w.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithoutRedis(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		policy FailurePolicy
+		want   []int
+	}{
+		{FailLocal, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{FailClosed, []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}},
+		{FailOpen, []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			rl := NewRateLimiter(nil, 2, time.Minute).WithFailurePolicy(tt.policy)
+			router := gin.New()
+			router.GET("/", rl.Middleware(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			for i, want := range tt.want {
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rec.Code != want {
+					t.Errorf("request %d: status %d, want %d", i+1, rec.Code, want)
+				}
+			}
+		})
+	}
+}
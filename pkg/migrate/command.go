@@ -0,0 +1,87 @@
+// pkg/migrate/command.go
+
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// Usage describes the arguments of Command
+const Usage = `usage: migrate <command>
+  status        list migrations and whether they are applied
+  up            apply all pending migrations
+  down [steps]  revert the last steps migrations, 1 by default
+  to <version>  migrate up or down to version, 0 reverts all`
+
+// Command runs the migrate command given by args, e.g. ["down", "2"], and
+// writes its output to out
+func Command(ctx context.Context, m *Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(Usage)
+	}
+
+	switch command, rest := args[0], args[1:]; command {
+	case "status":
+		if len(rest) != 0 {
+			return errors.New(Usage)
+		}
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return w.Flush()
+
+	case "up":
+		if len(rest) != 0 {
+			return errors.New(Usage)
+		}
+		applied, err := m.Up(ctx)
+		fmt.Fprintf(out, "applied %d migrations\n", applied)
+		return err
+
+	case "down":
+		steps := 1
+		if len(rest) > 1 {
+			return errors.New(Usage)
+		}
+		if len(rest) == 1 {
+			var err error
+			if steps, err = strconv.Atoi(rest[0]); err != nil || steps <= 0 {
+				return fmt.Errorf("steps must be a positive number, got %q", rest[0])
+			}
+		}
+		reverted, err := m.Down(ctx, steps)
+		fmt.Fprintf(out, "reverted %d migrations\n", reverted)
+		return err
+
+	case "to":
+		if len(rest) != 1 {
+			return errors.New(Usage)
+		}
+		version, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil || version < 0 {
+			return fmt.Errorf("version must be a migration version, got %q", rest[0])
+		}
+		changed, err := m.To(ctx, version)
+		fmt.Fprintf(out, "applied or reverted %d migrations\n", changed)
+		return err
+
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, Usage)
+	}
+}
@@ -0,0 +1,69 @@
+// pkg/migrate/command_test.go
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		// before are commands run first
+		before [][]string
+		args   []string
+		// out is part of the output, err part of the error, empty when there is none
+		out string
+		err string
+		// applied are the versions applied afterwards
+		applied int
+	}{
+		{"no command", nil, nil, "", "usage: migrate <command>", 0},
+		{"unknown command", nil, []string{"sideways"}, "", `unknown command "sideways"`, 0},
+		{"status", [][]string{{"to", "1"}}, []string{"status"}, "1        create_a", "", 1},
+		{"status pending", nil, []string{"status"}, "2        create_b  pending", "", 0},
+		{"status with an argument", nil, []string{"status", "all"}, "", "usage", 0},
+		{"up", nil, []string{"up"}, "applied 2 migrations", "", 2},
+		{"up with an argument", nil, []string{"up", "1"}, "", "usage", 0},
+		{"down one by default", [][]string{{"up"}}, []string{"down"}, "reverted 1 migrations", "", 1},
+		{"down steps", [][]string{{"up"}}, []string{"down", "2"}, "reverted 2 migrations", "", 0},
+		{"down zero steps", [][]string{{"up"}}, []string{"down", "0"}, "", `steps must be a positive number, got "0"`, 2},
+		{"down not a number", [][]string{{"up"}}, []string{"down", "all"}, "", `steps must be a positive number, got "all"`, 2},
+		{"down two arguments", [][]string{{"up"}}, []string{"down", "1", "2"}, "", "usage", 2},
+		{"to", nil, []string{"to", "1"}, "applied or reverted 1 migrations", "", 1},
+		{"to 0", [][]string{{"up"}}, []string{"to", "0"}, "applied or reverted 2 migrations", "", 0},
+		{"to without a version", nil, []string{"to"}, "", "usage", 0},
+		{"to a negative version", nil, []string{"to", "-1"}, "", `version must be a migration version, got "-1"`, 0},
+		{"to an unknown version", nil, []string{"to", "9"}, "", "unknown migration version 9", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			m, _, _ := newTestMigrator(t, reversibleMigrations)
+			for _, args := range tt.before {
+				var out bytes.Buffer
+				if err := Command(ctx, m, args, &out); err != nil {
+					t.Fatalf("%v: %v", args, err)
+				}
+			}
+
+			var out bytes.Buffer
+			err := Command(ctx, m, tt.args, &out)
+			if tt.err == "" && err != nil {
+				t.Errorf("error %v, want none", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+			if !strings.Contains(out.String(), tt.out) {
+				t.Errorf("output %q does not contain %q", out.String(), tt.out)
+			}
+			if got := appliedVersions(t, m); len(got) != tt.applied {
+				t.Errorf("applied versions %v, want %d", got, tt.applied)
+			}
+		})
+	}
+}
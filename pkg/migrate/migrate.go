@@ -0,0 +1,366 @@
+// pkg/migrate/migrate.go
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"e-commerce-platform/pkg/logging"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaBehind is returned by Check when migrations are pending
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// fileName matches migration files such as 0001_create_orders.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change. Up and Down are run in a
+// transaction, so they cannot contain statements such as CREATE INDEX
+// CONCURRENTLY.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and when it was applied, nil when pending
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations of fsys. Versions count up from 1 without gaps, and
+// every version needs an up file; a missing down file makes the migration
+// irreversible.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, want <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+		script := &migration.Up
+		if match[3] == "down" {
+			script = &migration.Down
+		}
+		// 1_x.up.sql and 0001_x.up.sql are the same migration
+		if *script != "" {
+			return nil, fmt.Errorf("migration %d_%s has two %s files", version, migration.Name, match[3])
+		}
+		*script = string(data)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	// A gap is usually a migration lost in a merge
+	for i, migration := range migrations {
+		if want := int64(i + 1); migration.Version != want {
+			return nil, fmt.Errorf("migration %d is missing, the next is %d_%s", want, migration.Version, migration.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator applies the migrations of one service and records them in the
+// schema_migrations table. Changes hold a Postgres advisory lock, so replicas
+// starting together apply each migration once.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	lockKey    int64
+}
+
+// New creates a migrator for the migrations in fsys. name identifies the
+// service in the advisory lock.
+func New(db *gorm.DB, fsys fs.FS, name string) (*Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte("schema_migrations:" + name))
+	return &Migrator{db: sqlDB, migrations: migrations, lockKey: int64(hash.Sum64())}, nil
+}
+
+// Status lists every known migration with when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied, in order
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+	return m.pending(applied), nil
+}
+
+// Check returns ErrSchemaBehind when migrations are pending. Applied
+// migrations this build does not know are fine, so replicas of the previous
+// release keep running while a newer one migrates.
+func (m *Migrator) Check(ctx context.Context) error {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations, the first is %d_%s",
+			ErrSchemaBehind, len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// Up applies every pending migration and returns how many were applied
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	return m.To(ctx, m.latest())
+}
+
+// Down reverts the last steps applied migrations and returns how many were reverted
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+	reverted := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// To migrates up or down until version is the last applied migration and
+// returns how many migrations were applied or reverted. Version 0 reverts all.
+func (m *Migrator) To(ctx context.Context, version int64) (int, error) {
+	if version != 0 && m.find(version) < 0 {
+		return 0, fmt.Errorf("unknown migration version %d", version)
+	}
+	changed := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		// Revert newer migrations first, newest first
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+			changed++
+		}
+		for _, migration := range m.pending(applied) {
+			if migration.Version > version {
+				break
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// apply runs the up migration and records it in one transaction
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	logging.Logger.Info("applying migration", "version", migration.Version, "name", migration.Name)
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			migration.Version, migration.Name, time.Now().UTC())
+		return err
+	})
+}
+
+// revert runs the down migration and forgets it in one transaction
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s cannot be reverted, it has no down file", migration.Version, migration.Name)
+	}
+	logging.Logger.Info("reverting migration", "version", migration.Version, "name", migration.Name)
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+		return err
+	})
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// withLock runs fn on one connection holding the advisory lock of the service,
+// after creating the schema_migrations table if needed
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Advisory locks belong to the session, so lock and unlock on the same connection
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", m.lockKey)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// querier is a *sql.DB or *sql.Conn
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// applied returns when each applied migration was applied, by version
+func (m *Migrator) applied(ctx context.Context, db querier) (map[int64]time.Time, error) {
+	// Before the first migration there is no schema_migrations table
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied := make(map[int64]time.Time)
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// pending returns the known migrations that are not in applied, in order
+func (m *Migrator) pending(applied map[int64]time.Time) []Migration {
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+func (m *Migrator) find(version int64) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// latest returns the newest known version, 0 without migrations
+func (m *Migrator) latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
@@ -0,0 +1,307 @@
+// pkg/migrate/migrate_test.go
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// postgresStatements are the Postgres statements of the migrator and what
+// they become on SQLite
+var postgresStatements = strings.NewReplacer(
+	"pg_advisory_lock", "abs",
+	"pg_advisory_unlock", "abs",
+	"to_regclass('schema_migrations') IS NOT NULL", "EXISTS (SELECT 1 FROM sqlite_master WHERE name = 'schema_migrations')",
+	"TIMESTAMPTZ", "DATETIME",
+)
+
+// postgresConnector opens SQLite connections that understand the Postgres
+// statements of the migrator, and records the advisory lock calls
+type postgresConnector struct {
+	driver driver.Driver
+
+	mu    sync.Mutex
+	locks []string
+}
+
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{Conn: conn, connector: c}, nil
+}
+
+func (c *postgresConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// lockCalls returns the advisory lock calls so far
+func (c *postgresConnector) lockCalls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.locks...)
+}
+
+type postgresConn struct {
+	driver.Conn
+	connector *postgresConnector
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	for _, call := range []string{"pg_advisory_unlock", "pg_advisory_lock"} {
+		if strings.Contains(query, call) {
+			c.connector.mu.Lock()
+			c.connector.locks = append(c.connector.locks, call)
+			c.connector.mu.Unlock()
+			break
+		}
+	}
+	return c.Conn.Prepare(postgresStatements.Replace(query))
+}
+
+// newTestMigrator creates a migrator for the migrations in fsys, on an
+// in-memory database
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) (*Migrator, *sql.DB, *postgresConnector) {
+	t.Helper()
+	// The driver registered by glebarez/sqlite
+	probe, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector := &postgresConnector{driver: probe.Driver()}
+	probe.Close()
+
+	sqlDB := sql.OpenDB(connector)
+	// Every connection would open its own empty in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(&sqlite.Dialector{Conn: sqlDB}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(db, fsys, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, sqlDB, connector
+}
+
+// testMigrations create the tables a, b and c. The last one has no down file.
+var testMigrations = fstest.MapFS{
+	"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);\nCREATE INDEX a_id ON a (id);")},
+	"0001_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	"0002_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	"0003_create_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+}
+
+// reversibleMigrations are testMigrations without the irreversible migration 3
+var reversibleMigrations = fstest.MapFS{
+	"0001_create_a.up.sql":   testMigrations["0001_create_a.up.sql"],
+	"0001_create_a.down.sql": testMigrations["0001_create_a.down.sql"],
+	"0002_create_b.up.sql":   testMigrations["0002_create_b.up.sql"],
+	"0002_create_b.down.sql": testMigrations["0002_create_b.down.sql"],
+}
+
+// tables returns the tables of db other than schema_migrations, in order
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations' ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// appliedVersions returns the versions Status reports as applied
+func appliedVersions(t *testing.T, m *Migrator) []int64 {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int64
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+func TestLoad(t *testing.T) {
+	script := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name  string
+		files []string
+		// want is the error, empty when the files are valid
+		want string
+	}{
+		{"valid", []string{"0001_a.up.sql", "0001_a.down.sql", "0002_b.up.sql", "0002_b.down.sql"}, ""},
+		{"missing down file", []string{"0001_a.up.sql", "0002_b.up.sql", "0002_b.down.sql"}, ""},
+		{"unpadded version", []string{"1_a.up.sql", "2_b.up.sql"}, ""},
+		{"missing up file", []string{"0001_a.up.sql", "0002_b.down.sql"}, "migration 2_b has no up file"},
+		{"gap", []string{"0001_a.up.sql", "0003_c.up.sql"}, "migration 2 is missing, the next is 3_c"},
+		{"first version missing", []string{"0002_b.up.sql"}, "migration 1 is missing, the next is 2_b"},
+		{"version 0", []string{"0000_a.up.sql"}, `invalid migration version in "0000_a.up.sql"`},
+		{"two names", []string{"0001_a.up.sql", "0001_b.up.sql"}, "migration 1 has two names, a and b"},
+		{"duplicate version", []string{"0001_a.up.sql", "1_a.up.sql"}, "migration 1_a has two up files"},
+		{"invalid name", []string{"0001_Create.up.sql"}, `invalid migration file name "0001_Create.up.sql"`},
+		{"not a migration", []string{"0001_a.up.sql", "README.md"}, `invalid migration file name "README.md"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range tt.files {
+				fsys[name] = script
+			}
+			migrations, err := Load(fsys)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("error %v, want none", err)
+				}
+				for i, migration := range migrations {
+					if migration.Version != int64(i+1) {
+						t.Errorf("migration %d has version %d, want %d", i, migration.Version, i+1)
+					}
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpDownTo(t *testing.T) {
+	ctx := context.Background()
+	m, db, connector := newTestMigrator(t, testMigrations)
+
+	if err := m.Check(ctx); err == nil {
+		t.Error("Check passed before the first migration")
+	}
+	applied, err := m.Up(ctx)
+	if err != nil || applied != 3 {
+		t.Fatalf("Up applied %d migrations, error %v, want 3", applied, err)
+	}
+	if got := tables(t, db); strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("tables %v after Up, want a, b and c", got)
+	}
+	if err := m.Check(ctx); err != nil {
+		t.Errorf("Check after Up: %v", err)
+	}
+	if applied, err := m.Up(ctx); err != nil || applied != 0 {
+		t.Errorf("second Up applied %d migrations, error %v, want none", applied, err)
+	}
+
+	// The last migration has no down file, so it stays applied
+	reverted, err := m.Down(ctx, 1)
+	if err == nil || !strings.Contains(err.Error(), "migration 3_create_c cannot be reverted") {
+		t.Errorf("Down error %v, want migration 3 reported as irreversible", err)
+	}
+	if reverted != 0 {
+		t.Errorf("Down reverted %d migrations, want none", reverted)
+	}
+
+	changed, err := m.To(ctx, 2)
+	if err == nil || changed != 0 {
+		t.Errorf("To(2) changed %d migrations, error %v, want migration 3 to stop it", changed, err)
+	}
+	if got := appliedVersions(t, m); len(got) != 3 {
+		t.Errorf("applied versions %v after a failed revert, want all 3", got)
+	}
+
+	calls := connector.lockCalls()
+	if len(calls) == 0 || len(calls)%2 != 0 {
+		t.Fatalf("lock calls %v, want a lock and an unlock per change", calls)
+	}
+	for i := 0; i < len(calls); i += 2 {
+		if calls[i] != "pg_advisory_lock" || calls[i+1] != "pg_advisory_unlock" {
+			t.Errorf("lock calls %v, want each lock released before the next", calls)
+			break
+		}
+	}
+}
+
+func TestTo(t *testing.T) {
+	ctx := context.Background()
+	m, db, _ := newTestMigrator(t, reversibleMigrations)
+
+	steps := []struct {
+		name    string
+		run     func() (int, error)
+		changed int
+		tables  string
+	}{
+		{"to 1", func() (int, error) { return m.To(ctx, 1) }, 1, "a"},
+		{"to 2", func() (int, error) { return m.To(ctx, 2) }, 1, "a,b"},
+		{"to 2 again", func() (int, error) { return m.To(ctx, 2) }, 0, "a,b"},
+		{"down", func() (int, error) { return m.Down(ctx, 1) }, 1, "a"},
+		{"up", func() (int, error) { return m.Up(ctx) }, 1, "a,b"},
+		{"down past the first", func() (int, error) { return m.Down(ctx, 5) }, 2, ""},
+		{"to 2 from nothing", func() (int, error) { return m.To(ctx, 2) }, 2, "a,b"},
+		{"to 0", func() (int, error) { return m.To(ctx, 0) }, 2, ""},
+	}
+	for _, step := range steps {
+		changed, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if changed != step.changed {
+			t.Errorf("%s changed %d migrations, want %d", step.name, changed, step.changed)
+		}
+		if got := strings.Join(tables(t, db), ","); got != step.tables {
+			t.Errorf("%s left tables %q, want %q", step.name, got, step.tables)
+		}
+	}
+
+	if _, err := m.To(ctx, 7); err == nil || !strings.Contains(err.Error(), "unknown migration version 7") {
+		t.Errorf("To(7) error %v, want an unknown version", err)
+	}
+	if _, err := m.Down(ctx, 0); err == nil {
+		t.Error("Down(0) succeeded")
+	}
+}
+
+func TestFailedMigrationLeavesNoTrace(t *testing.T) {
+	ctx := context.Background()
+	m, db, _ := newTestMigrator(t, fstest.MapFS{
+		"0001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"0002_broken.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);\nINSERT INTO missing VALUES (1);")},
+	})
+
+	applied, err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "migration 2_broken failed") {
+		t.Errorf("Up error %v, want migration 2 to fail", err)
+	}
+	if applied != 1 {
+		t.Errorf("Up applied %d migrations, want 1", applied)
+	}
+	if got := strings.Join(tables(t, db), ","); got != "a" {
+		t.Errorf("tables %q, want only a", got)
+	}
+	if got := appliedVersions(t, m); len(got) != 1 || got[0] != 1 {
+		t.Errorf("applied versions %v, want only 1", got)
+	}
+}
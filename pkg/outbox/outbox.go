@@ -0,0 +1,84 @@
+// pkg/outbox/outbox.go
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"e-commerce-platform/pkg/events"
+
+	"gorm.io/gorm"
+)
+
+// Message is an event waiting in the outbox table to be published. The
+// auto-incrementing ID orders messages in commit order within a service, see
+// Add. Each service creates the table in its own migrations.
+type Message struct {
+	ID        uint64 `gorm:"primaryKey;autoIncrement"`
+	EventID   string `gorm:"size:36;not null;uniqueIndex"`
+	EventType string `gorm:"not null"`
+	// Event is the JSON encoded envelope as it is published
+	Event       string `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+	PublishedAt *time.Time `gorm:"index"`
+	// Attempts counts failed publishes, LastError is the error of the last one
+	Attempts  int
+	LastError string
+}
+
+// TableName keeps the table name independent of the struct name
+func (Message) TableName() string {
+	return "outbox"
+}
+
+// writeLockKey is the Postgres advisory lock that serializes outbox writers
+const writeLockKey = 0x6f7574626f78 // "outbox"
+
+// Add writes events to the outbox. Call it with the transaction of the writes
+// the events describe, so the events are published if and only if it commits.
+//
+// Sequence values are handed out before commit, so a transaction could take an
+// ID and commit after a later one, and the relay would publish the later
+// message first. On Postgres, Add therefore holds an advisory lock until tx
+// ends: the next writer gets its IDs only once this transaction has committed
+// or rolled back. Other databases, such as SQLite in tests, serialize writers
+// by themselves. Add events at the end of the transaction to hold the lock briefly.
+func Add(tx *gorm.DB, evts ...events.Event) error {
+	if len(evts) == 0 {
+		return nil
+	}
+	if tx.Dialector.Name() == "postgres" {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", writeLockKey).Error; err != nil {
+			return fmt.Errorf("failed to lock the outbox: %w", err)
+		}
+	}
+	messages := make([]Message, len(evts))
+	for i, event := range evts {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+		}
+		messages[i] = Message{EventID: event.ID, EventType: event.Type, Event: string(data)}
+	}
+	if err := tx.Create(&messages).Error; err != nil {
+		return fmt.Errorf("failed to write events to the outbox: %w", err)
+	}
+	return nil
+}
+
+// Emit creates an event and writes it to the outbox within tx. The
+// correlation ID is taken from the transaction's context.
+func Emit(tx *gorm.DB, source, eventType string, data any) error {
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	event, err := events.New(ctx, source, eventType, data)
+	if err != nil {
+		return err
+	}
+	return Add(tx, event)
+}
@@ -0,0 +1,129 @@
+// pkg/outbox/outbox_test.go
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"e-commerce-platform/pkg/events"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory database with the outbox table
+func newTestDB(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own empty in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&Message{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newEvents creates count events of eventType
+func newEvents(t *testing.T, eventType string, count int) []events.Event {
+	t.Helper()
+	evts := make([]events.Event, count)
+	for i := range evts {
+		event, err := events.New(context.Background(), "test", eventType, map[string]int{"n": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		evts[i] = event
+	}
+	return evts
+}
+
+// postgresDialector is SQLite under the name of Postgres, so that Add takes
+// the advisory lock
+type postgresDialector struct {
+	gorm.Dialector
+}
+
+func (postgresDialector) Name() string {
+	return "postgres"
+}
+
+func TestAddLocksTheOutboxOnPostgres(t *testing.T) {
+	db := newTestDB(t, postgresDialector{sqlite.Open(":memory:")})
+
+	// SQLite has no pg_advisory_xact_lock, so the lock is recorded and replaced
+	var mu sync.Mutex
+	var statements []string
+	record := func(name string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			mu.Lock()
+			defer mu.Unlock()
+			if sql := db.Statement.SQL.String(); strings.Contains(sql, "pg_advisory_xact_lock") {
+				statements = append(statements, fmt.Sprintf("lock %v", db.Statement.Vars))
+				db.Statement.SQL.Reset()
+				db.Statement.SQL.WriteString("SELECT 1")
+				db.Statement.Vars = nil
+				return
+			}
+			statements = append(statements, name)
+		}
+	}
+	if err := db.Callback().Raw().Before("gorm:raw").Register("test:raw", record("raw")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register("test:create", record("insert")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return Add(tx, newEvents(t, events.TypeOrderCreated, 2)...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock is taken before the IDs are, within the same transaction
+	want := []string{fmt.Sprintf("lock [%d]", writeLockKey), "insert"}
+	if fmt.Sprint(statements) != fmt.Sprint(want) {
+		t.Errorf("statements %v, want %v", statements, want)
+	}
+	var count int64
+	db.Model(&Message{}).Count(&count)
+	if count != 2 {
+		t.Errorf("outbox holds %d messages, want 2", count)
+	}
+}
+
+func TestAddRollsBackWithTheTransaction(t *testing.T) {
+	db := newTestDB(t, sqlite.Open(":memory:"))
+
+	failed := errors.New("order rejected")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := Emit(tx, "test", events.TypeOrderCreated, map[string]string{"order_id": "1"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("error %v, want %v", err, failed)
+	}
+
+	var count int64
+	db.Model(&Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("outbox holds %d messages of a rolled back transaction, want none", count)
+	}
+}
@@ -0,0 +1,196 @@
+// pkg/outbox/relay.go
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/metrics"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = 500 * time.Millisecond
+	defaultRetention    = 7 * 24 * time.Hour
+	maxRetryBackoff     = 30 * time.Second
+	cleanupInterval     = time.Hour
+)
+
+var (
+	outboxPublished = metrics.NewCounterVec(
+		"outbox_published_total",
+		"Number of outbox events published by the relay, by type.",
+		"type",
+	)
+	outboxPending = metrics.NewGaugeVec(
+		"outbox_pending_messages",
+		"Number of outbox events waiting to be published.",
+	)
+	outboxLag = metrics.NewGaugeVec(
+		"outbox_lag_seconds",
+		"Age of the oldest outbox event waiting to be published.",
+	)
+)
+
+// Relay publishes outbox messages in commit order. Messages are marked
+// published in the transaction that locked them, so a relay that dies after
+// publishing but before committing publishes them again: delivery is at least
+// once and consumers should deduplicate by event ID. Several relays on the same
+// table take turns, so they can run on every replica.
+type Relay struct {
+	db        *gorm.DB
+	publisher events.Publisher
+
+	// BatchSize is the maximum number of messages published at once
+	BatchSize int
+	// PollInterval is how often the relay looks for new messages when idle
+	PollInterval time.Duration
+	// Retention is how long published messages are kept before they are deleted
+	Retention time.Duration
+}
+
+// NewRelay creates a relay that publishes the outbox of db with publisher
+func NewRelay(db *gorm.DB, publisher events.Publisher) *Relay {
+	return &Relay{
+		db:           db,
+		publisher:    publisher,
+		BatchSize:    defaultBatchSize,
+		PollInterval: defaultPollInterval,
+		Retention:    defaultRetention,
+	}
+}
+
+// Run publishes messages until ctx is cancelled. Failed publishes are retried
+// with doubling backoff, and later messages wait so that order is kept.
+func (r *Relay) Run(ctx context.Context) {
+	backoff := r.PollInterval
+	lastCleanup := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(lastCleanup) >= cleanupInterval {
+			if err := r.cleanup(ctx); err != nil && ctx.Err() == nil {
+				logging.Logger.Error("failed to delete published outbox messages", "error", err.Error())
+			}
+			lastCleanup = time.Now()
+		}
+
+		published, err := r.PublishBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.Logger.Error("outbox relay failed", "error", err.Error(), "retry_in", backoff.String())
+			sleep(ctx, backoff)
+			backoff = min(2*backoff, maxRetryBackoff)
+			continue
+		}
+		backoff = r.PollInterval
+		r.observe(ctx)
+
+		// A full batch means more messages are likely waiting
+		if published < r.BatchSize {
+			sleep(ctx, r.PollInterval)
+		}
+	}
+}
+
+// PublishBatch publishes the oldest unpublished messages and returns how many
+// were published
+func (r *Relay) PublishBatch(ctx context.Context) (int, error) {
+	var published int
+	var publishErr error
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the batch makes other relays wait for it instead of publishing
+		// later messages first
+		var messages []Message
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("published_at IS NULL").
+			Order("id").
+			Limit(r.BatchSize).
+			Find(&messages).Error; err != nil {
+			return fmt.Errorf("failed to read outbox: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		batch := make([]events.Event, 0, len(messages))
+		ids := make([]uint64, 0, len(messages))
+		for _, message := range messages {
+			var event events.Event
+			if err := json.Unmarshal([]byte(message.Event), &event); err != nil {
+				// An undecodable message would block the outbox forever, so it is skipped
+				logging.Logger.Error("skipping undecodable outbox message", "id", message.ID, "event_id", message.EventID, "error", err.Error())
+				ids = append(ids, message.ID)
+				continue
+			}
+			batch = append(batch, event)
+			ids = append(ids, message.ID)
+		}
+
+		if len(batch) > 0 {
+			if err := r.publisher.Publish(ctx, batch...); err != nil {
+				// Record the failure on the head of the queue and commit that
+				publishErr = err
+				return tx.Model(&Message{}).Where("id = ?", messages[0].ID).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": err.Error(),
+				}).Error
+			}
+		}
+
+		if err := tx.Model(&Message{}).Where("id IN ?", ids).Update("published_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to mark outbox messages published: %w", err)
+		}
+		for _, event := range batch {
+			outboxPublished.WithLabelValues(event.Type).Inc()
+		}
+		published = len(messages)
+		return nil
+	})
+	if publishErr != nil {
+		return 0, fmt.Errorf("failed to publish outbox messages: %w", publishErr)
+	}
+	return published, err
+}
+
+// observe updates the pending and lag gauges
+func (r *Relay) observe(ctx context.Context) {
+	var pending struct {
+		Count  int64
+		Oldest *time.Time
+	}
+	err := r.db.WithContext(ctx).Model(&Message{}).
+		Select("COUNT(*) AS count, MIN(created_at) AS oldest").
+		Where("published_at IS NULL").
+		Scan(&pending).Error
+	if err != nil {
+		return
+	}
+	outboxPending.WithLabelValues().Set(float64(pending.Count))
+	lag := 0.0
+	if pending.Oldest != nil {
+		lag = time.Since(*pending.Oldest).Seconds()
+	}
+	outboxLag.WithLabelValues().Set(lag)
+}
+
+// cleanup deletes messages published longer ago than the retention
+func (r *Relay) cleanup(ctx context.Context) error {
+	return r.db.WithContext(ctx).
+		Where("published_at < ?", time.Now().Add(-r.Retention)).
+		Delete(&Message{}).Error
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
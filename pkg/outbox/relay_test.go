@@ -0,0 +1,154 @@
+// pkg/outbox/relay_test.go
+
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"e-commerce-platform/pkg/events"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakePublisher records published events and fails while err is set
+type fakePublisher struct {
+	mu        sync.Mutex
+	err       error
+	published []events.Event
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, evts ...events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, evts...)
+	return nil
+}
+
+func (p *fakePublisher) ids() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := make([]string, len(p.published))
+	for i, event := range p.published {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+// addEach writes every event to the outbox in a transaction of its own
+func addEach(t *testing.T, db *gorm.DB, evts []events.Event) {
+	t.Helper()
+	for _, event := range evts {
+		if err := db.Transaction(func(tx *gorm.DB) error { return Add(tx, event) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// eventIDs returns the IDs of evts
+func eventIDs(evts []events.Event) []string {
+	ids := make([]string, len(evts))
+	for i, event := range evts {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRelayPublishesInCommitOrder(t *testing.T) {
+	db := newTestDB(t, sqlite.Open(":memory:"))
+	evts := newEvents(t, events.TypeOrderUpdated, 5)
+	addEach(t, db, evts)
+
+	publisher := &fakePublisher{}
+	relay := NewRelay(db, publisher)
+	relay.BatchSize = 2
+
+	// Batches are taken from the head of the outbox until it is drained
+	for _, want := range []int{2, 2, 1, 0} {
+		published, err := relay.PublishBatch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if published != want {
+			t.Errorf("published %d messages, want %d", published, want)
+		}
+	}
+	if got := publisher.ids(); !equalIDs(got, eventIDs(evts)) {
+		t.Errorf("published %v, want %v", got, eventIDs(evts))
+	}
+
+	var messages []Message
+	if err := db.Order("id").Find(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		if message.PublishedAt == nil {
+			t.Errorf("message %d is not marked published", message.ID)
+		}
+	}
+}
+
+func TestRelayRetriesAfterPublishFailure(t *testing.T) {
+	db := newTestDB(t, sqlite.Open(":memory:"))
+	evts := newEvents(t, events.TypePaymentCompleted, 3)
+	addEach(t, db, evts)
+
+	unavailable := errors.New("redis unavailable")
+	publisher := &fakePublisher{err: unavailable}
+	relay := NewRelay(db, publisher)
+
+	if _, err := relay.PublishBatch(context.Background()); !errors.Is(err, unavailable) {
+		t.Fatalf("error %v, want %v", err, unavailable)
+	}
+
+	// The failure is recorded on the head of the outbox and nothing is marked published
+	var messages []Message
+	if err := db.Order("id").Find(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, message := range messages {
+		if message.PublishedAt != nil {
+			t.Errorf("message %d is marked published after a failed publish", message.ID)
+		}
+		wantAttempts, wantError := 0, ""
+		if i == 0 {
+			wantAttempts, wantError = 1, unavailable.Error()
+		}
+		if message.Attempts != wantAttempts || message.LastError != wantError {
+			t.Errorf("message %d records %d attempts and error %q, want %d and %q", message.ID, message.Attempts, message.LastError, wantAttempts, wantError)
+		}
+	}
+
+	// The next batch publishes every message, still in order
+	publisher.mu.Lock()
+	publisher.err = nil
+	publisher.mu.Unlock()
+	published, err := relay.PublishBatch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published != len(evts) {
+		t.Errorf("published %d messages, want %d", published, len(evts))
+	}
+	if got := publisher.ids(); !equalIDs(got, eventIDs(evts)) {
+		t.Errorf("published %v, want %v", got, eventIDs(evts))
+	}
+}
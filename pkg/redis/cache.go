@@ -0,0 +1,353 @@
+// pkg/redis/cache.go
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotExist is returned by loaders to report that a value does not exist at
+// its source. GetOrLoad caches it for NegativeTTL and returns it while cached.
+var ErrNotExist = errors.New("value does not exist")
+
+// negativeEntry is stored in place of values that do not exist. It can never be
+// valid JSON, so it cannot collide with a cached value.
+const negativeEntry = "\x00notexist"
+
+const (
+	// tagKeyPrefix namespaces the sets that track the keys of each tag
+	tagKeyPrefix = "cache:tag:"
+
+	// versionKeyPrefix namespaces the counters that Delete and InvalidateTags
+	// bump, so that loads which started before can tell their value is stale
+	versionKeyPrefix = "cache:version:"
+
+	// versionTTL is how long a version counter outlives its last bump. Loads
+	// must finish within it for the staleness check to hold.
+	versionTTL = 24 * time.Hour
+)
+
+// setScript stores a value and adds its key to every tag set. A tag set lives
+// as long as its longest-lived key. KEYS are the key, its version counter and
+// then each tag set followed by its version counter. When ARGV holds the
+// versions read before a load, nothing is stored if any of them has changed.
+// Otherwise the value is current and the key's version is bumped, so loads
+// that started before cannot overwrite it.
+var setScript = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+if #ARGV > 3 then
+  for i = 2, #KEYS, 2 do
+    if (redis.call('GET', KEYS[i]) or '0') ~= ARGV[3 + i / 2] then
+      return 0
+    end
+  end
+else
+  redis.call('INCR', KEYS[2])
+  redis.call('PEXPIRE', KEYS[2], ARGV[3])
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+for i = 3, #KEYS, 2 do
+  redis.call('SADD', KEYS[i], KEYS[1])
+  if redis.call('PTTL', KEYS[i]) < ttl then
+    redis.call('PEXPIRE', KEYS[i], ttl)
+  end
+end
+return 1
+`)
+
+// invalidateScript deletes every key of the given tag sets and the sets
+// themselves. KEYS are pairs of a tag set and its version counter, which is bumped.
+var invalidateScript = redis.NewScript(`
+local deleted = 0
+for i = 1, #KEYS, 2 do
+  local members = redis.call('SMEMBERS', KEYS[i])
+  for j = 1, #members, 500 do
+    deleted = deleted + redis.call('DEL', unpack(members, j, math.min(j + 499, #members)))
+  end
+  redis.call('DEL', KEYS[i])
+  redis.call('INCR', KEYS[i + 1])
+  redis.call('PEXPIRE', KEYS[i + 1], ARGV[1])
+end
+return deleted
+`)
+
+// deleteScript deletes keys and bumps their version counters. KEYS are pairs
+// of a key and its version counter.
+var deleteScript = redis.NewScript(`
+for i = 1, #KEYS, 2 do
+  redis.call('DEL', KEYS[i])
+  redis.call('INCR', KEYS[i + 1])
+  redis.call('PEXPIRE', KEYS[i + 1], ARGV[1])
+end
+return 1
+`)
+
+// tagVersionKey is the version counter of a tag
+func tagVersionKey(tag string) string {
+	return versionKeyPrefix + "tag:" + tag
+}
+
+// CacheOptions configures the expiry of a Cache
+type CacheOptions struct {
+	// TTL is how long loaded values are cached
+	TTL time.Duration
+	// NegativeTTL is how long ErrNotExist is cached. Zero disables negative caching.
+	NegativeTTL time.Duration
+	// Jitter spreads expiries by up to this fraction of the TTL in either
+	// direction, so keys cached together do not all expire together
+	Jitter float64
+}
+
+// Cache is a typed read-through cache of JSON encoded values. Concurrent
+// misses of a key in one process share a single load. With a nil client the
+// cache stores nothing and every GetOrLoad calls the loader.
+type Cache[T any] struct {
+	client  *Client
+	prefix  string
+	options CacheOptions
+
+	mu       sync.Mutex
+	inflight map[string]*flight[T]
+}
+
+// flight is a load in progress that callers of the same key wait for
+type flight[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// NewCache creates a cache whose keys are prefixed with prefix, e.g. "product"
+func NewCache[T any](client *Client, prefix string, options CacheOptions) *Cache[T] {
+	return &Cache[T]{
+		client:   client,
+		prefix:   prefix,
+		options:  options,
+		inflight: make(map[string]*flight[T]),
+	}
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.prefix + ":" + key
+}
+
+// Get returns the cached value of key, ErrCacheMiss when nothing is cached or
+// ErrNotExist when the value is cached as not existing
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	if c.client == nil {
+		return value, ErrCacheMiss
+	}
+
+	data, err := c.client.rdb.Get(ctx, c.key(key)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return value, ErrCacheMiss
+		}
+		return value, fmt.Errorf("failed to read cache: %w", err)
+	}
+	if string(data) == negativeEntry {
+		return value, ErrNotExist
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, fmt.Errorf("failed to unmarshal cached value: %w", err)
+	}
+	return value, nil
+}
+
+// Set caches value under key for the TTL and adds it to tags, so that
+// InvalidateTags can purge it together with the other keys of a tag. Loads of
+// key in progress do not overwrite it.
+func (c *Cache[T]) Set(ctx context.Context, key string, value T, tags ...string) error {
+	if c.client == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return c.store(ctx, key, string(data), c.options.TTL, tags, nil)
+}
+
+// store writes data under key with tags. With versions, as returned by
+// versions, nothing is written if the key or a tag was invalidated since.
+func (c *Cache[T]) store(ctx context.Context, key, data string, ttl time.Duration, tags []string, versions []string) error {
+	ttl = c.jitter(ttl)
+	keys := c.versionedKeys(key, tags)
+	args := make([]interface{}, 0, len(versions)+3)
+	args = append(args, data, ttl.Milliseconds(), versionTTL.Milliseconds())
+	for _, version := range versions {
+		args = append(args, version)
+	}
+	if err := setScript.Run(ctx, c.client.rdb, keys, args...).Err(); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return nil
+}
+
+// versionedKeys returns the key and each tag set, each followed by its version counter
+func (c *Cache[T]) versionedKeys(key string, tags []string) []string {
+	keys := make([]string, 0, 2*len(tags)+2)
+	keys = append(keys, c.key(key), versionKeyPrefix+c.key(key))
+	for _, tag := range tags {
+		keys = append(keys, tagKeyPrefix+tag, tagVersionKey(tag))
+	}
+	return keys
+}
+
+// versions reads the version counters of key and tags, "0" for counters that
+// were never bumped
+func (c *Cache[T]) versions(ctx context.Context, key string, tags []string) ([]string, error) {
+	counters := []string{versionKeyPrefix + c.key(key)}
+	for _, tag := range tags {
+		counters = append(counters, tagVersionKey(tag))
+	}
+	values, err := c.client.rdb.MGet(ctx, counters...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache versions: %w", err)
+	}
+	versions := make([]string, len(values))
+	for i, value := range values {
+		versions[i] = "0"
+		if version, ok := value.(string); ok {
+			versions[i] = version
+		}
+	}
+	return versions, nil
+}
+
+// jitter moves ttl by a random amount of up to Jitter of it
+func (c *Cache[T]) jitter(ttl time.Duration) time.Duration {
+	if c.options.Jitter <= 0 {
+		return ttl
+	}
+	delta := time.Duration((rand.Float64()*2 - 1) * c.options.Jitter * float64(ttl))
+	if ttl+delta < time.Millisecond {
+		return time.Millisecond
+	}
+	return ttl + delta
+}
+
+// GetOrLoad returns the cached value of key, or calls load and caches its
+// result with tags. Concurrent misses of the same key wait for one load. When
+// load returns an error wrapping ErrNotExist, that is cached for NegativeTTL.
+// Cache failures are logged and fall through to load.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, load func(ctx context.Context) (T, error), tags ...string) (T, error) {
+	value, err := c.Get(ctx, key)
+	switch {
+	case err == nil, errors.Is(err, ErrNotExist):
+		return value, err
+	case !errors.Is(err, ErrCacheMiss):
+		log.Printf("Cache %s unavailable, loading %s: %v", c.prefix, key, err)
+	}
+
+	c.mu.Lock()
+	call, ok := c.inflight[key]
+	if !ok {
+		call = c.startLoad(ctx, key, load, tags)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// startLoad runs load for key in the background, detached from the
+// cancellation of the caller that started it. The result is only cached if
+// neither key nor its tags were invalidated while it loaded, so a load that
+// read the source before a write cannot cache the old value after the
+// write's invalidation. c.mu must be held.
+func (c *Cache[T]) startLoad(ctx context.Context, key string, load func(ctx context.Context) (T, error), tags []string) *flight[T] {
+	call := &flight[T]{done: make(chan struct{})}
+	c.inflight[key] = call
+
+	go func() {
+		ctx := context.WithoutCancel(ctx)
+		defer func() {
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+
+		var versions []string
+		var err error
+		if c.client != nil {
+			if versions, err = c.versions(ctx, key, tags); err != nil {
+				log.Printf("Not caching %s %s: %v", c.prefix, key, err)
+			}
+		}
+
+		call.value, call.err = load(ctx)
+		if versions == nil {
+			return
+		}
+		switch {
+		case call.err == nil:
+			var data []byte
+			if data, err = json.Marshal(call.value); err == nil {
+				err = c.store(ctx, key, string(data), c.options.TTL, tags, versions)
+			}
+		case errors.Is(call.err, ErrNotExist) && c.options.NegativeTTL > 0:
+			err = c.store(ctx, key, negativeEntry, c.options.NegativeTTL, tags, versions)
+		}
+		if err != nil {
+			log.Printf("Failed to cache %s %s: %v", c.prefix, key, err)
+		}
+	}()
+	return call
+}
+
+// Delete removes keys from the cache, including values of loads in progress
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	if c.client == nil || len(keys) == 0 {
+		return nil
+	}
+	versioned := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		versioned = append(versioned, c.key(key), versionKeyPrefix+c.key(key))
+	}
+	if err := deleteScript.Run(ctx, c.client.rdb, versioned, versionTTL.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to delete from cache: %w", err)
+	}
+	return nil
+}
+
+// InvalidateTags removes every key cached with one of the tags
+func (c *Cache[T]) InvalidateTags(ctx context.Context, tags ...string) error {
+	if c.client == nil {
+		return nil
+	}
+	return c.client.InvalidateTags(ctx, tags...)
+}
+
+// InvalidateTags removes every key cached with one of the tags by any Cache
+// sharing this Redis, e.g. every page of a product listing, including values
+// of loads in progress
+func (c *Client) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, 2*len(tags))
+	for _, tag := range tags {
+		keys = append(keys, tagKeyPrefix+tag, tagVersionKey(tag))
+	}
+	if err := invalidateScript.Run(ctx, c.rdb, keys, versionTTL.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cache tags: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+// pkg/redis/cache_test.go
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// product is the cached value in these tests
+type product struct {
+	Name string `json:"name"`
+}
+
+// blockingLoader counts its calls and returns value once released
+type blockingLoader struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+	value   product
+	err     error
+}
+
+func newBlockingLoader(value product, err error) *blockingLoader {
+	return &blockingLoader{started: make(chan struct{}, 100), release: make(chan struct{}), value: value, err: err}
+}
+
+func (l *blockingLoader) load(ctx context.Context) (product, error) {
+	l.calls.Add(1)
+	l.started <- struct{}{}
+	<-l.release
+	return l.value, l.err
+}
+
+// loadAsync runs GetOrLoad in the background and returns its result on a channel
+func loadAsync(cache *Cache[product], key string, load func(context.Context) (product, error), tags ...string) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := cache.GetOrLoad(context.Background(), key, load, tags...)
+		result <- err
+	}()
+	return result
+}
+
+func TestGetOrLoadSharesConcurrentLoads(t *testing.T) {
+	_, client := newTestClient(t)
+	cache := NewCache[product](client, "product", CacheOptions{TTL: time.Minute})
+	loader := newBlockingLoader(product{Name: "lamp"}, nil)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	values := make([]product, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.GetOrLoad(context.Background(), "1", loader.load)
+			if err != nil {
+				t.Error(err)
+			}
+			values[i] = value
+		}()
+	}
+	<-loader.started
+	// Let the other callers join the load in progress
+	time.Sleep(20 * time.Millisecond)
+	close(loader.release)
+	wg.Wait()
+
+	if calls := loader.calls.Load(); calls != 1 {
+		t.Errorf("loaded %d times, want once", calls)
+	}
+	for i, value := range values {
+		if value.Name != "lamp" {
+			t.Errorf("caller %d got %+v", i, value)
+		}
+	}
+
+	// Later calls are served from the cache
+	value, err := cache.GetOrLoad(context.Background(), "1", func(context.Context) (product, error) {
+		return product{}, errors.New("loaded again")
+	})
+	if err != nil || value.Name != "lamp" {
+		t.Errorf("got %+v, %v, want the cached value", value, err)
+	}
+}
+
+func TestNegativeCaching(t *testing.T) {
+	tests := []struct {
+		name        string
+		negativeTTL time.Duration
+		wantCached  bool
+	}{
+		{"enabled", 10 * time.Second, true},
+		{"disabled", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			cache := NewCache[product](client, "product", CacheOptions{TTL: time.Minute, NegativeTTL: tt.negativeTTL})
+
+			var calls int
+			missing := func(context.Context) (product, error) {
+				calls++
+				return product{}, fmt.Errorf("product 1: %w", ErrNotExist)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := cache.GetOrLoad(context.Background(), "1", missing); !errors.Is(err, ErrNotExist) {
+					t.Fatalf("error %v, want %v", err, ErrNotExist)
+				}
+			}
+			want := 2
+			if tt.wantCached {
+				want = 1
+			}
+			if calls != want {
+				t.Fatalf("loaded %d times, want %d", calls, want)
+			}
+			if !tt.wantCached {
+				return
+			}
+
+			// The negative entry expires after NegativeTTL
+			server.FastForward(tt.negativeTTL)
+			if _, err := cache.GetOrLoad(context.Background(), "1", missing); !errors.Is(err, ErrNotExist) || calls != 2 {
+				t.Errorf("after NegativeTTL: error %v and %d loads, want %v and 2", err, calls, ErrNotExist)
+			}
+		})
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+	}{
+		{"none", 0},
+		{"half", 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			const ttl = 10 * time.Second
+			cache := NewCache[product](client, "product", CacheOptions{TTL: ttl, Jitter: tt.jitter})
+
+			low, high := time.Duration(float64(ttl)*(1-tt.jitter)), time.Duration(float64(ttl)*(1+tt.jitter))
+			ttls := make(map[time.Duration]bool)
+			for i := 0; i < 20; i++ {
+				key := fmt.Sprint(i)
+				if err := cache.Set(context.Background(), key, product{Name: key}); err != nil {
+					t.Fatal(err)
+				}
+				got := server.TTL("product:" + key)
+				if got < low || got > high {
+					t.Errorf("key %s expires in %s, want between %s and %s", key, got, low, high)
+				}
+				ttls[got] = true
+			}
+			if spread := len(ttls) > 1; spread != (tt.jitter > 0) {
+				t.Errorf("%d distinct expiries with jitter %v", len(ttls), tt.jitter)
+			}
+		})
+	}
+}
+
+func TestInvalidateTags(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+	lists := NewCache[product](client, "products:list", CacheOptions{TTL: time.Minute})
+	products := NewCache[product](client, "product", CacheOptions{TTL: time.Minute})
+
+	for _, page := range []string{"1", "2"} {
+		if err := lists.Set(ctx, page, product{Name: "page " + page}, "products"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := products.Set(ctx, "1", product{Name: "lamp"}, "product:1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.InvalidateTags(ctx, "products"); err != nil {
+		t.Fatal(err)
+	}
+	for _, page := range []string{"1", "2"} {
+		if _, err := lists.Get(ctx, page); !errors.Is(err, ErrCacheMiss) {
+			t.Errorf("page %s: error %v after invalidating its tag, want %v", page, err, ErrCacheMiss)
+		}
+	}
+	if value, err := products.Get(ctx, "1"); err != nil || value.Name != "lamp" {
+		t.Errorf("key of another tag: got %+v, %v, want it cached", value, err)
+	}
+}
+
+func TestLoadsDoNotCacheInvalidatedValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(ctx context.Context, client *Client, cache *Cache[product]) error
+		want       string
+	}{
+		{"tag invalidated", func(ctx context.Context, client *Client, cache *Cache[product]) error {
+			return client.InvalidateTags(ctx, "products")
+		}, ""},
+		{"key deleted", func(ctx context.Context, client *Client, cache *Cache[product]) error {
+			return cache.Delete(ctx, "1")
+		}, ""},
+		{"key set", func(ctx context.Context, client *Client, cache *Cache[product]) error {
+			return cache.Set(ctx, "1", product{Name: "new"}, "products")
+		}, "new"},
+		{"other tag invalidated", func(ctx context.Context, client *Client, cache *Cache[product]) error {
+			return client.InvalidateTags(ctx, "orders")
+		}, "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			_, client := newTestClient(t)
+			cache := NewCache[product](client, "product", CacheOptions{TTL: time.Minute})
+
+			// The load reads the old value, then a write invalidates it before the load stores it
+			loader := newBlockingLoader(product{Name: "old"}, nil)
+			result := loadAsync(cache, "1", loader.load, "products")
+			<-loader.started
+			if err := tt.invalidate(ctx, client, cache); err != nil {
+				t.Fatal(err)
+			}
+			close(loader.release)
+			if err := <-result; err != nil {
+				t.Fatal(err)
+			}
+
+			value, err := cache.Get(ctx, "1")
+			switch {
+			case tt.want == "" && !errors.Is(err, ErrCacheMiss):
+				t.Errorf("got %+v, %v, want the stale value not cached", value, err)
+			case tt.want != "" && (err != nil || value.Name != tt.want):
+				t.Errorf("got %+v, %v, want %q cached", value, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheWithoutRedis(t *testing.T) {
+	cache := NewCache[product](nil, "product", CacheOptions{TTL: time.Minute})
+	var calls int
+	for i := 0; i < 2; i++ {
+		value, err := cache.GetOrLoad(context.Background(), "1", func(context.Context) (product, error) {
+			calls++
+			return product{Name: "lamp"}, nil
+		})
+		if err != nil || value.Name != "lamp" {
+			t.Fatalf("got %+v, %v", value, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("loaded %d times, want every call without Redis", calls)
+	}
+}
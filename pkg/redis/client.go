@@ -5,16 +5,25 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrCacheMiss is returned by Get when the key does not exist
+var ErrCacheMiss = errors.New("cache miss")
+
 type Client struct {
 	rdb *redis.Client
 }
 
+// NewFromClient wraps an existing go-redis client so it can share its connection pool
+func NewFromClient(rdb *redis.Client) *Client {
+	return &Client{rdb: rdb}
+}
+
 // NewClient creates a new Redis client
 func NewClient(host string, port string, password string) (*Client, error) {
 	rdb := redis.NewClient(&redis.Options{
@@ -50,7 +59,7 @@ func (c *Client) Get(ctx context.Context, key string, dest interface{}) error {
 	data, err := c.rdb.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			return fmt.Errorf("key not found: %s", key)
+			return ErrCacheMiss
 		}
 		return err
 	}
@@ -63,7 +72,7 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 	return c.rdb.Del(ctx, key).Err()
 }
 
-// SetNX sets a key-value pair only if the key doesn't exist (useful for locks)
+// SetNX sets a key-value pair only if the key doesn't exist. Use TryLock for locks.
 func (c *Client) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
 	data, err := json.Marshal(value)
 	if err != nil {
@@ -78,7 +87,18 @@ func (c *Client) Increment(ctx context.Context, key string) (int64, error) {
 	return c.rdb.Incr(ctx, key).Result()
 }
 
+// Ping checks that Redis is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	return c.rdb.Close()
 }
+
+// Redis returns the underlying go-redis client for packages that need commands
+// this wrapper does not cover, such as pkg/events
+func (c *Client) Redis() *redis.Client {
+	return c.rdb
+}
@@ -0,0 +1,58 @@
+// pkg/redis/leader.go
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// RunAsLeader campaigns for the named leadership until ctx is cancelled, so
+// that only one replica runs job at a time. job is called with the fencing
+// token of its term and a context that is cancelled when leadership is lost or
+// ctx is cancelled. If job returns while still leader, leadership is released
+// and the replica campaigns again. A leader that crashes is replaced within ttl.
+func (c *Client) RunAsLeader(ctx context.Context, name string, ttl time.Duration, job func(ctx context.Context, fence int64)) {
+	retry := ttl / 2
+	for {
+		lock, err := c.TryLock(ctx, "leader:"+name, ttl)
+		switch {
+		case err == nil:
+			log.Printf("Elected leader of %s with fencing token %d", name, lock.Fence())
+			lead(ctx, lock, job)
+			log.Printf("Stepped down as leader of %s", name)
+		case !errors.Is(err, ErrLockNotAcquired) && ctx.Err() == nil:
+			log.Printf("Failed to campaign for leader of %s: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// lead runs job for one term and releases the lock when it ends
+func lead(ctx context.Context, lock *Lock, job func(ctx context.Context, fence int64)) {
+	term, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-term.Done():
+		}
+	}()
+
+	job(term, lock.Fence())
+
+	// Release even when ctx is already cancelled, so a successor need not wait for ttl
+	releaseCtx, cancelRelease := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancelRelease()
+	if err := lock.Release(releaseCtx); err != nil && !errors.Is(err, ErrLockLost) {
+		log.Printf("Failed to release leadership: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// pkg/redis/lock.go
+
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrLockNotAcquired is returned by TryLock when another owner holds the lock
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockLost is returned when the lock expired or was taken over by another owner
+	ErrLockLost = errors.New("lock lost")
+)
+
+// lockKeyPrefix namespaces lock keys and their fencing counters
+const lockKeyPrefix = "lock:"
+
+// acquireScript takes the lock if it is free and returns the next fencing
+// token, or 0 when the lock is held. The counter never expires, so tokens keep
+// increasing across owners.
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+  return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+// refreshScript extends the lease if the caller still owns the lock
+var refreshScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lock if the caller still owns it
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Lock is a lease on a named lock. While held, the lease is extended every
+// third of its TTL. Writes made under the lock should carry its fencing token so
+// that stores can reject writes of an owner whose lease has since expired.
+type Lock struct {
+	client *Client
+	key    string
+	token  string
+	fence  int64
+	ttl    time.Duration
+	// extended is when the last successful extension was sent. The lease
+	// lasts at least ttl from then.
+	extended time.Time
+
+	stop     context.CancelFunc
+	done     chan struct{}
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// TryLock takes the named lock for ttl, or returns ErrLockNotAcquired when it is held
+func (c *Client) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	key := lockKeyPrefix + name
+	sent := time.Now()
+	fence, err := acquireScript.Run(ctx, c.rdb, []string{key, key + ":fence"}, token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", name, err)
+	}
+	if fence == 0 {
+		return nil, ErrLockNotAcquired
+	}
+
+	keepAlive, stop := context.WithCancel(context.Background())
+	lock := &Lock{
+		client:   c,
+		key:      key,
+		token:    token,
+		fence:    fence,
+		ttl:      ttl,
+		extended: sent,
+		stop:     stop,
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	go lock.keepAlive(keepAlive)
+	return lock, nil
+}
+
+// Lock waits for the named lock until ctx is done, retrying every tenth of ttl
+func (c *Client) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	retry := ttl / 10
+	if retry < 10*time.Millisecond {
+		retry = 10 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+	for {
+		lock, err := c.TryLock(ctx, name, ttl)
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return lock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func lockToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Token is the unique owner token of this lease
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Fence is the fencing token of this lease. Every lease of a lock gets a
+// higher token than the leases before it.
+func (l *Lock) Fence() int64 {
+	return l.fence
+}
+
+// Lost is closed when the lease was taken over, or could not be extended for
+// so long that it is about to expire. It is closed a third of the TTL before
+// the lease can expire, so work done under the lock has that long to stop.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// keepAlive extends the lease until Release is called or the lease is lost.
+// A failed extension is retried until the lease is within a third of its TTL
+// of expiring, measured from when the last successful extension was sent.
+func (l *Lock) keepAlive(ctx context.Context) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// A hanging call must not outlast the margin
+		sent := time.Now()
+		refreshCtx, cancel := context.WithTimeout(ctx, l.ttl/3)
+		err := l.Refresh(refreshCtx)
+		cancel()
+		switch {
+		case err == nil:
+			l.extended = sent
+		case errors.Is(err, ErrLockLost):
+			l.markLost()
+			return
+		case ctx.Err() != nil:
+			return
+		case time.Since(l.extended) >= l.ttl-l.ttl/3:
+			log.Printf("Lock %s is about to expire while Redis is unreachable: %v", l.key, err)
+			l.markLost()
+			return
+		default:
+			log.Printf("Failed to extend lock %s, retrying: %v", l.key, err)
+		}
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// Refresh extends the lease by its TTL, or returns ErrLockLost when it is no longer held
+func (l *Lock) Refresh(ctx context.Context) error {
+	extended, err := refreshScript.Run(ctx, l.client.rdb, []string{l.key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to extend lock %s: %w", l.key, err)
+	}
+	if extended == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release stops extending the lease and frees the lock if it is still held.
+// It returns ErrLockLost when the lease had already expired.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stop()
+	<-l.done
+
+	released, err := releaseScript.Run(ctx, l.client.rdb, []string{l.key}, l.token).Int64()
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", l.key, err)
+	}
+	if released == 0 {
+		l.markLost()
+		return ErrLockLost
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// pkg/redis/lock_test.go
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient starts a Redis stand-in and returns it with a client of it.
+// Keys only expire when the test fast-forwards the server's clock.
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return server, connect(t, server)
+}
+
+// connect returns another client of server, like another replica would have
+func connect(t *testing.T, server *miniredis.Miniredis) *Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return NewFromClient(rdb)
+}
+
+func TestReleaseOnlyFreesTheOwnLease(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+
+	first, err := client.TryLock(ctx, "order:1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.TryLock(ctx, "order:1", time.Minute); !errors.Is(err, ErrLockNotAcquired) {
+		t.Fatalf("second TryLock returned %v, want %v", err, ErrLockNotAcquired)
+	}
+
+	// The first lease expires and another owner takes the lock
+	server.FastForward(time.Minute)
+	second, err := client.TryLock(ctx, "order:1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Release(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("releasing an expired lease returned %v, want %v", err, ErrLockLost)
+	}
+	select {
+	case <-first.Lost():
+	default:
+		t.Error("Lost is open after releasing an expired lease")
+	}
+	if owner, _ := server.Get(lockKeyPrefix + "order:1"); owner != second.Token() {
+		t.Fatalf("lock is held by %q after the stale release, want the second owner %q", owner, second.Token())
+	}
+
+	if err := second.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists(lockKeyPrefix + "order:1") {
+		t.Error("lock is still held after its owner released it")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+	key := lockKeyPrefix + "order:1"
+
+	lock, err := client.TryLock(ctx, "order:1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(ctx)
+
+	server.FastForward(40 * time.Second)
+	if err := lock.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := server.TTL(key); ttl != time.Minute {
+		t.Errorf("lease has %s left after a refresh, want %s", ttl, time.Minute)
+	}
+
+	// Another owner's lease is never extended
+	server.FastForward(time.Minute)
+	other, err := client.TryLock(ctx, "order:1", 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Release(ctx)
+	if err := lock.Refresh(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("refreshing a taken over lease returned %v, want %v", err, ErrLockLost)
+	}
+	if ttl := server.TTL(key); ttl != 30*time.Second {
+		t.Errorf("other owner's lease has %s left, want %s", ttl, 30*time.Second)
+	}
+}
+
+func TestFenceIncreases(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+	replica := connect(t, server)
+
+	var last int64
+	for i, c := range []*Client{client, replica, client, replica} {
+		lock, err := c.TryLock(ctx, "order:1", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lock.Fence() <= last {
+			t.Errorf("lease %d has fencing token %d, want more than %d", i, lock.Fence(), last)
+		}
+		last = lock.Fence()
+
+		// Every other lease expires instead of being released
+		if i%2 == 0 {
+			lock.Release(ctx)
+		} else {
+			server.FastForward(time.Minute)
+		}
+	}
+}
+
+func TestLostBeforeExpiry(t *testing.T) {
+	server, client := newTestClient(t)
+	const ttl = 600 * time.Millisecond
+
+	acquired := time.Now()
+	lock, err := client.TryLock(context.Background(), "order:1", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(context.Background())
+
+	// Redis becomes unreachable, so the lease cannot be extended
+	server.Close()
+	select {
+	case <-lock.Lost():
+	case <-time.After(2 * ttl):
+		t.Fatal("lease not reported lost")
+	}
+	if elapsed := time.Since(acquired); elapsed >= ttl {
+		t.Errorf("lease reported lost after %s, want a margin before its %s expiry", elapsed, ttl)
+	}
+}
+
+// term is one leadership term seen by a RunAsLeader job
+type term struct {
+	candidate string
+	fence     int64
+}
+
+// campaign runs candidate's RunAsLeader until the returned func is called.
+// Terms are reported on terms, and ended is sent to when a term ends.
+func campaign(t *testing.T, c *Client, candidate string, ttl time.Duration, terms chan<- term, ended chan<- string) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.RunAsLeader(ctx, "expiry", ttl, func(ctx context.Context, fence int64) {
+			terms <- term{candidate, fence}
+			<-ctx.Done()
+			ended <- candidate
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return cancel
+}
+
+// nextTerm waits for the next term to start
+func nextTerm(t *testing.T, terms <-chan term) term {
+	t.Helper()
+	select {
+	case started := <-terms:
+		return started
+	case <-time.After(2 * time.Second):
+		t.Fatal("no leader was elected")
+		return term{}
+	}
+}
+
+func TestRunAsLeaderHandOff(t *testing.T) {
+	server, first := newTestClient(t)
+	second := connect(t, server)
+	const ttl = 300 * time.Millisecond
+
+	terms := make(chan term, 4)
+	ended := make(chan string, 4)
+	stopFirst := campaign(t, first, "first", ttl, terms, ended)
+	leader := nextTerm(t, terms)
+	campaign(t, second, "second", ttl, terms, ended)
+
+	// Only one candidate leads at a time
+	select {
+	case other := <-terms:
+		t.Fatalf("%s was elected while %s was leading", other.candidate, leader.candidate)
+	case <-time.After(ttl):
+	}
+
+	// A leader that stops hands off to the other candidate
+	stopFirst()
+	if ended := <-ended; ended != "first" {
+		t.Fatalf("term of %s ended, want first", ended)
+	}
+	successor := nextTerm(t, terms)
+	if successor.candidate != "second" || successor.fence <= leader.fence {
+		t.Fatalf("%s took over with fencing token %d, want second with more than %d", successor.candidate, successor.fence, leader.fence)
+	}
+
+	// A leader whose lease is taken away stops its job
+	server.Del(lockKeyPrefix + "leader:expiry")
+	select {
+	case ended := <-ended:
+		if ended != "second" {
+			t.Fatalf("term of %s ended, want second", ended)
+		}
+	case <-time.After(ttl):
+		t.Fatal("job kept running after its lease was lost")
+	}
+	if again := nextTerm(t, terms); again.fence <= successor.fence {
+		t.Errorf("re-elected with fencing token %d, want more than %d", again.fence, successor.fence)
+	}
+}
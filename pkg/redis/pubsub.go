@@ -0,0 +1,41 @@
+// pkg/redis/pubsub.go
+
+package redis
+
+import (
+	"context"
+)
+
+// CacheInvalidationChannel carries the names of cache groups to purge, e.g. "products".
+// Services publish to it after writes and the gateway purges its response cache.
+const CacheInvalidationChannel = "cache:invalidate"
+
+// Publish sends a message to every subscriber of a channel
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+	return c.rdb.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe calls handler for every message published to channel until ctx is
+// cancelled. The subscription is re-established by go-redis after connection errors.
+func (c *Client) Subscribe(ctx context.Context, channel string, handler func(message string)) error {
+	sub := c.rdb.Subscribe(ctx, channel)
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed so no message published afterwards is missed
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handler(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// pkg/registry/consul.go
+
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Consul registers instances with a Consul agent and resolves them with blocking queries
+type Consul struct {
+	client *api.Client
+}
+
+// NewConsul creates a registry backed by the Consul agent at address,
+// defaulting to http://localhost:8500
+func NewConsul(address string) (*Consul, error) {
+	config := api.DefaultConfig()
+	config.Address = address
+	if config.Address == "" {
+		config.Address = "http://localhost:8500"
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Consul client: %w", err)
+	}
+	return &Consul{client: client}, nil
+}
+
+// Register registers the instance with an HTTP check on its readiness endpoint
+func (c *Consul) Register(ctx context.Context, instance Instance) error {
+	registration := &api.AgentServiceRegistration{
+		ID:      instance.ID,
+		Name:    instance.Name,
+		Port:    instance.Port,
+		Address: instance.Address,
+		Tags:    instance.Tags,
+		Meta:    instance.Meta,
+		Check: &api.AgentServiceCheck{
+			HTTP:                           fmt.Sprintf("http://%s/health/ready", instance.Host()),
+			Interval:                       "10s",
+			Timeout:                        "1s",
+			DeregisterCriticalServiceAfter: "30s",
+		},
+	}
+	opts := api.ServiceRegisterOpts{}.WithContext(ctx)
+	if err := c.client.Agent().ServiceRegisterOpts(registration, opts); err != nil {
+		return fmt.Errorf("failed to register %s with Consul: %w", instance.ID, err)
+	}
+	return nil
+}
+
+// Deregister removes the instance from the agent
+func (c *Consul) Deregister(ctx context.Context, instanceID string) error {
+	opts := (&api.QueryOptions{}).WithContext(ctx)
+	if err := c.client.Agent().ServiceDeregisterOpts(instanceID, opts); err != nil {
+		return fmt.Errorf("failed to deregister %s from Consul: %w", instanceID, err)
+	}
+	return nil
+}
+
+// Instances returns the instances of a service that pass their health checks
+func (c *Consul) Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	opts := (&api.QueryOptions{
+		WaitIndex: index,
+		WaitTime:  WaitTime,
+	}).WithContext(ctx)
+
+	entries, meta, err := c.client.Health().Service(service, "", true, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	instances := make([]Instance, 0, len(entries))
+	for _, entry := range entries {
+		instances = append(instances, Instance{
+			ID:      entry.Service.ID,
+			Name:    entry.Service.Service,
+			Address: entry.Service.Address,
+			Port:    entry.Service.Port,
+			Tags:    entry.Service.Tags,
+			Meta:    entry.Service.Meta,
+		})
+	}
+	return instances, meta.LastIndex, nil
+}
+
+// Ping asks the agent for the current Raft leader
+func (c *Consul) Ping(ctx context.Context) error {
+	_, err := c.client.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	return err
+}
@@ -0,0 +1,55 @@
+// pkg/registry/instance.go
+
+package registry
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Instance identifies one running copy of a service in the service registry
+type Instance struct {
+	ID      string            `yaml:"id" json:"id"`
+	Name    string            `yaml:"name" json:"name"`
+	Address string            `yaml:"address" json:"address"`
+	Port    int               `yaml:"port" json:"port"`
+	Tags    []string          `yaml:"tags" json:"tags"`
+	Meta    map[string]string `yaml:"meta" json:"meta,omitempty"`
+}
+
+// Host returns the host:port pair used to reach the instance
+func (i Instance) Host() string {
+	return net.JoinHostPort(i.Address, strconv.Itoa(i.Port))
+}
+
+// InstanceFromEnv describes the instance of a service started with the current
+// environment. HOST is the address other containers reach it on and defaults to
+// the service name. SERVICE_VERSION tags the instance with a build version such
+// as v2, so the gateway can route canary traffic to it, and SERVICE_ID lets
+// several builds of one service register side by side.
+func InstanceFromEnv(name string, port int, tags ...string) Instance {
+	instance := Instance{
+		ID:      os.Getenv("SERVICE_ID"),
+		Name:    name,
+		Address: os.Getenv("HOST"),
+		Port:    port,
+		Tags:    append([]string(nil), tags...),
+	}
+	if instance.Address == "" {
+		instance.Address = name
+	}
+
+	version := strings.TrimSpace(os.Getenv("SERVICE_VERSION"))
+	if version != "" {
+		instance.Tags = append(instance.Tags, version)
+	}
+	if instance.ID == "" {
+		instance.ID = name
+		if version != "" {
+			instance.ID = name + "-" + version
+		}
+	}
+	return instance
+}
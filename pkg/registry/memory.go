@@ -0,0 +1,91 @@
+// pkg/registry/memory.go
+
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a registry local to one process, for running the gateway and
+// services in a single binary or in tests. Blocking Instances calls return as
+// soon as an instance is registered or deregistered.
+type Memory struct {
+	mu        sync.Mutex
+	instances map[string]Instance
+	index     uint64
+	changed   chan struct{}
+}
+
+// NewMemory creates an empty in-process registry
+func NewMemory() *Memory {
+	return &Memory{
+		instances: make(map[string]Instance),
+		index:     1,
+		changed:   make(chan struct{}),
+	}
+}
+
+// Register adds or replaces an instance
+func (m *Memory) Register(ctx context.Context, instance Instance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instances[instance.ID] = instance
+	m.notify()
+	return nil
+}
+
+// Deregister removes an instance
+func (m *Memory) Deregister(ctx context.Context, instanceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.instances[instanceID]; ok {
+		delete(m.instances, instanceID)
+		m.notify()
+	}
+	return nil
+}
+
+// notify bumps the index and wakes up blocked Instances calls. m.mu must be held.
+func (m *Memory) notify() {
+	m.index++
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// Instances returns the registered instances of a service, sorted by ID
+func (m *Memory) Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	m.mu.Lock()
+	if index == m.index {
+		changed := m.changed
+		m.mu.Unlock()
+
+		timer := time.NewTimer(WaitTime)
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		timer.Stop()
+		m.mu.Lock()
+	}
+	defer m.mu.Unlock()
+
+	instances := make([]Instance, 0)
+	for _, instance := range m.instances {
+		if instance.Name == service {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, m.index, nil
+}
+
+// Ping always succeeds
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,126 @@
+// pkg/registry/memory_test.go
+
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ids joins the IDs of instances
+func ids(instances []Instance) string {
+	list := make([]string, len(instances))
+	for i, instance := range instances {
+		list[i] = instance.ID
+	}
+	return strings.Join(list, ",")
+}
+
+// registerProduct registers an instance of product-service with the given ID
+func registerProduct(t *testing.T, m *Memory, id string) {
+	t.Helper()
+	instance := Instance{ID: id, Name: "product-service", Address: "10.0.0.1", Port: 8000}
+	if err := m.Register(context.Background(), instance); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryRegisterDeregister(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	registerProduct(t, m, "b")
+	registerProduct(t, m, "a")
+	m.Register(ctx, Instance{ID: "c", Name: "order-service", Address: "10.0.0.2", Port: 8001})
+
+	instances, index, err := m.Instances(ctx, "product-service", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(instances); got != "a,b" {
+		t.Errorf("instances %q, want a,b sorted by ID without other services", got)
+	}
+
+	// Registering an ID again replaces the instance
+	m.Register(ctx, Instance{ID: "a", Name: "product-service", Address: "10.0.0.3", Port: 8000})
+	instances, next, _ := m.Instances(ctx, "product-service", 0)
+	if ids(instances) != "a,b" || instances[0].Address != "10.0.0.3" {
+		t.Errorf("instances %+v, want a replaced", instances)
+	}
+	if next <= index {
+		t.Errorf("index %d after a change, want more than %d", next, index)
+	}
+
+	if err := m.Deregister(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	instances, index, _ = m.Instances(ctx, "product-service", 0)
+	if got := ids(instances); got != "b" {
+		t.Errorf("instances %q after deregistering a, want b", got)
+	}
+
+	// Deregistering an unknown ID is not a change
+	if err := m.Deregister(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, next, _ := m.Instances(ctx, "product-service", 0); next != index {
+		t.Errorf("index %d after deregistering an unknown ID, want %d", next, index)
+	}
+
+	instances, _, _ = m.Instances(ctx, "payment-service", 0)
+	if instances == nil || len(instances) != 0 {
+		t.Errorf("instances %v of an unknown service, want an empty list", instances)
+	}
+}
+
+func TestMemoryInstancesBlocks(t *testing.T) {
+	m := NewMemory()
+	registerProduct(t, m, "a")
+	_, index, _ := m.Instances(context.Background(), "product-service", 0)
+
+	type result struct {
+		instances []Instance
+		index     uint64
+	}
+	results := make(chan result, 1)
+	go func() {
+		instances, index, _ := m.Instances(context.Background(), "product-service", index)
+		results <- result{instances, index}
+	}()
+
+	select {
+	case <-results:
+		t.Fatal("a call with the current index returned before a change")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// A change of any service wakes up the call
+	registerProduct(t, m, "b")
+	select {
+	case got := <-results:
+		if ids(got.instances) != "a,b" || got.index <= index {
+			t.Errorf("instances %q at index %d, want a,b after index %d", ids(got.instances), got.index, index)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the call did not return after a change")
+	}
+
+	// An outdated index returns at once
+	start := time.Now()
+	if _, _, err := m.Instances(context.Background(), "product-service", index); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("a call with an outdated index took %s", elapsed)
+	}
+
+	// A cancelled call returns the unchanged instances
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, current, _ := m.Instances(context.Background(), "product-service", 0)
+	instances, next, err := m.Instances(ctx, "product-service", current)
+	if err != nil || ids(instances) != "a,b" || next != current {
+		t.Errorf("instances %q at index %d, err %v, want a,b at index %d", ids(instances), next, err, current)
+	}
+}
@@ -0,0 +1,88 @@
+// pkg/registry/registry.go
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"e-commerce-platform/pkg/config"
+)
+
+// Supported registries, selected with REGISTRY
+const (
+	KindConsul = "consul"
+	KindStatic = "static"
+	KindMemory = "memory"
+)
+
+// WaitTime bounds how long a blocking Instances call waits for a change
+const WaitTime = 30 * time.Second
+
+// Registry registers the instances of this process and resolves the healthy
+// instances of other services
+type Registry interface {
+	// Register announces an instance, replacing any instance with the same ID
+	Register(ctx context.Context, instance Instance) error
+	// Deregister removes an instance
+	Deregister(ctx context.Context, instanceID string) error
+	// Instances returns the healthy instances of a service and the index of the
+	// result. With a non-zero index the call blocks until the instances change
+	// from that index, ctx is done or WaitTime has passed.
+	Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error)
+	// Ping reports whether the registry is reachable
+	Ping(ctx context.Context) error
+}
+
+// Config selects the registry, see config.Load
+type Config struct {
+	Kind string `env:"REGISTRY" default:"consul" oneof:"consul static memory"`
+	// ConsulAddr is the Consul agent, http://localhost:8500 by default
+	ConsulAddr string `env:"CONSUL_HTTP_ADDR"`
+	// File and Services list the instances of a static registry, see
+	// StaticFromFile and StaticFromEnv
+	File     string `env:"REGISTRY_FILE"`
+	Services string `env:"REGISTRY_SERVICES"`
+}
+
+// New creates the registry selected by cfg.Kind:
+//   - consul - the Consul agent at ConsulAddr
+//   - static - the instances listed in File or Services
+//   - memory - an empty registry local to this process
+func New(cfg Config) (Registry, error) {
+	switch cfg.Kind {
+	case KindConsul:
+		return NewConsul(cfg.ConsulAddr)
+	case KindStatic:
+		if cfg.File != "" {
+			return StaticFromFile(cfg.File)
+		}
+		return StaticFromEnv(cfg.Services)
+	case KindMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown registry %q", cfg.Kind)
+	}
+}
+
+// FromEnv creates the registry selected by REGISTRY, consul by default, from
+// the configuration loaded with config.Load
+func FromEnv() (Registry, error) {
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid registry configuration:\n%w", err)
+	}
+	return New(cfg)
+}
+
+// wait blocks until ctx is done or WaitTime has passed, for registries whose
+// instances never change
+func wait(ctx context.Context) {
+	timer := time.NewTimer(WaitTime)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,83 @@
+// pkg/registry/registry_test.go
+
+package registry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "registry.yaml")
+	if err := os.WriteFile(file, []byte("product-service:\n  - address: localhost\n    port: 8000\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+		err  string
+	}{
+		{"consul", Config{Kind: KindConsul, ConsulAddr: "http://consul:8500"}, "*registry.Consul", ""},
+		{"memory", Config{Kind: KindMemory}, "*registry.Memory", ""},
+		{"static file before the list", Config{Kind: KindStatic, File: file, Services: "invalid"}, "*registry.Static", ""},
+		{"static list", Config{Kind: KindStatic, Services: "product-service=localhost:8000"}, "*registry.Static", ""},
+		{"invalid static list", Config{Kind: KindStatic, Services: "product-service"}, "", "invalid static registry entry"},
+		{"unknown", Config{Kind: "etcd"}, "", `unknown registry "etcd"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := New(tt.cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", reg); got != tt.want {
+				t.Fatalf("registry %s, want %s", got, tt.want)
+			}
+			if s, ok := reg.(*Static); ok {
+				if got := ids(s.services["product-service"]); got != "product-service-localhost-8000" {
+					t.Errorf("instances %q, want product-service-localhost-8000", got)
+				}
+			}
+		})
+	}
+}
+
+func TestInstanceFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		id      string
+		address string
+		tags    string
+	}{
+		{"defaults", nil, "product-service", "product-service", "api"},
+		{"host", map[string]string{"HOST": "10.0.0.5"}, "product-service", "10.0.0.5", "api"},
+		{"version", map[string]string{"SERVICE_VERSION": " v2 "}, "product-service-v2", "product-service", "api,v2"},
+		{"service ID", map[string]string{"SERVICE_ID": "product-1", "SERVICE_VERSION": "v2"}, "product-1", "product-service", "api,v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SERVICE_ID", "HOST", "SERVICE_VERSION"} {
+				t.Setenv(name, tt.env[name])
+			}
+			got := InstanceFromEnv("product-service", 8000, "api")
+			if got.ID != tt.id || got.Address != tt.address || got.Name != "product-service" || got.Port != 8000 {
+				t.Errorf("instance %+v, want %s at %s:8000", got, tt.id, tt.address)
+			}
+			if tags := strings.Join(got.Tags, ","); tags != tt.tags {
+				t.Errorf("tags %q, want %q", tags, tt.tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// pkg/registry/static.go
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// staticIndex is the index of a static registry, whose instances never change
+const staticIndex = 1
+
+// Static serves a fixed set of instances per service. It never checks their
+// health, and Register and Deregister are no-ops, so services can run locally
+// or in tests without a Consul agent.
+type Static struct {
+	services map[string][]Instance
+}
+
+// NewStatic creates a registry serving the given instances per service name.
+// Missing names and IDs are filled in from the service name and address.
+func NewStatic(services map[string][]Instance) *Static {
+	filled := make(map[string][]Instance, len(services))
+	for name, instances := range services {
+		for _, instance := range instances {
+			instance.Name = name
+			if instance.ID == "" {
+				instance.ID = fmt.Sprintf("%s-%s-%d", name, instance.Address, instance.Port)
+			}
+			filled[name] = append(filled[name], instance)
+		}
+	}
+	return &Static{services: filled}
+}
+
+// StaticFromFile reads the instances of every service from a YAML or JSON file:
+//
+//	product-service:
+//	  - address: localhost
+//	    port: 8000
+//	    tags: [v2]
+func StaticFromFile(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static registry: %w", err)
+	}
+
+	var services map[string][]Instance
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&services); err != nil {
+		return nil, fmt.Errorf("failed to parse static registry %s: %w", path, err)
+	}
+	for name, instances := range services {
+		for _, instance := range instances {
+			if instance.Address == "" || instance.Port < 1 {
+				return nil, fmt.Errorf("static registry %s: every instance of %s needs an address and port", path, name)
+			}
+		}
+	}
+	return NewStatic(services), nil
+}
+
+// StaticFromEnv parses a comma separated list of service=host:port pairs. A
+// service is listed once per instance, e.g.
+// "product-service=localhost:8000,product-service=localhost:8010,order-service=localhost:8001".
+func StaticFromEnv(value string) (*Static, error) {
+	services := make(map[string][]Instance)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, hostPort, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid static registry entry %q, want service=host:port", entry)
+		}
+		host, portValue, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static registry entry %q: %w", entry, err)
+		}
+		port, err := strconv.Atoi(portValue)
+		if err != nil || port < 1 {
+			return nil, fmt.Errorf("invalid static registry entry %q: invalid port", entry)
+		}
+		services[name] = append(services[name], Instance{Address: host, Port: port})
+	}
+	return NewStatic(services), nil
+}
+
+// Register is a no-op, static instances are configured up front
+func (s *Static) Register(ctx context.Context, instance Instance) error {
+	return nil
+}
+
+// Deregister is a no-op, static instances are configured up front
+func (s *Static) Deregister(ctx context.Context, instanceID string) error {
+	return nil
+}
+
+// Instances returns the configured instances of a service. Since they never
+// change, a call with the current index just waits.
+func (s *Static) Instances(ctx context.Context, service string, index uint64) ([]Instance, uint64, error) {
+	if index == staticIndex {
+		wait(ctx)
+	}
+	return s.services[service], staticIndex, nil
+}
+
+// Ping always succeeds
+func (s *Static) Ping(ctx context.Context) error {
+	return nil
+}
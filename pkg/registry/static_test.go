@@ -0,0 +1,150 @@
+// pkg/registry/static_test.go
+
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewStatic(t *testing.T) {
+	s := NewStatic(map[string][]Instance{
+		"product-service": {
+			{Address: "localhost", Port: 8000},
+			{ID: "product-v2", Name: "ignored", Address: "localhost", Port: 8010, Tags: []string{"v2"}},
+		},
+	})
+
+	instances, index, err := s.Instances(context.Background(), "product-service", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != staticIndex {
+		t.Errorf("index %d, want %d", index, staticIndex)
+	}
+	if got := ids(instances); got != "product-service-localhost-8000,product-v2" {
+		t.Errorf("instances %q, want a filled-in ID and the configured one", got)
+	}
+	for _, instance := range instances {
+		if instance.Name != "product-service" {
+			t.Errorf("instance %s is named %q, want product-service", instance.ID, instance.Name)
+		}
+	}
+
+	// Register and Deregister do not change the configured instances
+	s.Register(context.Background(), Instance{ID: "x", Name: "product-service"})
+	s.Deregister(context.Background(), "product-v2")
+	if instances, _, _ := s.Instances(context.Background(), "product-service", 0); len(instances) != 2 {
+		t.Errorf("%d instances, want the 2 configured", len(instances))
+	}
+	if instances, _, _ := s.Instances(context.Background(), "order-service", 0); len(instances) != 0 {
+		t.Errorf("%d instances of an unknown service, want none", len(instances))
+	}
+}
+
+func TestStaticInstancesWait(t *testing.T) {
+	s := NewStatic(map[string][]Instance{"product-service": {{Address: "localhost", Port: 8000}}})
+
+	// With the current index the call waits until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	instances, _, err := s.Instances(ctx, "product-service", staticIndex)
+	if err != nil || len(instances) != 1 {
+		t.Fatalf("%d instances, err %v, want 1", len(instances), err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("a call with the current index took %s, want it to wait for ctx", elapsed)
+	}
+}
+
+func TestStaticFromEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		// want maps each service to the IDs of its instances
+		want map[string]string
+		err  string
+	}{
+		{"empty", "", map[string]string{}, ""},
+		{"one instance per entry", " product-service=localhost:8000, product-service=localhost:8010,order-service=order:8001,",
+			map[string]string{
+				"product-service": "product-service-localhost-8000,product-service-localhost-8010",
+				"order-service":   "order-service-order-8001",
+			}, ""},
+		{"IPv6", "product-service=[::1]:8000", map[string]string{"product-service": "product-service-::1-8000"}, ""},
+		{"missing service", "=localhost:8000", nil, "want service=host:port"},
+		{"missing address", "product-service", nil, "want service=host:port"},
+		{"missing port", "product-service=localhost", nil, "missing port"},
+		{"invalid port", "product-service=localhost:http", nil, "invalid port"},
+		{"port 0", "product-service=localhost:0", nil, "invalid port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := StaticFromEnv(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(s.services) != len(tt.want) {
+				t.Errorf("%d services, want %d", len(s.services), len(tt.want))
+			}
+			for service, want := range tt.want {
+				if got := ids(s.services[service]); got != want {
+					t.Errorf("%s instances %q, want %q", service, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStaticFromFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+		err  string
+	}{
+		{"YAML", "product-service:\n  - address: localhost\n    port: 8000\n    tags: [v2]\n  - id: p2\n    address: localhost\n    port: 8010\n",
+			"product-service-localhost-8000,p2", ""},
+		{"JSON", `{"product-service": [{"address": "localhost", "port": 8000}]}`, "product-service-localhost-8000", ""},
+		{"missing address", "product-service:\n  - port: 8000\n", "", "needs an address and port"},
+		{"missing port", "product-service:\n  - address: localhost\n", "", "needs an address and port"},
+		{"unknown field", "product-service:\n  - address: localhost\n    port: 8000\n    weight: 2\n", "", "field weight not found"},
+		{"not a list", "product-service: localhost:8000\n", "", "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "registry.yaml")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			s, err := StaticFromFile(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(s.services["product-service"]); got != tt.want {
+				t.Errorf("instances %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := StaticFromFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("a missing file was read")
+	}
+}
@@ -0,0 +1,87 @@
+// pkg/service/config.go
+
+package service
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+
+	"e-commerce-platform/pkg/config"
+)
+
+// What New does with pending migrations, selected with MIGRATE_ON_START
+const (
+	// MigrateUp applies pending migrations, the default
+	MigrateUp = "up"
+	// MigrateCheck refuses to start while migrations are pending, for
+	// deployments that run "migrate up" as a separate step
+	MigrateCheck = "check"
+	// MigrateOff ignores the schema
+	MigrateOff = "off"
+)
+
+// Config is the configuration shared by every service
+type Config struct {
+	// Name identifies the service in the registry, logs, metrics and traces
+	Name string
+	// Port is the HTTP port
+	Port int `env:"PORT" min:"1" max:"65535"`
+	// Tags are registered with the instance, e.g. order and api
+	Tags []string `env:"SERVICE_TAGS"`
+	// ShutdownTimeout bounds how long in-flight requests and background
+	// workers get to finish on shutdown
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" default:"15s" min:"1s"`
+
+	Database DatabaseConfig
+	Redis    RedisConfig
+}
+
+// DatabaseConfig is the Postgres connection
+type DatabaseConfig struct {
+	Host     string `env:"DB_HOST" required:"true"`
+	Port     int    `env:"DB_PORT" default:"5432" min:"1" max:"65535"`
+	User     string `env:"DB_USER" required:"true"`
+	Password string `env:"DB_PASSWORD" secret:"true"`
+	Name     string `env:"DB_NAME" required:"true"`
+	SSLMode  string `env:"DB_SSLMODE" default:"disable" oneof:"disable allow prefer require verify-ca verify-full"`
+
+	// Migrations holds the service's versioned migration files, see pkg/migrate
+	Migrations fs.FS
+	// MigrateOnStart is MigrateUp, MigrateCheck or MigrateOff
+	MigrateOnStart string `env:"MIGRATE_ON_START" default:"up" oneof:"up check off"`
+}
+
+// DSN returns the connection string of the database
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		c.Host, c.User, c.Password, c.Name, c.Port, c.SSLMode)
+}
+
+// RedisConfig is the Redis connection, disabled unless REDIS_HOST is set
+type RedisConfig struct {
+	Host     string `env:"REDIS_HOST"`
+	Port     int    `env:"REDIS_PORT" default:"6379" min:"1" max:"65535"`
+	Password string `env:"REDIS_PASSWORD" secret:"true"`
+	// Required makes New fail when REDIS_HOST is not set, for services that
+	// cannot work without Redis
+	Required bool
+}
+
+// Enabled reports whether Redis is configured
+func (c RedisConfig) Enabled() bool {
+	return c.Host != ""
+}
+
+// LoadConfig loads the configuration of a service with config.Load, from the
+// environment, .env, secret files and CONFIG_FILE, and logs it with secrets
+// redacted. defaultPort and tags are used when PORT and SERVICE_TAGS are not
+// set. Set Database.Migrations before calling New.
+func LoadConfig(name string, defaultPort int, tags ...string) (Config, error) {
+	cfg := Config{Name: name, Port: defaultPort, Tags: tags}
+	if err := config.Load(&cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration of %s:\n%w", name, err)
+	}
+	config.Log(name, cfg)
+	return cfg, nil
+}
@@ -0,0 +1,299 @@
+// pkg/service/service.go
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"e-commerce-platform/pkg/health"
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/metrics"
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/migrate"
+	"e-commerce-platform/pkg/redis"
+	"e-commerce-platform/pkg/registry"
+	"e-commerce-platform/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	dbConnectAttempts = 5
+	dbConnectRetry    = 5 * time.Second
+)
+
+// errShuttingDown fails readiness while the service drains
+var errShuttingDown = errors.New("shutting down")
+
+// Service holds the dependencies every service is built on. New connects them
+// and Run serves the router until SIGINT or SIGTERM.
+type Service struct {
+	Config Config
+	DB     *gorm.DB
+	// Redis is nil when REDIS_HOST is not set
+	Redis *redis.Client
+	// Router has the standard middleware, /metrics and the health endpoints
+	Router   *gin.Engine
+	Health   *health.Checker
+	Registry registry.Registry
+
+	ctx      context.Context
+	stop     context.CancelFunc
+	workers  sync.WaitGroup
+	draining atomic.Bool
+}
+
+// New connects the database, Redis and the registry of a service and sets up
+// its router. Register routes on Router, start workers with Go, then call Run.
+func New(cfg Config) (*Service, error) {
+	if _, err := tracing.InitFromEnv(cfg.Name); err != nil {
+		return nil, err
+	}
+
+	s := &Service{Config: cfg}
+	s.ctx, s.stop = context.WithCancel(context.Background())
+
+	db, err := connectDB(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	s.DB = db
+
+	// Trace GORM queries made within a request
+	if err := s.DB.Use(tracing.NewGormPlugin()); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to register tracing plugin: %w", err)
+	}
+
+	if err := migrateOnStart(s.DB, cfg); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	switch {
+	case cfg.Redis.Enabled():
+		s.Redis, err = redis.NewClient(cfg.Redis.Host, strconv.Itoa(cfg.Redis.Port), cfg.Redis.Password)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+	case cfg.Redis.Required:
+		s.close()
+		return nil, errors.New("REDIS_HOST must be set")
+	}
+
+	// Service registry selected by REGISTRY, Consul by default
+	s.Registry, err = registry.FromEnv()
+	if err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to create service registry: %w", err)
+	}
+
+	s.Router = gin.New()
+	s.Router.Use(gin.Recovery(), logging.RequestID(), logging.AccessLog(cfg.Name), metrics.Middleware(cfg.Name), tracing.Middleware())
+
+	// Prometheus metrics
+	s.Router.GET("/metrics", metrics.Handler())
+
+	// Identity forwarded by the API gateway
+	s.Router.Use(middleware.Identity())
+
+	// Liveness and readiness endpoints. Readiness fails once shutdown starts.
+	s.Health = health.NewChecker(cfg.Name)
+	s.Health.Add("database", health.DB(s.DB))
+	if s.Redis != nil {
+		s.Health.Add("redis", health.Redis(s.Redis.Redis()))
+	}
+	s.Health.Add("shutdown", func(context.Context) error {
+		if s.draining.Load() {
+			return errShuttingDown
+		}
+		return nil
+	})
+	s.Health.Register(s.Router)
+
+	return s, nil
+}
+
+// connectDB opens the database, retrying while it starts up
+func connectDB(cfg DatabaseConfig) (*gorm.DB, error) {
+	var err error
+	for attempt := 1; attempt <= dbConnectAttempts; attempt++ {
+		var db *gorm.DB
+		db, err = gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+		if err == nil {
+			return db, nil
+		}
+		logging.Logger.Warn("failed to connect to database", "attempt", attempt, "error", err.Error())
+		if attempt < dbConnectAttempts {
+			time.Sleep(dbConnectRetry)
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", dbConnectAttempts, err)
+}
+
+// migrateOnStart applies or checks the service's migrations as selected by
+// MIGRATE_ON_START
+func migrateOnStart(db *gorm.DB, cfg Config) error {
+	if cfg.Database.Migrations == nil || cfg.Database.MigrateOnStart == MigrateOff {
+		return nil
+	}
+	migrator, err := migrate.New(db, cfg.Database.Migrations, cfg.Name)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if cfg.Database.MigrateOnStart == MigrateCheck {
+		if err := migrator.Check(ctx); err != nil {
+			return fmt.Errorf("%w, run %q first", err, cfg.Name+" migrate up")
+		}
+		return nil
+	}
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		logging.Logger.Info("database migrated", "service", cfg.Name, "applied", applied)
+	}
+	return nil
+}
+
+// Migrate runs the migrate command given by args against the service's
+// database, without starting the service. See migrate.Usage.
+func Migrate(cfg Config, args []string) error {
+	if cfg.Database.Migrations == nil {
+		return fmt.Errorf("%s has no migrations", cfg.Name)
+	}
+	db, err := connectDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator, err := migrate.New(db, cfg.Database.Migrations, cfg.Name)
+	if err != nil {
+		return err
+	}
+	return migrate.Command(context.Background(), migrator, args, os.Stdout)
+}
+
+// Go runs a background worker, such as an event relay or subscriber. Its
+// context is cancelled on shutdown once requests have drained, and Run waits
+// for it to return.
+func (s *Service) Go(worker func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		worker(s.ctx)
+	}()
+}
+
+// Run registers the service, serves its router until SIGINT or SIGTERM and
+// then shuts down gracefully: the instance is deregistered so no new traffic
+// arrives, in-flight requests drain, background workers stop, and the
+// connections are closed.
+func (s *Service) Run() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Config.Port))
+	if err != nil {
+		s.stopWorkers(context.Background())
+		s.close()
+		return fmt.Errorf("failed to listen on port %d: %w", s.Config.Port, err)
+	}
+	srv := &http.Server{
+		Handler:           s.Router,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	// The listener is up, so the registry's first readiness check can pass
+	instance := registry.InstanceFromEnv(s.Config.Name, s.Config.Port, s.Config.Tags...)
+	if err := s.Registry.Register(context.Background(), instance); err != nil {
+		srv.Close()
+		s.stopWorkers(context.Background())
+		s.close()
+		return fmt.Errorf("failed to register service: %w", err)
+	}
+	logging.Logger.Info("service started", "service", s.Config.Name, "port", s.Config.Port, "instance", instance.ID)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	var errs []error
+	select {
+	case sig := <-quit:
+		logging.Logger.Info("shutting down", "service", s.Config.Name, "signal", sig.String())
+	case err := <-serveErr:
+		errs = append(errs, fmt.Errorf("server failed: %w", err))
+	}
+	return errors.Join(append(errs, s.shutdown(srv, instance.ID))...)
+}
+
+// shutdown stops the service within the shutdown timeout
+func (s *Service) shutdown(srv *http.Server, instanceID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	s.draining.Store(true)
+	if err := s.Registry.Deregister(ctx, instanceID); err != nil {
+		errs = append(errs, err)
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain requests: %w", err))
+	}
+	if err := s.stopWorkers(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	s.close()
+	return errors.Join(errs...)
+}
+
+// stopWorkers cancels the background workers and waits for them until ctx is done
+func (s *Service) stopWorkers(ctx context.Context) error {
+	s.stop()
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("background workers did not stop in time")
+	}
+}
+
+// close closes the Redis and database connections
+func (s *Service) close() {
+	if s.Redis != nil {
+		s.Redis.Close()
+	}
+	if s.DB != nil {
+		if sqlDB, err := s.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+}
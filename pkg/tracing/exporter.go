@@ -0,0 +1,139 @@
+// pkg/tracing/exporter.go
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"e-commerce-platform/pkg/config"
+)
+
+// Exporter receives spans once they have ended
+type Exporter interface {
+	Export(span *Span)
+}
+
+// NoopExporter discards spans
+type NoopExporter struct{}
+
+func (NoopExporter) Export(*Span) {}
+
+// WriterExporter writes each span as one JSON line
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter writes spans to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewStdoutExporter writes spans to stdout
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter appends spans to the file at path
+func NewFileExporter(path string) (*WriterExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return NewWriterExporter(file), nil
+}
+
+func (e *WriterExporter) Export(span *Span) {
+	span.mu.Lock()
+	data, err := json.Marshal(span)
+	span.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to encode span %s: %v", span.Name, err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to export span %s: %v", span.Name, err)
+	}
+}
+
+// InMemoryExporter keeps finished spans in memory, for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewInMemoryExporter creates an empty in-memory exporter
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported so far, oldest first
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset discards the recorded spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// Config selects the exporter, see config.Load
+type Config struct {
+	// Exporter is "none", "stdout" or "file". Tracing is off by default.
+	Exporter string `env:"TRACING_EXPORTER" default:"none" oneof:"none stdout file"`
+	// File is where the file exporter writes spans
+	File string `env:"TRACING_FILE" default:"traces.jsonl"`
+}
+
+// NewExporter creates the exporter selected by cfg.Exporter
+func NewExporter(cfg Config) (Exporter, error) {
+	switch cfg.Exporter {
+	case "none":
+		return NoopExporter{}, nil
+	case "stdout":
+		return NewStdoutExporter(), nil
+	case "file":
+		return NewFileExporter(cfg.File)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", cfg.Exporter)
+	}
+}
+
+// ExporterFromEnv creates the exporter named by TRACING_EXPORTER: "stdout",
+// "file" (written to TRACING_FILE) or "none", from the configuration loaded
+// with config.Load
+func ExporterFromEnv() (Exporter, error) {
+	var cfg Config
+	if err := config.Load(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid tracing configuration:\n%w", err)
+	}
+	return NewExporter(cfg)
+}
+
+// InitFromEnv initializes the package tracer with the exporter from the
+// environment. An invalid configuration is an error rather than no tracing.
+func InitFromEnv(service string) (*Tracer, error) {
+	exporter, err := ExporterFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return Init(service, exporter), nil
+}
@@ -0,0 +1,78 @@
+// pkg/tracing/gorm.go
+
+package tracing
+
+import (
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin creates a span for every query run with a context that carries a
+// span, e.g. db.WithContext(c.Request.Context()) inside a traced handler
+type GormPlugin struct{}
+
+// NewGormPlugin returns the plugin to register with db.Use
+func NewGormPlugin() gorm.Plugin {
+	return GormPlugin{}
+}
+
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", db.Callback().Create().Before("gorm:create").Register, db.Callback().Create().After("gorm:create").Register},
+		{"query", db.Callback().Query().Before("gorm:query").Register, db.Callback().Query().After("gorm:query").Register},
+		{"update", db.Callback().Update().Before("gorm:update").Register, db.Callback().Update().After("gorm:update").Register},
+		{"delete", db.Callback().Delete().Before("gorm:delete").Register, db.Callback().Delete().After("gorm:delete").Register},
+		{"row", db.Callback().Row().Before("gorm:row").Register, db.Callback().Row().After("gorm:row").Register},
+		{"raw", db.Callback().Raw().Before("gorm:raw").Register, db.Callback().Raw().After("gorm:raw").Register},
+	}
+
+	for _, cb := range callbacks {
+		if err := cb.before("tracing:before_"+cb.operation, startQuerySpan(cb.operation)); err != nil {
+			return err
+		}
+		if err := cb.after("tracing:after_"+cb.operation, endQuerySpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startQuerySpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || SpanFromContext(ctx) == nil {
+			return
+		}
+
+		_, span := Start(ctx, "gorm."+operation, KindClient)
+		span.SetAttribute("db.system", "postgresql")
+		span.SetAttribute("db.operation", operation)
+		if db.Statement.Table != "" {
+			span.SetAttribute("db.table", db.Statement.Table)
+		}
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endQuerySpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(*Span)
+	span.SetAttribute("db.statement", db.Statement.SQL.String())
+	span.SetAttribute("db.rows_affected", db.Statement.RowsAffected)
+	if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
+		span.SetError(db.Error)
+	}
+	span.End()
+}
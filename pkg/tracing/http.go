@@ -0,0 +1,97 @@
+// pkg/tracing/http.go
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Extract continues the trace carried by the traceparent header, if present
+func Extract(ctx context.Context, header http.Header) context.Context {
+	if sc, ok := ParseTraceparent(header.Get(HeaderTraceparent)); ok {
+		return ContextWithRemote(ctx, sc)
+	}
+	return ctx
+}
+
+// Inject writes the current span of ctx into the traceparent header
+func Inject(ctx context.Context, header http.Header) {
+	if sc, ok := spanContextFromContext(ctx); ok {
+		header.Set(HeaderTraceparent, sc.Traceparent())
+	}
+}
+
+// Middleware starts a server span for every request, continuing the caller's
+// trace when it sent a traceparent header. Handlers reach the span through
+// the request context.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := Extract(c.Request.Context(), c.Request.Header)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, route), KindServer)
+		defer span.End()
+
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(HeaderTraceparent, span.Context().Traceparent())
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", status)
+		if requestID := c.GetString("request_id"); requestID != "" {
+			span.SetAttribute("request_id", requestID)
+		}
+		if userID := c.GetString("user_id"); userID != "" {
+			span.SetAttribute("user_id", userID)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("HTTP %d", status))
+		}
+	}
+}
+
+// Transport creates a client span for every outbound request and propagates it
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), fmt.Sprintf("%s %s", req.Method, req.URL.Host), KindClient)
+	defer span.End()
+
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.String())
+
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(fmt.Errorf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
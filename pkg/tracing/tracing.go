@@ -0,0 +1,260 @@
+// pkg/tracing/tracing.go
+
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderTraceparent is the W3C Trace Context header
+const HeaderTraceparent = "traceparent"
+
+// Span kinds, following the OpenTelemetry names
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+)
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// Traceparent formats the span context as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields, later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !validHexID(traceID, 32) || !validHexID(spanID, 16) || !validHexID(flags, 2) {
+		return SpanContext{}, false
+	}
+
+	flagBits, _ := hex.DecodeString(flags)
+	return SpanContext{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Sampled: flagBits[0]&0x01 == 0x01,
+	}, true
+}
+
+// validHexID accepts lowercase hex of the given length that is not all zeros
+func validHexID(id string, length int) bool {
+	if len(id) != length {
+		return false
+	}
+	zero := true
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+		if c != '0' {
+			zero = false
+		}
+	}
+	return length == 2 || !zero
+}
+
+func newID(bytes int) string {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		return strings.Repeat("0", bytes*2-1) + "1"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Span is a timed operation within a trace. Spans are exported when they end.
+type Span struct {
+	Name          string                 `json:"name"`
+	Service       string                 `json:"service"`
+	Kind          string                 `json:"kind"`
+	TraceID       string                 `json:"trace_id"`
+	SpanID        string                 `json:"span_id"`
+	ParentSpanID  string                 `json:"parent_span_id,omitempty"`
+	StartTime     time.Time              `json:"start_time"`
+	EndTime       time.Time              `json:"end_time"`
+	DurationMS    float64                `json:"duration_ms"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Status        string                 `json:"status"`
+	StatusMessage string                 `json:"status_message,omitempty"`
+
+	tracer *Tracer
+	mu     sync.Mutex
+	ended  bool
+}
+
+// Context returns the span context used to propagate this span
+func (s *Span) Context() SpanContext {
+	return SpanContext{TraceID: s.TraceID, SpanID: s.SpanID, Sampled: true}
+}
+
+// SetAttribute records a key/value pair on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Status = "error"
+	s.StatusMessage = err.Error()
+}
+
+// End completes the span and hands it to the exporter. Calling End twice has no effect.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.DurationMS = float64(s.EndTime.Sub(s.StartTime).Microseconds()) / 1000
+	s.mu.Unlock()
+
+	s.tracer.exporter().Export(s)
+}
+
+// Tracer creates spans for one service
+type Tracer struct {
+	service string
+
+	mu  sync.RWMutex
+	exp Exporter
+}
+
+// NewTracer creates a tracer that sends finished spans to exporter
+func NewTracer(service string, exporter Exporter) *Tracer {
+	if exporter == nil {
+		exporter = NoopExporter{}
+	}
+	return &Tracer{service: service, exp: exporter}
+}
+
+func (t *Tracer) exporter() Exporter {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.exp
+}
+
+// SetExporter replaces the exporter of the tracer
+func (t *Tracer) SetExporter(exporter Exporter) {
+	if exporter == nil {
+		exporter = NoopExporter{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exp = exporter
+}
+
+// Start begins a span as a child of the span or remote span context in ctx,
+// or as the root of a new trace
+func (t *Tracer) Start(ctx context.Context, name, kind string) (context.Context, *Span) {
+	span := &Span{
+		Name:      name,
+		Service:   t.service,
+		Kind:      kind,
+		SpanID:    newID(8),
+		StartTime: time.Now(),
+		Status:    "ok",
+		tracer:    t,
+	}
+
+	if parent, ok := spanContextFromContext(ctx); ok {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// SpanFromContext returns the current span, if any
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemote returns a copy of ctx whose next span continues the remote trace
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func spanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context(), true
+	}
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+var (
+	globalMu     sync.RWMutex
+	globalTracer = NewTracer("unknown", nil)
+)
+
+// Init sets the service name and exporter used by the package level functions
+func Init(service string, exporter Exporter) *Tracer {
+	tracer := NewTracer(service, exporter)
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	globalTracer = tracer
+	return tracer
+}
+
+// Default returns the tracer set by Init
+func Default() *Tracer {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return globalTracer
+}
+
+// Start begins a span with the tracer set by Init
+func Start(ctx context.Context, name, kind string) (context.Context, *Span) {
+	return Default().Start(ctx, name, kind)
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,19 +16,53 @@ import (
 type Service struct {
 	Name    string
 	Path    string
+	Port    int
 	Process *exec.Cmd
 }
 
+// staticRegistry lists the services for REGISTRY_SERVICES, so they find each
+// other on localhost without a Consul agent
+func staticRegistry(services []Service) string {
+	entries := make([]string, 0, len(services))
+	for _, s := range services {
+		if s.Port != 0 {
+			entries = append(entries, fmt.Sprintf("%s=localhost:%d", s.Name, s.Port))
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
 func main() {
 	// Define services
 	services := []Service{
 		{Name: "consul", Path: "consul"},
 		{Name: "gateway", Path: "gateway"},
-		{Name: "user-service", Path: "services/user"},
-		{Name: "product-service", Path: "services/product"},
-		{Name: "order-service", Path: "services/order"},
-		{Name: "inventory-service", Path: "services/inventory"},
-		{Name: "payment-service", Path: "services/payment"},
+		{Name: "user-service", Path: "services/user", Port: 8002},
+		{Name: "product-service", Path: "services/product", Port: 8000},
+		{Name: "order-service", Path: "services/order", Port: 8001},
+		{Name: "inventory-service", Path: "services/inventory", Port: 8003},
+		{Name: "payment-service", Path: "services/payment", Port: 8004},
+	}
+
+	// Without a Consul binary, or with REGISTRY=static, the services use a
+	// static registry of their localhost ports instead
+	registry := os.Getenv("REGISTRY")
+	if registry == "" {
+		if _, err := exec.LookPath("consul"); err != nil {
+			log.Println("consul not found in PATH, using a static service registry")
+			registry = "static"
+		}
+	}
+	var env []string
+	if registry == "static" {
+		withoutConsul := services[:0]
+		for _, s := range services {
+			if s.Name != "consul" {
+				withoutConsul = append(withoutConsul, s)
+			}
+		}
+		services = withoutConsul
+		env = []string{"REGISTRY=static", "REGISTRY_SERVICES=" + staticRegistry(services)}
 	}
 
 	// Create context with cancellation
@@ -41,7 +77,7 @@ func main() {
 		wg.Add(1)
 		go func(s *Service) {
 			defer wg.Done()
-			startService(ctx, s)
+			startService(ctx, s, env)
 		}(&services[i])
 	}
 
@@ -69,7 +105,7 @@ func main() {
 	}
 }
 
-func startService(ctx context.Context, s *Service) {
+func startService(ctx context.Context, s *Service, env []string) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -93,7 +129,10 @@ func startService(ctx context.Context, s *Service) {
 			s.Process.Dir = s.Path
 
 			// Set up environment variables
-			s.Process.Env = os.Environ()
+			s.Process.Env = append(os.Environ(), env...)
+			if s.Port != 0 {
+				s.Process.Env = append(s.Process.Env, fmt.Sprintf("PORT=%d", s.Port))
+			}
 
 			// Redirect output
 			s.Process.Stdout = os.Stdout
@@ -0,0 +1,112 @@
+// expiry.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// expiryScanInterval is how often the leader looks for expired stock
+	expiryScanInterval = time.Hour
+
+	// expiryLeadership names the leader election of the scans and its fence
+	expiryLeadership = "inventory-expiry-scan"
+)
+
+// errStaleFence is returned when a newer leader has already written with a
+// higher fencing token
+var errStaleFence = errors.New("fencing token superseded by a newer leader")
+
+// checkFence records fence as the latest token of name within tx, or returns
+// errStaleFence when a newer leader has written with a higher one. The fence
+// row stays locked until tx ends, so the writes of two leaders cannot
+// interleave, and a leader whose lease expired mid-scan cannot write after
+// its successor.
+func checkFence(tx *gorm.DB, name string, fence int64) error {
+	result := tx.Exec(`INSERT INTO lock_fences (name, token) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET token = excluded.token
+		WHERE lock_fences.token <= excluded.token`, name, fence)
+	if result.Error != nil {
+		return fmt.Errorf("failed to check fencing token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errStaleFence
+	}
+	return nil
+}
+
+// runExpiryScans marks expired items and raises an alert for each until ctx is
+// cancelled. It runs on the elected leader only, so alerts are raised once.
+// Every write carries the leader's fencing token, and the scans stop once a
+// newer leader has written.
+func runExpiryScans(ctx context.Context, db *gorm.DB, fence int64) {
+	log.Printf("Scanning for expired stock every %s (fencing token %d)", expiryScanInterval, fence)
+
+	ticker := time.NewTicker(expiryScanInterval)
+	defer ticker.Stop()
+	for {
+		err := scanExpired(ctx, db, fence)
+		if errors.Is(err, errStaleFence) {
+			log.Printf("Stopping expiry scans with fencing token %d: a newer leader took over", fence)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Expiry scan failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanExpired marks items past their expiry date as expired, one transaction
+// per item, each checking the fencing token first
+func scanExpired(ctx context.Context, db *gorm.DB, fence int64) error {
+	var items []InventoryItem
+	if err := db.WithContext(ctx).
+		Where("expiry_date < ? AND status <> ?", time.Now(), "expired").
+		Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var alert *StockAlert
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := checkFence(tx, expiryLeadership, fence); err != nil {
+				return err
+			}
+			// The status check keeps a scan that overlaps a previous leader's from alerting twice
+			result := tx.Model(&InventoryItem{}).
+				Where("id = ? AND status <> ?", item.ID, "expired").
+				Update("status", "expired")
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			alert = &StockAlert{
+				ItemID:  item.ID,
+				Type:    "expired",
+				Message: "Stock has passed its expiry date",
+				Status:  "pending",
+			}
+			if err := tx.Create(alert).Error; err != nil {
+				return err
+			}
+			return emitStockAlert(tx, item, *alert)
+		})
+		if err != nil {
+			return err
+		}
+		if alert != nil {
+			stockAlerts.WithLabelValues(alert.Type).Inc()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory database with the tables the expiry scan writes
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own empty in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// SQLite has no uuid_generate_v4(), so the tables are created by hand
+	for _, table := range []string{
+		`CREATE TABLE inventory_items (
+			id TEXT PRIMARY KEY,
+			created_at DATETIME,
+			updated_at DATETIME,
+			deleted_at DATETIME,
+			product_id TEXT NOT NULL,
+			quantity INTEGER NOT NULL,
+			reorder_point INTEGER NOT NULL,
+			reorder_quantity INTEGER NOT NULL,
+			location TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'available',
+			batch_number TEXT,
+			expiry_date DATETIME,
+			last_stock_check DATETIME,
+			notes TEXT
+		)`,
+		`CREATE TABLE stock_alerts (
+			id TEXT PRIMARY KEY,
+			created_at DATETIME,
+			updated_at DATETIME,
+			deleted_at DATETIME,
+			item_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			message TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			resolved_at DATETIME
+		)`,
+		`CREATE TABLE outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_id TEXT NOT NULL UNIQUE,
+			event_type TEXT NOT NULL,
+			event TEXT NOT NULL,
+			created_at DATETIME,
+			published_at DATETIME,
+			attempts INTEGER,
+			last_error TEXT
+		)`,
+		`CREATE TABLE lock_fences (
+			name TEXT PRIMARY KEY,
+			token BIGINT NOT NULL
+		)`,
+	} {
+		if err := db.Exec(table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Alerts get their ID from the database in Postgres
+	db.Callback().Create().Before("gorm:create").Register("test:uuid", func(db *gorm.DB) {
+		if alert, ok := db.Statement.Dest.(*StockAlert); ok && alert.ID == uuid.Nil {
+			alert.ID = uuid.New()
+		}
+	})
+	return db
+}
+
+// addExpiredItem stores an item that expired yesterday
+func addExpiredItem(t *testing.T, db *gorm.DB) InventoryItem {
+	t.Helper()
+	expired := time.Now().Add(-24 * time.Hour)
+	item := InventoryItem{ID: uuid.New(), ProductID: uuid.New(), Quantity: 5, ReorderPoint: 1, ReorderQuantity: 10, Location: "A1", Status: "available", ExpiryDate: &expired}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// status returns the stored status of an item
+func status(t *testing.T, db *gorm.DB, item InventoryItem) string {
+	t.Helper()
+	var stored InventoryItem
+	if err := db.First(&stored, "id = ?", item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return stored.Status
+}
+
+func TestScanExpiredIsFenced(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	// The leader with token 2 scans first
+	first := addExpiredItem(t, db)
+	if err := scanExpired(ctx, db, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(t, db, first); got != "expired" {
+		t.Fatalf("status %q, want expired", got)
+	}
+
+	// A previous leader whose lease has expired cannot write any more
+	second := addExpiredItem(t, db)
+	if err := scanExpired(ctx, db, 1); !errors.Is(err, errStaleFence) {
+		t.Fatalf("scan with a stale token returned %v, want %v", err, errStaleFence)
+	}
+	if got := status(t, db, second); got != "available" {
+		t.Errorf("stale leader changed the status to %q", got)
+	}
+
+	// The current leader keeps scanning, and so does its successor
+	for _, fence := range []int64{2, 3} {
+		if err := scanExpired(ctx, db, fence); err != nil {
+			t.Fatalf("scan with token %d: %v", fence, err)
+		}
+	}
+	if got := status(t, db, second); got != "expired" {
+		t.Errorf("status %q, want expired", got)
+	}
+
+	var alerts, events int64
+	db.Model(&StockAlert{}).Count(&alerts)
+	db.Table("outbox").Count(&events)
+	if alerts != 2 || events != 2 {
+		t.Errorf("raised %d alerts and %d events, want one of each per item", alerts, events)
+	}
+}
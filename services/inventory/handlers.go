@@ -6,11 +6,35 @@ import (
 	"net/http"
 	"time"
 
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/metrics"
+	"e-commerce-platform/pkg/outbox"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var stockAlerts = metrics.NewCounterVec(
+	"stock_alerts_total",
+	"Number of stock alerts raised, by alert type.",
+	"type",
+)
+
+// eventSource names inventory-service in the events it publishes
+const eventSource = "inventory-service"
+
+// emitStockAlert writes a raised stock alert event to the outbox within tx
+func emitStockAlert(tx *gorm.DB, item InventoryItem, alert StockAlert) error {
+	return outbox.Emit(tx, eventSource, events.TypeStockAlertRaised, events.StockAlertRaised{
+		AlertID:   alert.ID.String(),
+		ItemID:    item.ID.String(),
+		ProductID: item.ProductID.String(),
+		AlertType: alert.Type,
+		Message:   alert.Message,
+	})
+}
+
 type CreateInventoryItemRequest struct {
 	ProductID       uuid.UUID `json:"product_id" binding:"required"`
 	Quantity        int       `json:"quantity" binding:"required,min=0"`
@@ -24,6 +48,7 @@ type CreateInventoryItemRequest struct {
 
 func CreateInventoryItem(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req CreateInventoryItemRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -52,20 +77,42 @@ func CreateInventoryItem(db *gorm.DB) gin.HandlerFunc {
 			Notes:           req.Notes,
 		}
 
-		if err := db.Create(&item).Error; err != nil {
+		var alert *StockAlert
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			if err := outbox.Emit(tx, eventSource, events.TypeStockChanged, events.StockChanged{
+				ItemID:          item.ID.String(),
+				ProductID:       item.ProductID.String(),
+				TransactionType: "received",
+				Quantity:        item.Quantity,
+				NewStock:        item.Quantity,
+			}); err != nil {
+				return err
+			}
+
+			// Check if we need to create a low stock alert
+			if item.Quantity <= item.ReorderPoint {
+				alert = &StockAlert{
+					ItemID:  item.ID,
+					Type:    "low_stock",
+					Message: "Stock level is below reorder point",
+					Status:  "pending",
+				}
+				if err := tx.Create(alert).Error; err != nil {
+					return err
+				}
+				return emitStockAlert(tx, item, *alert)
+			}
+			return nil
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create inventory item"})
 			return
 		}
-
-		// Check if we need to create a low stock alert
-		if item.Quantity <= item.ReorderPoint {
-			alert := StockAlert{
-				ItemID:  item.ID,
-				Type:    "low_stock",
-				Message: "Stock level is below reorder point",
-				Status:  "pending",
-			}
-			db.Create(&alert)
+		if alert != nil {
+			stockAlerts.WithLabelValues(alert.Type).Inc()
 		}
 
 		c.JSON(http.StatusCreated, item)
@@ -81,6 +128,7 @@ type UpdateStockRequest struct {
 
 func UpdateStock(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req UpdateStockRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -147,7 +195,6 @@ func UpdateStock(db *gorm.DB) gin.HandlerFunc {
 		tx := db.Begin()
 
 		previousStock := item.Quantity
-		newStock = newStock
 
 		// Create transaction record
 		transaction := InventoryTransaction{
@@ -174,21 +221,47 @@ func UpdateStock(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Check if we need to create a low stock alert
+		var alert *StockAlert
 		if newStock <= item.ReorderPoint {
-			alert := StockAlert{
+			alert = &StockAlert{
 				ItemID:  item.ID,
 				Type:    "low_stock",
 				Message: "Stock level is below reorder point",
 				Status:  "pending",
 			}
-			if err := tx.Create(&alert).Error; err != nil {
+			if err := tx.Create(alert).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create alert"})
 				return
 			}
+			if err := emitStockAlert(tx, item, *alert); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock alert event"})
+				return
+			}
 		}
 
-		tx.Commit()
+		if err := outbox.Emit(tx, eventSource, events.TypeStockChanged, events.StockChanged{
+			ItemID:          item.ID.String(),
+			ProductID:       item.ProductID.String(),
+			TransactionType: req.Type,
+			Quantity:        req.Quantity,
+			PreviousStock:   previousStock,
+			NewStock:        newStock,
+			Reference:       req.Reference,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record stock change event"})
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit stock update"})
+			return
+		}
+		if alert != nil {
+			stockAlerts.WithLabelValues(alert.Type).Inc()
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"previous_stock": previousStock,
 			"new_stock":      newStock,
@@ -199,6 +272,7 @@ func UpdateStock(db *gorm.DB) gin.HandlerFunc {
 
 func GetInventoryItem(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		id := c.Param("id")
 		var item InventoryItem
 		if err := db.First(&item, "id = ?", id).Error; err != nil {
@@ -215,6 +289,7 @@ func GetInventoryItem(db *gorm.DB) gin.HandlerFunc {
 
 func ListInventory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var items []InventoryItem
 		if err := db.Find(&items).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch inventory"})
@@ -226,6 +301,7 @@ func ListInventory(db *gorm.DB) gin.HandlerFunc {
 
 func GetTransactionHistory(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		itemID := c.Param("id")
 		var transactions []InventoryTransaction
 		if err := db.Where("item_id = ?", itemID).Find(&transactions).Error; err != nil {
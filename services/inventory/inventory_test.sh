@@ -10,8 +10,21 @@ NC='\033[0m' # No Color
 
 echo "🚀 Starting Inventory API tests..."
 
+# Register and log in a throwaway user, the gateway requires a bearer token
+TEST_EMAIL="inventory$(date +%s)@example.com"
+curl -s -X POST "http://localhost:8081/api/v1/users/register" \
+  -H "Content-Type: application/json" \
+  -d '{"email": "'"${TEST_EMAIL}"'", "password": "password123", "first_name": "Test", "last_name": "User"}' > /dev/null
+TOKEN=$(curl -s -X POST "http://localhost:8081/api/v1/users/login" \
+  -H "Content-Type: application/json" \
+  -d '{"email": "'"${TEST_EMAIL}"'", "password": "password123"}' | jq -r '.token')
+if [ -z "$TOKEN" ] || [ "$TOKEN" == "null" ]; then
+    echo -e "${RED}Failed to obtain auth token${NC}"
+    exit 1
+fi
+
 # Create a test product first to use its ID
-TEST_PRODUCT_RESPONSE=$(curl -s -X POST "http://localhost:8081/api/v1/products" \
+TEST_PRODUCT_RESPONSE=$(curl -s -X POST "http://localhost:8081/api/v1/products" -H "Authorization: Bearer ${TOKEN}" \
   -H "Content-Type: application/json" \
   -d '{
     "name": "Test Product",
@@ -28,7 +41,7 @@ if [ -z "$PRODUCT_ID" ] || [ "$PRODUCT_ID" == "null" ]; then
 fi
 
 echo -e "\n${GREEN}1. Testing Create Inventory Item${NC}"
-CREATE_RESPONSE=$(curl -s -X POST "${BASE_URL}/items" \
+CREATE_RESPONSE=$(curl -s -X POST "${BASE_URL}/items" -H "Authorization: Bearer ${TOKEN}" \
   -H "Content-Type: application/json" \
   -d '{
     "product_id": "'"${PRODUCT_ID}"'",
@@ -50,11 +63,11 @@ if [ -z "$INVENTORY_ID" ] || [ "$INVENTORY_ID" == "null" ] || [[ ! "$INVENTORY_I
 fi
 
 echo -e "\n${GREEN}2. Testing Get Inventory Item${NC}"
-GET_RESPONSE=$(curl -s -X GET "${BASE_URL}/items/${INVENTORY_ID}")
+GET_RESPONSE=$(curl -s -X GET "${BASE_URL}/items/${INVENTORY_ID}" -H "Authorization: Bearer ${TOKEN}")
 echo "Response: $GET_RESPONSE"
 
 echo -e "\n${GREEN}3. Testing Update Stock (Receive)${NC}"
-RECEIVE_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" \
+RECEIVE_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" -H "Authorization: Bearer ${TOKEN}" \
   -H "Content-Type: application/json" \
   -d '{
     "quantity": 50,
@@ -65,7 +78,7 @@ RECEIVE_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" \
 echo "Response: $RECEIVE_RESPONSE"
 
 echo -e "\n${GREEN}4. Testing Update Stock (Ship)${NC}"
-SHIP_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" \
+SHIP_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" -H "Authorization: Bearer ${TOKEN}" \
   -H "Content-Type: application/json" \
   -d '{
     "quantity": 20,
@@ -76,15 +89,15 @@ SHIP_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" \
 echo "Response: $SHIP_RESPONSE"
 
 echo -e "\n${GREEN}5. Testing List All Inventory${NC}"
-LIST_RESPONSE=$(curl -s -X GET "${BASE_URL}/items")
+LIST_RESPONSE=$(curl -s -X GET "${BASE_URL}/items" -H "Authorization: Bearer ${TOKEN}")
 echo "$LIST_RESPONSE"
 
 echo -e "\n${GREEN}6. Testing Get Transaction History${NC}"
-HISTORY_RESPONSE=$(curl -s -X GET "${BASE_URL}/items/${INVENTORY_ID}/transactions")
+HISTORY_RESPONSE=$(curl -s -X GET "${BASE_URL}/items/${INVENTORY_ID}/transactions" -H "Authorization: Bearer ${TOKEN}")
 echo "$HISTORY_RESPONSE"
 
 echo -e "\n${GREEN}7. Testing Invalid Stock Update${NC}"
-INVALID_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" \
+INVALID_RESPONSE=$(curl -s -X PUT "${BASE_URL}/items/${INVENTORY_ID}/stock" -H "Authorization: Bearer ${TOKEN}" \
   -H "Content-Type: application/json" \
   -d '{
     "quantity": -50,
@@ -1,135 +1,65 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/hashicorp/consul/api"
-	"github.com/joho/godotenv"
-	"github.com/redis/go-redis/v9"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/outbox"
+	"e-commerce-platform/pkg/service"
+	"github.com/arohanajit/inventory-service/migrations"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Initialize database
-	db, err := initDB()
+	cfg, err := service.LoadConfig("inventory-service", 8003, "inventory", "api")
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatal(err)
 	}
-
-	// Initialize Consul client
-	consulClient, err := initConsulClient()
-	if err != nil {
-		log.Fatal("Failed to initialize Consul client:", err)
+	cfg.Database.Migrations = migrations.FS
+
+	// "migrate <command>" manages the schema instead of starting the service
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := service.Migrate(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	// Redis elects the replica that scans for expired stock
+	cfg.Redis.Required = true
 
-	// Register service with Consul
-	if err := registerService(consulClient); err != nil {
-		log.Fatal("Failed to register service:", err)
-	}
-
-	// Initialize router
-	r := gin.Default()
-
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "UP"})
-	})
-
-	redisClient, err := redis.NewClient(
-		os.Getenv("REDIS_HOST"),
-		os.Getenv("REDIS_PORT"),
-		os.Getenv("REDIS_PASSWORD"),
-	)
+	svc, err := service.New(cfg)
 	if err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
+		log.Fatal("Failed to start inventory service:", err)
 	}
-	defer redisClient.Close()
+	db := svc.DB
 
-	// Initialize cache
-	cache := cache.NewServiceCache(redisClient) // Use appropriate constructor for each service
+	// Stock changes and alerts are written to the outbox and relayed to Redis Streams
+	svc.Go(outbox.NewRelay(db, events.FromClient(svc.Redis, events.Options{})).Run)
 
-	// Add rate limiting
-	rateLimiter := middleware.NewRateLimiter(redisClient, 100, time.Minute)
-	router.Use(rateLimiter.Middleware())
+	// Only the elected replica scans for expired stock
+	svc.Go(func(ctx context.Context) {
+		svc.Redis.RunAsLeader(ctx, expiryLeadership, 30*time.Second, func(ctx context.Context, fence int64) {
+			runExpiryScans(ctx, db, fence)
+		})
+	})
 
 	// API routes
-	v1 := r.Group("/api/v1/inventory")
+	// Users and API keys with the inventory scopes are admitted
+	read, write := middleware.RequireScope("inventory:read"), middleware.RequireScope("inventory:write")
+	v1 := svc.Router.Group("/api/v1/inventory")
+	v1.Use(middleware.NewRateLimiter(svc.Redis.Redis(), 100, time.Minute).Middleware())
 	{
-		v1.POST("/items", CreateInventoryItem(db))
-		v1.GET("/items", ListInventory(db))
-		v1.GET("/items/:id", GetInventoryItem(db))
-		v1.PUT("/items/:id/stock", UpdateStock(db))
-		v1.GET("/items/:id/transactions", GetTransactionHistory(db))
+		v1.POST("/items", write, CreateInventoryItem(db))
+		v1.GET("/items", read, ListInventory(db))
+		v1.GET("/items/:id", read, GetInventoryItem(db))
+		v1.PUT("/items/:id/stock", write, UpdateStock(db))
+		v1.GET("/items/:id/transactions", read, GetTransactionHistory(db))
 	}
 
-	// Run the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8003"
-	}
-	r.Run("0.0.0.0:" + port)
-}
-
-func initDB() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, err
-	}
-
-	// Enable uuid-ossp extension
-	db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";")
-
-	// Auto-migrate the schema
-	if err := db.AutoMigrate(&InventoryItem{}, &InventoryTransaction{}, &StockAlert{}); err != nil {
-		return nil, err
-	}
-
-	return db, nil
-}
-
-func initConsulClient() (*api.Client, error) {
-	config := api.DefaultConfig()
-	config.Address = os.Getenv("CONSUL_HTTP_ADDR")
-	if config.Address == "" {
-		config.Address = "http://localhost:8500"
-	}
-	return api.NewClient(config)
-}
-
-func registerService(client *api.Client) error {
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	registration := &api.AgentServiceRegistration{
-		ID:      "inventory-service",
-		Name:    "inventory-service",
-		Port:    port,
-		Address: "inventory-service",
-		Check: &api.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://inventory-service:%d/health", port),
-			Interval:                       "10s",
-			Timeout:                        "1s",
-			DeregisterCriticalServiceAfter: "30s",
-		},
-		Tags: []string{"inventory", "api"},
+	if err := svc.Run(); err != nil {
+		log.Fatal("Inventory service stopped:", err)
 	}
-	return client.Agent().ServiceRegister(registration)
 }
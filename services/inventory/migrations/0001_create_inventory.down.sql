@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stock_alerts;
+DROP TABLE IF EXISTS inventory_transactions;
+DROP TABLE IF EXISTS inventory_items;
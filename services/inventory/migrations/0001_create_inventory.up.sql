@@ -0,0 +1,52 @@
+-- Tables created by earlier releases through GORM are kept as they are
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS inventory_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    product_id UUID NOT NULL,
+    quantity BIGINT NOT NULL,
+    reorder_point BIGINT NOT NULL,
+    reorder_quantity BIGINT NOT NULL,
+    location TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'available',
+    batch_number TEXT,
+    expiry_date TIMESTAMPTZ,
+    last_stock_check TIMESTAMPTZ,
+    notes TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_items_deleted_at ON inventory_items (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_items_batch_number ON inventory_items (batch_number);
+
+CREATE TABLE IF NOT EXISTS inventory_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    item_id UUID NOT NULL,
+    type TEXT NOT NULL,
+    quantity BIGINT NOT NULL,
+    previous_stock BIGINT NOT NULL,
+    new_stock BIGINT NOT NULL,
+    reference TEXT,
+    notes TEXT,
+    CONSTRAINT fk_inventory_transactions_item FOREIGN KEY (item_id) REFERENCES inventory_items (id)
+);
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_deleted_at ON inventory_transactions (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_inventory_transactions_reference ON inventory_transactions (reference);
+
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    item_id UUID NOT NULL,
+    type TEXT NOT NULL,
+    message TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    resolved_at TIMESTAMPTZ,
+    CONSTRAINT fk_stock_alerts_item FOREIGN KEY (item_id) REFERENCES inventory_items (id)
+);
+CREATE INDEX IF NOT EXISTS idx_stock_alerts_deleted_at ON stock_alerts (deleted_at);
@@ -0,0 +1,5 @@
+-- Highest fencing token each leader election has written with, see checkFence
+CREATE TABLE IF NOT EXISTS lock_fences (
+    name TEXT PRIMARY KEY,
+    token BIGINT NOT NULL
+);
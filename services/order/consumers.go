@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"e-commerce-platform/pkg/events"
+
+	"gorm.io/gorm"
+)
+
+// resubscribeDelay is how long to wait before subscribing again after a failure
+var resubscribeDelay = 5 * time.Second
+
+// subscribePaymentEvents handles payment events until ctx is cancelled. A
+// failed subscription, e.g. while Redis is unreachable, is logged and retried,
+// so that a shutdown still stops the service in order.
+func subscribePaymentEvents(ctx context.Context, bus events.Bus, db *gorm.DB) {
+	for {
+		err := bus.Subscribe(ctx, "order-service", HandlePaymentEvents(db), events.TypePaymentCompleted, events.TypePaymentFailed)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Payment event subscription failed, retrying in %s: %v", resubscribeDelay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// paymentStatuses maps payment events to the payment status of their order
+var paymentStatuses = map[string]string{
+	events.TypePaymentCompleted: "paid",
+	events.TypePaymentFailed:    "failed",
+}
+
+// HandlePaymentEvents records the outcome of payments on their orders
+func HandlePaymentEvents(db *gorm.DB) events.Handler {
+	return func(ctx context.Context, event events.Event) error {
+		var payment struct {
+			OrderID string `json:"order_id"`
+		}
+		if err := event.Decode(&payment); err != nil {
+			return fmt.Errorf("%w: %v", events.ErrPermanent, err)
+		}
+
+		// A failed retry must not undo a payment that completed in the meantime
+		query := db.WithContext(ctx).Model(&Order{}).Where("id = ?", payment.OrderID)
+		if event.Type == events.TypePaymentFailed {
+			query = query.Where("payment_status <> ?", "paid")
+		}
+		if err := query.Update("payment_status", paymentStatuses[event.Type]).Error; err != nil {
+			return fmt.Errorf("failed to update payment status of order %s: %w", payment.OrderID, err)
+		}
+		return nil
+	}
+}
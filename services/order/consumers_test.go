@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"e-commerce-platform/pkg/events"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory database with the orders and order_items tables
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own empty in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// SQLite has no uuid_generate_v4(), so the tables are created by hand
+	for _, table := range []string{
+		`CREATE TABLE orders (
+			id TEXT PRIMARY KEY,
+			created_at DATETIME,
+			updated_at DATETIME,
+			deleted_at DATETIME,
+			user_id TEXT NOT NULL,
+			total_amount REAL NOT NULL,
+			status TEXT DEFAULT 'pending',
+			payment_status TEXT DEFAULT 'unpaid'
+		)`,
+		`CREATE TABLE order_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at DATETIME,
+			updated_at DATETIME,
+			deleted_at DATETIME,
+			order_id TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			quantity INTEGER NOT NULL,
+			price REAL NOT NULL
+		)`,
+	} {
+		if err := db.Exec(table).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// paymentEvent creates a payment event of eventType for an order
+func paymentEvent(t *testing.T, eventType string, orderID uuid.UUID) events.Event {
+	t.Helper()
+	event, err := events.New(context.Background(), "payment-service", eventType, map[string]string{"order_id": orderID.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestHandlePaymentEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   string
+	}{
+		{"completed", []string{events.TypePaymentCompleted}, "paid"},
+		{"failed", []string{events.TypePaymentFailed}, "failed"},
+		{"retry succeeds after a failure", []string{events.TypePaymentFailed, events.TypePaymentCompleted}, "paid"},
+		{"late failure after completion", []string{events.TypePaymentCompleted, events.TypePaymentFailed}, "paid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			order := Order{ID: uuid.New(), UserID: uuid.New(), TotalAmount: 10, Status: "pending", PaymentStatus: "unpaid"}
+			if err := db.Create(&order).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			handler := HandlePaymentEvents(db)
+			for _, eventType := range tt.events {
+				if err := handler(context.Background(), paymentEvent(t, eventType, order.ID)); err != nil {
+					t.Fatalf("%s: %v", eventType, err)
+				}
+			}
+
+			var stored Order
+			if err := db.First(&stored, "id = ?", order.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.PaymentStatus != tt.want {
+				t.Errorf("payment status %q, want %q", stored.PaymentStatus, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePaymentEventsMalformed(t *testing.T) {
+	event := events.Event{ID: "malformed", Type: events.TypePaymentFailed, Data: []byte(`"not an object"`)}
+	err := HandlePaymentEvents(newTestDB(t))(context.Background(), event)
+	if !errors.Is(err, events.ErrPermanent) {
+		t.Errorf("error %v, want a permanent error so the event is dead-lettered", err)
+	}
+}
+
+// unreachableBus fails the first subscriptions, like a bus whose Redis is down
+type unreachableBus struct {
+	events.Bus
+	failures int32
+	calls    atomic.Int32
+}
+
+func (b *unreachableBus) Subscribe(ctx context.Context, group string, handler events.Handler, types ...string) error {
+	if b.calls.Add(1) <= b.failures {
+		return errors.New("connection refused")
+	}
+	return b.Bus.Subscribe(ctx, group, handler, types...)
+}
+
+func TestSubscribePaymentEventsRetries(t *testing.T) {
+	delay := resubscribeDelay
+	resubscribeDelay = time.Millisecond
+	t.Cleanup(func() { resubscribeDelay = delay })
+
+	db := newTestDB(t)
+	order := Order{ID: uuid.New(), UserID: uuid.New(), TotalAmount: 10, Status: "pending", PaymentStatus: "unpaid"}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	bus := &unreachableBus{Bus: events.NewMemory(events.Options{Consumer: "test"}), failures: 2}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		subscribePaymentEvents(ctx, bus, db)
+	}()
+
+	// Once subscribed, payment events are recorded on their orders
+	deadline := time.Now().Add(time.Second)
+	for {
+		if bus.calls.Load() > bus.failures {
+			if err := bus.Publish(ctx, paymentEvent(t, events.TypePaymentCompleted, order.ID)); err != nil {
+				t.Fatal(err)
+			}
+			var stored Order
+			if err := db.First(&stored, "id = ?", order.ID).Error; err == nil && stored.PaymentStatus == "paid" {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("payment not recorded after %d subscription attempts", bus.calls.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Cancelling stops the subscriber instead of exiting the process
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber did not stop")
+	}
+}
@@ -1,21 +1,53 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"time"
+
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/metrics"
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/outbox"
+	"e-commerce-platform/pkg/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
-// CreateOrderRequest represents the request body for creating an order
+// productClient propagates the request ID and trace context on product lookups
+var productClient = &http.Client{
+	Timeout:   10 * time.Second,
+	Transport: tracing.NewTransport(logging.NewTransport(nil)),
+}
+
+var ordersCreated = metrics.NewCounterVec("orders_created_total", "Number of orders created.")
+
+// eventSource names order-service in the events it publishes
+const eventSource = "order-service"
+
+// eventItems converts order items to their event representation
+func eventItems(items []OrderItem) []events.OrderItem {
+	converted := make([]events.OrderItem, len(items))
+	for i, item := range items {
+		converted[i] = events.OrderItem{
+			ProductID: item.ProductID.String(),
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		}
+	}
+	return converted
+}
+
+// CreateOrderRequest represents the request body for creating an order. The
+// order belongs to the authenticated user.
 type CreateOrderRequest struct {
-	UserID string             `json:"user_id" binding:"required"`
-	Items  []OrderItemRequest `json:"items" binding:"required"` // Use a DTO for items
+	Items []OrderItemRequest `json:"items" binding:"required"` // Use a DTO for items
 }
 
 type OrderItemRequest struct {
@@ -23,8 +55,44 @@ type OrderItemRequest struct {
 	Quantity  int       `json:"quantity" binding:"required,min=1"`
 }
 
-func CreateOrder(db *gorm.DB) gin.HandlerFunc {
+var (
+	// errProductNotFound is returned when the product API cannot be reached or
+	// does not know the product
+	errProductNotFound = errors.New("product not found")
+	// errProductDecode is returned when the product API answers with an unexpected body
+	errProductDecode = errors.New("failed to decode product details")
+)
+
+// fetchProductPrice looks up the price of a product with the product API at
+// productServiceURL. The request continues the trace of ctx.
+func fetchProductPrice(ctx context.Context, productServiceURL string, productID uuid.UUID) (float64, error) {
+	productURL := fmt.Sprintf("%s/products/%s", productServiceURL, productID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, productURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := productClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errProductNotFound, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%w: product API returned %s", errProductNotFound, resp.Status)
+	}
+
+	var productDetails struct {
+		Price float64 `json:"price"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&productDetails); err != nil {
+		return 0, fmt.Errorf("%w: %v", errProductDecode, err)
+	}
+	return productDetails.Price, nil
+}
+
+// CreateOrder prices the items with the product API at productServiceURL
+func CreateOrder(db *gorm.DB, productServiceURL string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req CreateOrderRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -35,11 +103,11 @@ func CreateOrder(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		userID, err := uuid.Parse(req.UserID)
+		userID, err := uuid.Parse(middleware.UserID(c))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Invalid user ID format",
-				"details": "User ID must be in UUID format",
+				"details": "The authenticated user ID must be in UUID format",
 				"code":    "INVALID_USER_ID",
 			})
 			return
@@ -50,36 +118,37 @@ func CreateOrder(db *gorm.DB) gin.HandlerFunc {
 
 		// Get product details and calculate total amount
 		for _, item := range req.Items {
-			productURL := fmt.Sprintf("%s/products/%s", os.Getenv("PRODUCT_SERVICE_URL"), item.ProductID)
-			resp, err := http.Get(productURL)
-			if err != nil || resp.StatusCode != http.StatusOK {
+			price, err := fetchProductPrice(c.Request.Context(), productServiceURL, item.ProductID)
+			switch {
+			case errors.Is(err, errProductNotFound):
 				c.JSON(http.StatusBadRequest, gin.H{
 					"error":   "Invalid product ID",
 					"details": fmt.Sprintf("Product with ID %s not found", item.ProductID),
 					"code":    "INVALID_PRODUCT_ID",
 				})
 				return
-			}
-			defer resp.Body.Close()
-
-			var productDetails struct {
-				Price float64 `json:"price"`
-			}
-			if err := json.NewDecoder(resp.Body).Decode(&productDetails); err != nil {
+			case errors.Is(err, errProductDecode):
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error":   "Failed to decode product details",
 					"details": err.Error(),
 					"code":    "PRODUCT_DECODE_ERROR",
 				})
 				return
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to build product request",
+					"details": err.Error(),
+					"code":    "PRODUCT_LOOKUP_ERROR",
+				})
+				return
 			}
 
 			orderItems = append(orderItems, OrderItem{
 				ProductID: item.ProductID,
 				Quantity:  item.Quantity,
-				Price:     productDetails.Price,
+				Price:     price,
 			})
-			totalAmount += productDetails.Price * float64(item.Quantity)
+			totalAmount += price * float64(item.Quantity)
 		}
 
 		newOrder := Order{
@@ -89,7 +158,18 @@ func CreateOrder(db *gorm.DB) gin.HandlerFunc {
 			OrderItems:  orderItems,
 		}
 
-		if err := db.Create(&newOrder).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&newOrder).Error; err != nil {
+				return err
+			}
+			return outbox.Emit(tx, eventSource, events.TypeOrderCreated, events.OrderCreated{
+				OrderID:     newOrder.ID.String(),
+				UserID:      newOrder.UserID.String(),
+				TotalAmount: newOrder.TotalAmount,
+				Items:       eventItems(newOrder.OrderItems),
+			})
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to create order",
 				"details": "An internal error occurred while creating the order",
@@ -98,15 +178,26 @@ func CreateOrder(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		ordersCreated.WithLabelValues().Inc()
 		c.JSON(http.StatusCreated, newOrder)
 	}
 }
 
-// ListOrders handles GET /api/v1/orders
+// ownedBy restricts a query to the orders of the authenticated user. An
+// identity that is not a UUID owns no orders.
+func ownedBy(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	userID, _ := uuid.Parse(middleware.UserID(c))
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userID)
+	}
+}
+
+// ListOrders handles GET /api/v1/orders, listing the orders of the authenticated user
 func ListOrders(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var orders []Order
-		if err := db.Preload("OrderItems").Find(&orders).Error; err != nil {
+		if err := db.Scopes(ownedBy(c)).Preload("OrderItems").Find(&orders).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to fetch orders",
 				"details": "An internal error occurred while fetching orders",
@@ -119,9 +210,10 @@ func ListOrders(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// GetOrder handles GET /api/v1/orders/:id
+// GetOrder handles GET /api/v1/orders/:id. Orders of other users are not found.
 func GetOrder(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		orderID := c.Param("id")
 
 		// Parse UUID
@@ -135,7 +227,7 @@ func GetOrder(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var order Order
-		if err := db.Preload("OrderItems").First(&order, "id = ?", orderID).Error; err != nil {
+		if err := db.Scopes(ownedBy(c)).Preload("OrderItems").First(&order, "id = ?", orderID).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error":   "Order not found",
@@ -156,9 +248,10 @@ func GetOrder(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// UpdateOrder handles PUT /api/v1/orders/:id
+// UpdateOrder handles PUT /api/v1/orders/:id. Orders of other users are not found.
 func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		id := c.Param("id")
 
 		// Validate UUID format
@@ -173,7 +266,7 @@ func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 
 		// Find the existing order
 		var order Order
-		if err := db.Preload("OrderItems").First(&order, "id = ?", id).Error; err != nil {
+		if err := db.Scopes(ownedBy(c)).Preload("OrderItems").First(&order, "id = ?", id).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error":   "Order not found",
@@ -201,8 +294,11 @@ func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		tx := db.Begin()
+
 		// Delete existing order items
-		if err := db.Delete(order.OrderItems).Error; err != nil {
+		if err := tx.Delete(order.OrderItems).Error; err != nil {
+			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to update order",
 				"details": "An error occurred while updating order items",
@@ -226,7 +322,33 @@ func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Save the updated order
-		if err := db.Session(&gorm.Session{FullSaveAssociations: true}).Save(&order).Error; err != nil {
+		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(&order).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update order",
+				"details": "An internal error occurred while saving the order",
+				"code":    "UPDATE_ORDER_FAILED",
+			})
+			return
+		}
+
+		if err := outbox.Emit(tx, eventSource, events.TypeOrderUpdated, events.OrderUpdated{
+			OrderID:       order.ID.String(),
+			Status:        order.Status,
+			PaymentStatus: order.PaymentStatus,
+			TotalAmount:   order.TotalAmount,
+			Items:         eventItems(order.OrderItems),
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update order",
+				"details": "An internal error occurred while recording the order event",
+				"code":    "UPDATE_ORDER_FAILED",
+			})
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to update order",
 				"details": "An internal error occurred while saving the order",
@@ -239,9 +361,10 @@ func UpdateOrder(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// DeleteOrder handles DELETE /api/v1/orders/:id
+// DeleteOrder handles DELETE /api/v1/orders/:id. Orders of other users are not found.
 func DeleteOrder(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		id := c.Param("id")
 
 		// Validate UUID format
@@ -256,7 +379,7 @@ func DeleteOrder(db *gorm.DB) gin.HandlerFunc {
 
 		// Find the order with its items
 		var order Order
-		if err := db.Preload("OrderItems").First(&order, "id = ?", id).Error; err != nil {
+		if err := db.Scopes(ownedBy(c)).Preload("OrderItems").First(&order, "id = ?", id).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error":   "Order not found",
@@ -273,18 +396,16 @@ func DeleteOrder(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Delete order items
-		if err := db.Delete(order.OrderItems).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to delete order",
-				"details": "An error occurred while deleting order items",
-				"code":    "DELETE_ORDER_FAILED",
-			})
-			return
-		}
-
-		// Delete the order
-		if err := db.Delete(&order).Error; err != nil {
+		// Delete the order with its items
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(order.OrderItems).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&order).Error; err != nil {
+				return err
+			}
+			return outbox.Emit(tx, eventSource, events.TypeOrderDeleted, events.OrderDeleted{OrderID: order.ID.String()})
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to delete order",
 				"details": "An internal error occurred while deleting the order",
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestFetchProductPriceContinuesTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exporter := tracing.NewInMemoryExporter()
+	tracing.Init("order-service", exporter)
+	t.Cleanup(func() { tracing.Init("order-service", nil) })
+
+	// The product API records the trace it was called in
+	var received string
+	products := gin.New()
+	products.Use(tracing.Middleware())
+	products.GET("/products/:id", func(c *gin.Context) {
+		received = c.GetHeader(tracing.HeaderTraceparent)
+		c.JSON(http.StatusOK, gin.H{"price": 12.5})
+	})
+	productService := httptest.NewServer(products)
+	defer productService.Close()
+
+	// The lookup runs within the server span of an order request
+	ctx, orderSpan := tracing.Start(context.Background(), "POST /api/v1/orders", tracing.KindServer)
+	price, err := fetchProductPrice(ctx, productService.URL, uuid.New())
+	orderSpan.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 12.5 {
+		t.Errorf("price %v, want 12.5", price)
+	}
+
+	var client, productServer *tracing.Span
+	for _, span := range exporter.Spans() {
+		switch {
+		case span.Kind == tracing.KindClient:
+			client = span
+		case span.Kind == tracing.KindServer && span != orderSpan:
+			productServer = span
+		}
+	}
+	if client == nil || productServer == nil {
+		t.Fatalf("recorded %d spans, want a client span and the product server span", len(exporter.Spans()))
+	}
+
+	if client.TraceID != orderSpan.TraceID || client.ParentSpanID != orderSpan.SpanID {
+		t.Errorf("client span continues %s/%s, want the order span %s/%s", client.TraceID, client.ParentSpanID, orderSpan.TraceID, orderSpan.SpanID)
+	}
+	if want := client.Context().Traceparent(); received != want {
+		t.Errorf("product API received traceparent %q, want %q", received, want)
+	}
+	if productServer.TraceID != orderSpan.TraceID || productServer.ParentSpanID != client.SpanID {
+		t.Errorf("product server span continues %s/%s, want %s/%s", productServer.TraceID, productServer.ParentSpanID, orderSpan.TraceID, client.SpanID)
+	}
+}
+
+func TestOrdersAreScopedToTheUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+
+	owner, other := uuid.New(), uuid.New()
+	order := Order{ID: uuid.New(), UserID: owner, TotalAmount: 10, Status: "pending", PaymentStatus: "unpaid"}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(middleware.Identity())
+	v1 := router.Group("/api/v1/orders", middleware.RequireIdentity())
+	v1.GET("", ListOrders(db))
+	v1.GET("/:id", GetOrder(db))
+	v1.PUT("/:id", UpdateOrder(db))
+	v1.DELETE("/:id", DeleteOrder(db))
+
+	serve := func(method, path, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"status": "cancelled"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != "" {
+			req.Header.Set(middleware.HeaderUserID, userID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	orderPath := "/api/v1/orders/" + order.ID.String()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		userID string
+		want   int
+	}{
+		{"anonymous list", http.MethodGet, "/api/v1/orders", "", http.StatusUnauthorized},
+		{"owner gets", http.MethodGet, orderPath, owner.String(), http.StatusOK},
+		{"other user gets", http.MethodGet, orderPath, other.String(), http.StatusNotFound},
+		{"other user updates", http.MethodPut, orderPath, other.String(), http.StatusNotFound},
+		{"other user deletes", http.MethodDelete, orderPath, other.String(), http.StatusNotFound},
+		{"identity that is not a UUID", http.MethodGet, orderPath, "admin", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(tt.method, tt.path, tt.userID); rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	for userID, want := range map[uuid.UUID]int{owner: 1, other: 0} {
+		rec := serve(http.MethodGet, "/api/v1/orders", userID.String())
+		var orders []Order
+		if err := json.Unmarshal(rec.Body.Bytes(), &orders); err != nil {
+			t.Fatal(err)
+		}
+		if len(orders) != want {
+			t.Errorf("user %s listed %d orders, want %d", userID, len(orders), want)
+		}
+	}
+
+	var stored Order
+	if err := db.First(&stored, "id = ?", order.ID).Error; err != nil {
+		t.Fatalf("order of the owner is gone: %v", err)
+	}
+	if stored.Status != "pending" {
+		t.Errorf("another user changed the order status to %q", stored.Status)
+	}
+}
@@ -1,20 +1,22 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 
+	"e-commerce-platform/pkg/config"
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/health"
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/outbox"
+	"e-commerce-platform/pkg/service"
+	"github.com/arohanajit/order-service/migrations"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/hashicorp/consul/api"
-	"github.com/joho/godotenv"
-	"github.com/redis/go-redis/v9"
-	"gorm.io/driver/postgres" // Changed from "postgre" to "postgres"
-	"gorm.io/gorm"
 )
 
 func validateUUID() gin.HandlerFunc {
@@ -37,117 +39,66 @@ func validateUUID() gin.HandlerFunc {
 	}
 }
 
-func main() {
-	// Load environment variables
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Initialize database
-	db, err := initDB()
-	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
-	}
+// Settings is the configuration of the order service on top of service.Config
+type Settings struct {
+	// ProductServiceURL is the product API that order items are priced with,
+	// e.g. http://product-service:8000/api/v1
+	ProductServiceURL string `env:"PRODUCT_SERVICE_URL" required:"true"`
+}
 
-	redisClient, err := redis.NewClient(
-		os.Getenv("REDIS_HOST"),
-		os.Getenv("REDIS_PORT"),
-		os.Getenv("REDIS_PASSWORD"),
-	)
+func main() {
+	cfg, err := service.LoadConfig("order-service", 8001, "order", "api")
 	if err != nil {
-		log.Fatal("Failed to connect to Redis:", err)
-	}
-	defer redisClient.Close()
-
-	// Initialize cache
-	cache := cache.NewServiceCache(redisClient) // Use appropriate constructor for each service
-
-	// Add rate limiting
-	rateLimiter := middleware.NewRateLimiter(redisClient, 100, time.Minute)
-	router.Use(rateLimiter.Middleware())
-
-	// Consul client config
-	consulConfig := api.DefaultConfig()
-	consulConfig.Address = os.Getenv("CONSUL_HTTP_ADDR")
-	if consulConfig.Address == "" {
-		consulConfig.Address = "http://localhost:8500"
+		log.Fatal(err)
 	}
+	cfg.Database.Migrations = migrations.FS
 
-	consulClient, err := api.NewClient(consulConfig)
-	if err != nil {
-		log.Fatalf("Failed to create Consul client: %v", err)
+	// "migrate <command>" manages the schema instead of starting the service
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := service.Migrate(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	// Payment outcomes arrive on Redis Streams
+	cfg.Redis.Required = true
 
-	// Register Order Service with Consul
-	orderPort, _ := strconv.Atoi(os.Getenv("PORT"))
-	registration := &api.AgentServiceRegistration{
-		ID:      "order-service",
-		Name:    "order-service",
-		Port:    orderPort,
-		Address: "order-service",
-		Check: &api.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://order-service:%d/health", orderPort),
-			Interval:                       "10s",
-			Timeout:                        "1s",
-			DeregisterCriticalServiceAfter: "30s",
-		},
-		Tags: []string{"order", "api"},
+	var settings Settings
+	if err := config.Load(&settings); err != nil {
+		log.Fatalf("invalid configuration of order-service:\n%v", err)
 	}
+	config.Log("order-service", settings)
 
-	err = consulClient.Agent().ServiceRegister(registration)
+	svc, err := service.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to register order service with Consul: %v", err)
+		log.Fatal("Failed to start order service:", err)
 	}
+	db := svc.DB
 
-	// Deregister Order Service on exit
-	defer consulClient.Agent().ServiceDeregister(registration.ID)
+	// Orders cannot be priced without product-service
+	svc.Health.Add("product-service", health.Service(settings.ProductServiceURL))
 
-	// Initialize Gin router
-	router := gin.Default()
-	router.Use(gin.Logger())
-
-	// Basic health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "UP"})
+	// Order changes are written to the outbox and relayed to Redis Streams, and
+	// payment outcomes are recorded on their orders
+	bus := events.FromClient(svc.Redis, events.Options{})
+	svc.Go(outbox.NewRelay(db, bus).Run)
+	svc.Go(func(ctx context.Context) {
+		subscribePaymentEvents(ctx, bus, db)
 	})
 
 	// Setup routes
-	v1 := router.Group("/api/v1/orders")
+	// Orders belong to the user authenticated by the gateway
+	v1 := svc.Router.Group("/api/v1/orders")
+	v1.Use(middleware.RequireIdentity(), middleware.NewRateLimiter(svc.Redis.Redis(), 100, time.Minute).Middleware())
 	{
 		v1.GET("", ListOrders(db))
-		v1.POST("", CreateOrder(db))
+		v1.POST("", CreateOrder(db, settings.ProductServiceURL))
 		v1.GET("/:id", validateUUID(), GetOrder(db))
 		v1.PUT("/:id", validateUUID(), UpdateOrder(db))
 		v1.DELETE("/:id", validateUUID(), DeleteOrder(db))
 	}
 
-	// Run the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8001"
-	}
-	router.Run("0.0.0.0:" + port)
-}
-
-func initDB() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize database: %w", err)
-	}
-
-	// Auto-migrate the Order and OrderItem models
-	if err := db.AutoMigrate(&Order{}, &OrderItem{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	if err := svc.Run(); err != nil {
+		log.Fatal("Order service stopped:", err)
 	}
-
-	return db, nil
 }
@@ -0,0 +1,13 @@
+-- Events waiting to be published by the outbox relay, see pkg/outbox
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(36) NOT NULL,
+    event_type TEXT NOT NULL,
+    event TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    published_at TIMESTAMPTZ,
+    attempts BIGINT,
+    last_error TEXT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_event_id ON outbox (event_id);
+CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox (published_at);
@@ -7,6 +7,10 @@ import (
 	"net/http"
 	"time"
 
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/metrics"
+	"e-commerce-platform/pkg/outbox"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -18,8 +22,30 @@ type CreatePaymentRequest struct {
 	PaymentMethod string    `json:"payment_method" binding:"required"`
 }
 
-func CreatePaymentHandler(db *gorm.DB, client *DummyClient) gin.HandlerFunc {
+var paymentsFailed = metrics.NewCounterVec(
+	"payments_failed_total",
+	"Number of payments rejected by the payment provider, by payment method.",
+	"payment_method",
+)
+
+// eventSource names payment-service in the events it publishes
+const eventSource = "payment-service"
+
+// savePayment stores a processed payment together with the event announcing
+// its outcome. The event is built once the payment has its ID.
+func savePayment(db *gorm.DB, payment *Payment, eventType string, event func() any) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return outbox.Emit(tx, eventSource, eventType, event())
+	})
+}
+
+// CreatePaymentHandler handles POST /api/v1/payments for an order of the user
+func CreatePaymentHandler(db *gorm.DB, client *DummyClient, orders *OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req CreatePaymentRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
@@ -30,6 +56,10 @@ func CreatePaymentHandler(db *gorm.DB, client *DummyClient) gin.HandlerFunc {
 			return
 		}
 
+		if !authorizeOrder(c, orders, req.OrderID.String(), orderNotFound(req.OrderID.String())) {
+			return
+		}
+
 		payment := Payment{
 			OrderID:       req.OrderID,
 			Amount:        req.Amount,
@@ -40,7 +70,25 @@ func CreatePaymentHandler(db *gorm.DB, client *DummyClient) gin.HandlerFunc {
 		// Process with dummy client
 		if err := client.Process(&payment); err != nil {
 			payment.Status = "failed"
-			db.Create(&payment)
+			reason := err.Error()
+			if err := savePayment(db, &payment, events.TypePaymentFailed, func() any {
+				return events.PaymentFailed{
+					PaymentID:     payment.ID.String(),
+					OrderID:       payment.OrderID.String(),
+					Amount:        payment.Amount,
+					Currency:      payment.Currency,
+					PaymentMethod: payment.PaymentMethod,
+					Reason:        reason,
+				}
+			}); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to save payment",
+					"details": err.Error(),
+					"code":    "PAYMENT_SAVE_FAILED",
+				})
+				return
+			}
+			paymentsFailed.WithLabelValues(payment.PaymentMethod).Inc()
 			c.JSON(http.StatusPaymentRequired, gin.H{
 				"error":   "Payment processing failed",
 				"details": err.Error(),
@@ -50,7 +98,23 @@ func CreatePaymentHandler(db *gorm.DB, client *DummyClient) gin.HandlerFunc {
 		}
 
 		payment.Status = "completed"
-		db.Create(&payment)
+		if err := savePayment(db, &payment, events.TypePaymentCompleted, func() any {
+			return events.PaymentCompleted{
+				PaymentID:     payment.ID.String(),
+				OrderID:       payment.OrderID.String(),
+				Amount:        payment.Amount,
+				Currency:      payment.Currency,
+				PaymentMethod: payment.PaymentMethod,
+				TransactionID: payment.TransactionID,
+			}
+		}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to save payment",
+				"details": err.Error(),
+				"code":    "PAYMENT_SAVE_FAILED",
+			})
+			return
+		}
 
 		c.JSON(http.StatusCreated, payment)
 	}
@@ -65,8 +129,11 @@ func (d *DummyClient) Process(p *Payment) error {
 	return nil
 }
 
-func GetPaymentHandler(db *gorm.DB) gin.HandlerFunc {
+// GetPaymentHandler handles GET /api/v1/payments/:id. Payments of other users'
+// orders are not found.
+func GetPaymentHandler(db *gorm.DB, orders *OrderService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		id := c.Param("id")
 
 		// Validate UUID format
@@ -79,14 +146,15 @@ func GetPaymentHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		notFound := gin.H{
+			"error":   "Payment not found",
+			"details": fmt.Sprintf("Payment with ID %s not found", id),
+			"code":    "PAYMENT_NOT_FOUND",
+		}
 		var payment Payment
 		if err := db.First(&payment, "id = ?", id).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{
-					"error":   "Payment not found",
-					"details": fmt.Sprintf("Payment with ID %s not found", id),
-					"code":    "PAYMENT_NOT_FOUND",
-				})
+				c.JSON(http.StatusNotFound, notFound)
 				return
 			}
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -96,7 +164,51 @@ func GetPaymentHandler(db *gorm.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		if !authorizeOrder(c, orders, payment.OrderID.String(), notFound) {
+			return
+		}
 
 		c.JSON(http.StatusOK, payment)
 	}
 }
+
+// ListPaymentsHandler handles GET /api/v1/payments?order_id= for an order of the user
+func ListPaymentsHandler(db *gorm.DB, orders *OrderService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
+		orderID := c.Query("order_id")
+
+		if _, err := uuid.Parse(orderID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid order ID format",
+				"details": "The order_id query parameter is required and must be in UUID format",
+				"code":    "INVALID_ORDER_ID",
+			})
+			return
+		}
+		if !authorizeOrder(c, orders, orderID, orderNotFound(orderID)) {
+			return
+		}
+
+		var payments []Payment
+		if err := db.Where("order_id = ?", orderID).Order("created_at").Find(&payments).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to fetch payments",
+				"details": "An internal error occurred",
+				"code":    "FETCH_PAYMENTS_FAILED",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, payments)
+	}
+}
+
+// orderNotFound is the response for an order that does not exist or belongs to another user
+func orderNotFound(orderID string) gin.H {
+	return gin.H{
+		"error":   "Order not found",
+		"details": fmt.Sprintf("Order with ID %s not found", orderID),
+		"code":    "ORDER_NOT_FOUND",
+	}
+}
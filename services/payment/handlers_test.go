@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"e-commerce-platform/pkg/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory database with the payments table
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own empty in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	// SQLite has no uuid_generate_v4(), so the table is created by hand
+	err = db.Exec(`CREATE TABLE payments (
+		id TEXT PRIMARY KEY,
+		created_at DATETIME,
+		updated_at DATETIME,
+		deleted_at DATETIME,
+		order_id TEXT NOT NULL,
+		amount REAL NOT NULL,
+		currency TEXT NOT NULL DEFAULT 'USD',
+		status TEXT NOT NULL DEFAULT 'pending',
+		payment_method TEXT NOT NULL,
+		transaction_id TEXT
+	)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newOrderStub serves GET /orders/:id like order-service: the order is only
+// found for its owner
+func newOrderStub(t *testing.T, orderID uuid.UUID, owner string) *OrderService {
+	t.Helper()
+	orders := gin.New()
+	orders.Use(middleware.Identity())
+	orders.GET("/orders/:id", func(c *gin.Context) {
+		if c.Param("id") != orderID.String() || middleware.UserID(c) != owner {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found", "code": "ORDER_NOT_FOUND"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ID": orderID, "UserID": owner})
+	})
+	server := httptest.NewServer(orders)
+	t.Cleanup(server.Close)
+	return NewOrderService(server.URL)
+}
+
+func TestPaymentsAreScopedToTheOrderOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+
+	owner, other := uuid.NewString(), uuid.NewString()
+	payment := Payment{ID: uuid.New(), OrderID: uuid.New(), Amount: 10, Currency: "USD", Status: "completed", PaymentMethod: "card"}
+	if err := db.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	orders := newOrderStub(t, payment.OrderID, owner)
+
+	router := gin.New()
+	router.Use(middleware.Identity())
+	v1 := router.Group("/api/v1/payments", middleware.RequireIdentity())
+	v1.GET("", ListPaymentsHandler(db, orders))
+	v1.GET("/:id", GetPaymentHandler(db, orders))
+
+	listPath := "/api/v1/payments?order_id=" + payment.OrderID.String()
+	getPath := "/api/v1/payments/" + payment.ID.String()
+	tests := []struct {
+		name   string
+		path   string
+		userID string
+		role   string
+		want   int
+		found  int
+	}{
+		{"owner lists", listPath, owner, "customer", http.StatusOK, 1},
+		{"owner gets", getPath, owner, "customer", http.StatusOK, 0},
+		{"other user lists", listPath, other, "customer", http.StatusNotFound, 0},
+		{"other user gets", getPath, other, "customer", http.StatusNotFound, 0},
+		{"admin lists", listPath, other, roleAdmin, http.StatusOK, 1},
+		{"admin gets", getPath, other, roleAdmin, http.StatusOK, 0},
+		{"anonymous", listPath, "", "", http.StatusUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.userID != "" {
+				req.Header.Set(middleware.HeaderUserID, tt.userID)
+				req.Header.Set(middleware.HeaderUserRole, tt.role)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.found == 0 {
+				return
+			}
+			var payments []Payment
+			if err := json.Unmarshal(rec.Body.Bytes(), &payments); err != nil {
+				t.Fatal(err)
+			}
+			if len(payments) != tt.found {
+				t.Errorf("listed %d payments, want %d", len(payments), tt.found)
+			}
+		})
+	}
+}
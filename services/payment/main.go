@@ -1,109 +1,74 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"net/http"
 	"os"
 
-	"github.com/gin-gonic/gin"
-	"github.com/hashicorp/consul/api"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"e-commerce-platform/pkg/config"
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/health"
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/outbox"
+	"e-commerce-platform/pkg/service"
+	"github.com/arohanajit/payment-service/migrations"
 )
 
-func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	db, err := initDB()
-	if err != nil {
-		log.Fatal("Database connection failed:", err)
-	}
+// Settings is the configuration of the payment service on top of service.Config
+type Settings struct {
+	// OrderServiceURL is the order API that checks who an order belongs to,
+	// e.g. http://order-service:8001/api/v1
+	OrderServiceURL string `env:"ORDER_SERVICE_URL" required:"true"`
+}
 
-	consulClient, err := initConsul()
+func main() {
+	cfg, err := service.LoadConfig("payment-service", 8004, "payment", "api")
 	if err != nil {
-		log.Fatal("Consul connection failed:", err)
-	}
-
-	if err := registerService(consulClient); err != nil {
-		log.Fatal("Service registration failed:", err)
+		log.Fatal(err)
 	}
-
-	router := gin.Default()
-	paymentClient := &DummyClient{SuccessRate: 1.0}
-
-	v1 := router.Group("/api/v1/payments")
-	{
-		v1.POST("", CreatePaymentHandler(db, paymentClient))
-		v1.GET("/:id", GetPaymentHandler(db))
+	cfg.Database.Migrations = migrations.FS
+
+	// "migrate <command>" manages the schema instead of starting the service
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := service.Migrate(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	router.GET("/health", healthCheck)
-
-	// Run the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8004"
+	var settings Settings
+	if err := config.Load(&settings); err != nil {
+		log.Fatalf("invalid configuration of payment-service:\n%v", err)
 	}
-	router.Run("0.0.0.0:" + port)
-}
+	config.Log("payment-service", settings)
 
-func initDB() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	svc, err := service.New(cfg)
 	if err != nil {
-		return nil, err
+		log.Fatal("Failed to start payment service:", err)
 	}
+	db := svc.DB
 
-	if err := db.AutoMigrate(&Payment{}); err != nil {
-		return nil, err
-	}
+	// Payments cannot be authorized without order-service
+	orders := NewOrderService(settings.OrderServiceURL)
+	svc.Health.Add("order-service", health.Service(settings.OrderServiceURL))
 
-	return db, nil
-}
+	paymentClient := &DummyClient{SuccessRate: 1.0}
 
-func initConsul() (*api.Client, error) {
-	config := api.DefaultConfig()
-	config.Address = os.Getenv("CONSUL_HTTP_ADDR")
-	if config.Address == "" {
-		config.Address = "http://localhost:8500"
+	// Payment outcomes are written to the outbox and relayed to Redis Streams when
+	// Redis is configured
+	if svc.Redis == nil {
+		log.Println("REDIS_HOST not set, payment events are not published to other services")
 	}
-	return api.NewClient(config)
-}
+	svc.Go(outbox.NewRelay(db, events.FromClient(svc.Redis, events.Options{})).Run)
 
-func registerService(client *api.Client) error {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8004"
+	// Payments are only accessible to the owner of their order
+	v1 := svc.Router.Group("/api/v1/payments", middleware.RequireIdentity())
+	{
+		v1.POST("", CreatePaymentHandler(db, paymentClient, orders))
+		v1.GET("", ListPaymentsHandler(db, orders))
+		v1.GET("/:id", GetPaymentHandler(db, orders))
 	}
 
-	registration := &api.AgentServiceRegistration{
-		ID:      "payment-service",
-		Name:    "payment-service",
-		Port:    8004,
-		Address: "payment-service",
-		Check: &api.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://payment-service:%s/health", port),
-			Interval:                       "10s",
-			Timeout:                        "1s",
-			DeregisterCriticalServiceAfter: "30s",
-		},
-		Tags: []string{"payment", "api"},
+	if err := svc.Run(); err != nil {
+		log.Fatal("Payment service stopped:", err)
 	}
-
-	return client.Agent().ServiceRegister(registration)
-}
-
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "UP"})
 }
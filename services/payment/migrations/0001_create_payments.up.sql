@@ -0,0 +1,16 @@
+-- Tables created by earlier releases through GORM are kept as they are
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS payments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    order_id UUID NOT NULL,
+    amount DECIMAL NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'USD',
+    status TEXT NOT NULL DEFAULT 'pending',
+    payment_method TEXT NOT NULL,
+    transaction_id TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_payments_deleted_at ON payments (deleted_at);
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"e-commerce-platform/pkg/logging"
+	"e-commerce-platform/pkg/middleware"
+	"e-commerce-platform/pkg/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleAdmin may see the payments of every order
+const roleAdmin = "admin"
+
+// errOrderNotFound is returned for orders that do not exist or belong to another user
+var errOrderNotFound = errors.New("order not found")
+
+// OrderService looks up orders with the order API
+type OrderService struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOrderService creates a client of the order API at baseURL, e.g.
+// http://order-service:8001/api/v1. It propagates the request ID and trace context.
+func NewOrderService(baseURL string) *OrderService {
+	return &OrderService{
+		baseURL: baseURL,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: tracing.NewTransport(logging.NewTransport(nil)),
+		},
+	}
+}
+
+// CheckOwner returns errOrderNotFound unless the order belongs to the user of
+// the request. order-service only finds the orders of the user named by the
+// forwarded identity headers. Admins may access every order.
+func (s *OrderService) CheckOwner(c *gin.Context, orderID string) error {
+	if middleware.UserRole(c) == roleAdmin {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, s.baseURL+"/orders/"+url.PathEscape(orderID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(middleware.HeaderUserID, middleware.UserID(c))
+	req.Header.Set(middleware.HeaderUserRole, middleware.UserRole(c))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach order-service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return errOrderNotFound
+	default:
+		return fmt.Errorf("order-service returned %s", resp.Status)
+	}
+}
+
+// authorizeOrder responds and returns false unless the order belongs to the
+// user. notFound is the response for orders of other users, so that they
+// cannot be told apart from orders that do not exist.
+func authorizeOrder(c *gin.Context, orders *OrderService, orderID string, notFound gin.H) bool {
+	err := orders.CheckOwner(c, orderID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errOrderNotFound):
+		c.JSON(http.StatusNotFound, notFound)
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":   "Failed to check the order",
+			"details": err.Error(),
+			"code":    "ORDER_LOOKUP_FAILED",
+		})
+	}
+	return false
+}
@@ -10,11 +10,24 @@ NC='\033[0m'
 
 echo "🚀 Starting Payment API tests..."
 
+# Register and log in a throwaway user, the gateway requires a bearer token
+TEST_EMAIL="payment$(date +%s)@example.com"
+curl -s -X POST "${BASE_URL}/users/register" \
+  -H "Content-Type: application/json" \
+  -d '{"email": "'"${TEST_EMAIL}"'", "password": "password123", "first_name": "Test", "last_name": "User"}' > /dev/null
+TOKEN=$(curl -s -X POST "${BASE_URL}/users/login" \
+  -H "Content-Type: application/json" \
+  -d '{"email": "'"${TEST_EMAIL}"'", "password": "password123"}' | jq -r '.token')
+if [ -z "$TOKEN" ] || [ "$TOKEN" == "null" ]; then
+    echo -e "${RED}Failed to obtain auth token${NC}"
+    exit 1
+fi
+
 # Generate a test order ID
 TEST_ORDER_ID=$(uuidgen)
 
 echo -e "\n1. Testing Payment Creation"
-PAYMENT_RESPONSE=$(curl -s -X POST "${BASE_URL}/payments" \
+PAYMENT_RESPONSE=$(curl -s -X POST "${BASE_URL}/payments" -H "Authorization: Bearer ${TOKEN}" \
   -H "Content-Type: application/json" \
   -d "{
     \"order_id\": \"${TEST_ORDER_ID}\",
@@ -36,7 +49,7 @@ else
 fi
 
 echo -e "\n2. Testing Get Payment"
-GET_RESPONSE=$(curl -s -X GET "${BASE_URL}/payments/${PAYMENT_ID}")
+GET_RESPONSE=$(curl -s -X GET "${BASE_URL}/payments/${PAYMENT_ID}" -H "Authorization: Bearer ${TOKEN}")
 echo "Response: ${GET_RESPONSE}"
 
 RETRIEVED_ID=$(echo ${GET_RESPONSE} | jq -r '.ID')
@@ -48,7 +61,7 @@ else
 fi
 
 echo -e "\n3. Testing Invalid Payment ID"
-INVALID_RESPONSE=$(curl -s -X GET "${BASE_URL}/payments/invalid-id")
+INVALID_RESPONSE=$(curl -s -X GET "${BASE_URL}/payments/invalid-id" -H "Authorization: Bearer ${TOKEN}")
 echo "Response: ${INVALID_RESPONSE}"
 
 ERROR_CODE=$(echo ${INVALID_RESPONSE} | jq -r '.code')
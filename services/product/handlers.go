@@ -1,22 +1,41 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
+	"e-commerce-platform/pkg/events"
+	"e-commerce-platform/pkg/outbox"
+	"e-commerce-platform/pkg/redis"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
+// CatalogNotifier is told about every product write, so that cached catalog
+// responses can be purged
+type CatalogNotifier func(ctx context.Context, productID string)
+
+// productListTag tags every cached page of the product listing
+const productListTag = "products:list"
+
+// eventSource names product-service in the events it publishes
+const eventSource = "product-service"
+
 // ListProducts handles GET /api/products
-func ListProducts(db *gorm.DB) gin.HandlerFunc {
+func ListProducts(db *gorm.DB, lists *redis.Cache[[]Product]) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var products []Product
-		if err := db.Find(&products).Error; err != nil {
+		products, err := lists.GetOrLoad(c.Request.Context(), "all", func(ctx context.Context) ([]Product, error) {
+			var products []Product
+			err := db.WithContext(ctx).Find(&products).Error
+			return products, err
+		}, productListTag)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -25,8 +44,9 @@ func ListProducts(db *gorm.DB) gin.HandlerFunc {
 }
 
 // CreateProduct handles POST /api/products
-func CreateProduct(db *gorm.DB) gin.HandlerFunc {
+func CreateProduct(db *gorm.DB, notify CatalogNotifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var product Product
 		if err := c.ShouldBindJSON(&product); err != nil {
 			log.Printf("Error binding JSON: %v", err)
@@ -60,14 +80,31 @@ func CreateProduct(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
-		tx.Commit()
+		if err := outbox.Emit(tx, eventSource, events.TypeProductCreated, events.ProductCreated{
+			ProductID: product.ID.String(),
+			Name:      product.Name,
+			Price:     product.Price,
+			Stock:     product.Stock,
+		}); err != nil {
+			tx.Rollback()
+			log.Printf("Error recording product event: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			log.Printf("Database error committing product: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		notify(c.Request.Context(), product.ID.String())
 		log.Printf("Successfully created product with ID: %v", product.ID)
 		c.JSON(http.StatusCreated, product)
 	}
 }
 
 // GetProduct handles GET /api/products/:id
-func GetProduct(db *gorm.DB) gin.HandlerFunc {
+func GetProduct(db *gorm.DB, products *redis.Cache[Product]) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
@@ -81,9 +118,16 @@ func GetProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		var product Product
-		if err := db.First(&product, "id = ?", id).Error; err != nil {
+		product, err := products.GetOrLoad(c.Request.Context(), id, func(ctx context.Context) (Product, error) {
+			var product Product
+			err := db.WithContext(ctx).First(&product, "id = ?", id).Error
 			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return product, redis.ErrNotExist
+			}
+			return product, err
+		})
+		if err != nil {
+			if errors.Is(err, redis.ErrNotExist) {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error":   "Product not found",
 					"details": fmt.Sprintf("Product with ID %s not found", id),
@@ -104,8 +148,9 @@ func GetProduct(db *gorm.DB) gin.HandlerFunc {
 }
 
 // UpdateProduct handles PUT /api/products/:id
-func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
+func UpdateProduct(db *gorm.DB, notify CatalogNotifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		id := c.Param("id")
 
 		// Validate UUID format
@@ -143,18 +188,31 @@ func UpdateProduct(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Only update specified fields
-		if err := db.Model(&product).Updates(updatedProduct).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&product).Updates(updatedProduct).Error; err != nil {
+				return err
+			}
+			return outbox.Emit(tx, eventSource, events.TypeProductUpdated, events.ProductUpdated{
+				ProductID: id,
+				Name:      product.Name,
+				Price:     product.Price,
+				Stock:     product.Stock,
+			})
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		notify(c.Request.Context(), id)
 
 		c.JSON(http.StatusOK, product)
 	}
 }
 
 // DeleteProduct handles DELETE /api/products/:id
-func DeleteProduct(db *gorm.DB) gin.HandlerFunc {
+func DeleteProduct(db *gorm.DB, notify CatalogNotifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		id := c.Param("id")
 
 		// Validate UUID format
@@ -167,7 +225,13 @@ func DeleteProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&Product{}, "id = ?", id).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&Product{}, "id = ?", id).Error; err != nil {
+				return err
+			}
+			return outbox.Emit(tx, eventSource, events.TypeProductDeleted, events.ProductDeleted{ProductID: id})
+		})
+		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
 				c.JSON(http.StatusNotFound, gin.H{
 					"error":   "Product not found",
@@ -184,6 +248,7 @@ func DeleteProduct(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		notify(c.Request.Context(), id)
 		c.JSON(http.StatusOK, gin.H{"message": "Product deleted"})
 	}
 }
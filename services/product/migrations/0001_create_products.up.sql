@@ -0,0 +1,17 @@
+-- Tables created by earlier releases through GORM are kept as they are
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS products (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    name TEXT NOT NULL,
+    description TEXT,
+    price DECIMAL NOT NULL,
+    stock BIGINT NOT NULL,
+    images TEXT[] DEFAULT '{}'
+);
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+
+ALTER TABLE products ALTER COLUMN images SET DEFAULT '{}';
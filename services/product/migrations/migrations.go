@@ -0,0 +1,9 @@
+// Package migrations holds the versioned schema of product-service
+package migrations
+
+import "embed"
+
+// FS holds the migration files, applied with pkg/migrate
+//
+//go:embed *.sql
+var FS embed.FS
@@ -3,34 +3,34 @@ package main
 import (
 	"fmt"
 	"net/smtp"
-	"os"
 )
 
+// SMTPConfig is the mail server password reset emails are sent through
+type SMTPConfig struct {
+	Host     string `env:"SMTP_HOST"`
+	Port     int    `env:"SMTP_PORT" default:"587" min:"1" max:"65535"`
+	Username string `env:"SMTP_USERNAME"`
+	Password string `env:"SMTP_PASSWORD" secret:"true"`
+	From     string `env:"SMTP_FROM"`
+}
+
 type EmailService struct {
-	host     string
-	port     string
-	username string
-	password string
-	from     string
+	smtp   SMTPConfig
+	appURL string
 }
 
-func NewEmailService() *EmailService {
-	return &EmailService{
-		host:     os.Getenv("SMTP_HOST"),
-		port:     os.Getenv("SMTP_PORT"),
-		username: os.Getenv("SMTP_USERNAME"),
-		password: os.Getenv("SMTP_PASSWORD"),
-		from:     os.Getenv("SMTP_FROM"),
-	}
+// NewEmailService sends emails linking to the frontend at appURL
+func NewEmailService(cfg SMTPConfig, appURL string) *EmailService {
+	return &EmailService{smtp: cfg, appURL: appURL}
 }
 
 func (e *EmailService) SendPasswordResetEmail(to, resetToken string) error {
 	// Create authentication
-	auth := smtp.PlainAuth("", e.username, e.password, e.host)
+	auth := smtp.PlainAuth("", e.smtp.Username, e.smtp.Password, e.smtp.Host)
 
 	// Compose email
 	subject := "Password Reset Request"
-	resetLink := fmt.Sprintf("%s/reset-password?token=%s", os.Getenv("APP_URL"), resetToken)
+	resetLink := fmt.Sprintf("%s/reset-password?token=%s", e.appURL, resetToken)
 	body := fmt.Sprintf(`
 		<html>
 			<body>
@@ -46,9 +46,9 @@ func (e *EmailService) SendPasswordResetEmail(to, resetToken string) error {
 	// Format email headers
 	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
 	msg := fmt.Sprintf("To: %s\r\nFrom: %s\r\nSubject: %s\r\n%s\r\n%s",
-		to, e.from, subject, mime, body)
+		to, e.smtp.From, subject, mime, body)
 
 	// Send email
-	addr := fmt.Sprintf("%s:%s", e.host, e.port)
-	return smtp.SendMail(addr, auth, e.from, []string{to}, []byte(msg))
+	addr := fmt.Sprintf("%s:%d", e.smtp.Host, e.smtp.Port)
+	return smtp.SendMail(addr, auth, e.smtp.From, []string{to}, []byte(msg))
 }
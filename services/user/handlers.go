@@ -3,7 +3,6 @@ package main
 import (
 	"errors"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -47,6 +46,7 @@ type ResetPasswordRequest struct {
 
 func Register(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req RegisterRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -90,8 +90,9 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func Login(db *gorm.DB) gin.HandlerFunc {
+func Login(db *gorm.DB, jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var loginReq LoginRequest
 		if err := c.ShouldBindJSON(&loginReq); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -116,7 +117,7 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			"exp":     time.Now().Add(time.Hour * 24).Unix(),
 		})
 
-		tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+		tokenString, err := token.SignedString([]byte(jwtSecret))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 			return
@@ -131,6 +132,7 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 
 func GetProfile(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		if userID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User ID not found in token"})
@@ -149,6 +151,7 @@ func GetProfile(db *gorm.DB) gin.HandlerFunc {
 
 func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 
 		var user User
@@ -197,6 +200,7 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 
 func AddAddress(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		var address Address
 		if err := c.ShouldBindJSON(&address); err != nil {
@@ -221,6 +225,7 @@ func AddAddress(db *gorm.DB) gin.HandlerFunc {
 
 func ListAddresses(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		var addresses []Address
 		if err := db.Where("user_id = ?", userID).Find(&addresses).Error; err != nil {
@@ -234,6 +239,7 @@ func ListAddresses(db *gorm.DB) gin.HandlerFunc {
 // RequestPasswordReset handles the password reset request
 func RequestPasswordReset(db *gorm.DB, emailService *EmailService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req RequestPasswordResetRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -273,6 +279,7 @@ func RequestPasswordReset(db *gorm.DB, emailService *EmailService) gin.HandlerFu
 // ResetPassword handles the password reset
 func ResetPassword(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		var req ResetPasswordRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -327,6 +334,7 @@ type ChangePasswordRequest struct {
 
 func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		var req ChangePasswordRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -364,6 +372,7 @@ func ChangePassword(db *gorm.DB) gin.HandlerFunc {
 
 func UpdateAddress(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		addressID := c.Param("id")
 
@@ -398,6 +407,7 @@ func UpdateAddress(db *gorm.DB) gin.HandlerFunc {
 
 func DeleteAddress(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		addressID := c.Param("id")
 
@@ -415,8 +425,37 @@ func DeleteAddress(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// SetDefaultAddress marks one of the user's addresses as default and clears the flag on the others
+func SetDefaultAddress(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
+		userID := c.GetString("user_id")
+		addressID := c.Param("id")
+
+		var address Address
+		if err := db.Where("id = ? AND user_id = ?", addressID, userID).First(&address).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&Address{}).Where("user_id = ?", userID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+			return tx.Model(&address).Update("is_default", true).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set default address"})
+			return
+		}
+
+		c.JSON(http.StatusOK, address)
+	}
+}
+
 func DeleteAccount(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := db.WithContext(c.Request.Context())
 		userID := c.GetString("user_id")
 		if userID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
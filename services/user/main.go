@@ -1,100 +1,64 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
 
+	"e-commerce-platform/pkg/config"
+	"e-commerce-platform/pkg/service"
 	"github.com/arohanajit/user-service/middleware"
-
-	"github.com/gin-gonic/gin"
-	"github.com/hashicorp/consul/api"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
+	"github.com/arohanajit/user-service/migrations"
 )
 
-func initConsul() (*api.Client, error) {
-	config := api.DefaultConfig()
-	config.Address = os.Getenv("CONSUL_HTTP_ADDR")
-	if config.Address == "" {
-		config.Address = "http://localhost:8500"
-	}
-	return api.NewClient(config)
-}
-
-func registerService(client *api.Client) error {
-	port, _ := strconv.Atoi(os.Getenv("PORT"))
-	registration := &api.AgentServiceRegistration{
-		ID:      "user-service",
-		Name:    "user-service",
-		Port:    port,
-		Address: "user-service",
-		Check: &api.AgentServiceCheck{
-			HTTP:                           fmt.Sprintf("http://user-service:%d/health", port),
-			Interval:                       "10s",
-			Timeout:                        "1s",
-			DeregisterCriticalServiceAfter: "30s",
-		},
-		Tags: []string{"user", "api"},
-	}
-	return client.Agent().ServiceRegister(registration)
+// Settings is the configuration of the user service on top of service.Config
+type Settings struct {
+	// JWTSecret signs the tokens issued at login, the gateway verifies them
+	// with the same secret
+	JWTSecret string `env:"JWT_SECRET" required:"true" secret:"true" insecure:"your-secret-key,your-default-secret-key"`
+	// AppURL is the frontend that password reset links point to
+	AppURL string `env:"APP_URL" default:"http://localhost:3000"`
+	SMTP   SMTPConfig
 }
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Initialize database
-	db, err := initDB()
+	cfg, err := service.LoadConfig("user-service", 8002, "user", "api")
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatal(err)
 	}
-
-	// Auto migrate the schema
-	if err := db.AutoMigrate(&User{}, &Address{}); err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	cfg.Database.Migrations = migrations.FS
+
+	// "migrate <command>" manages the schema instead of starting the service
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := service.Migrate(cfg, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Initialize Consul client
-	consulClient, err := initConsul()
-	if err != nil {
-		log.Fatal("Failed to create Consul client:", err)
+	var settings Settings
+	if err := config.Load(&settings); err != nil {
+		log.Fatalf("invalid configuration of user-service:\n%v", err)
 	}
+	config.Log("user-service", settings)
 
-	// Register service with Consul
-	if err := registerService(consulClient); err != nil {
-		log.Fatal("Failed to register service:", err)
+	svc, err := service.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to start user service:", err)
 	}
+	db := svc.DB
 
 	// Initialize email service
-	emailService := NewEmailService()
-
-	// Initialize router
-	r := gin.Default()
-
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
-	})
+	emailService := NewEmailService(settings.SMTP, settings.AppURL)
 
 	// Public routes
-	r.POST("/register", Register(db))
-	r.POST("/login", Login(db))
-	r.POST("/forgot-password", RequestPasswordReset(db, emailService))
-	r.POST("/reset-password", ResetPassword(db))
+	svc.Router.POST("/register", Register(db))
+	svc.Router.POST("/login", Login(db, settings.JWTSecret))
+	svc.Router.POST("/forgot-password", RequestPasswordReset(db, emailService))
+	svc.Router.POST("/reset-password", ResetPassword(db))
 
 	// Protected routes
-	protected := r.Group("/")
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "your-default-secret-key"
-	}
-	protected.Use(middleware.AuthMiddleware(jwtSecret))
+	protected := svc.Router.Group("/")
+	protected.Use(middleware.AuthMiddleware(settings.JWTSecret))
 	{
 		// Profile management
 		protected.GET("/profile", GetProfile(db))
@@ -107,42 +71,12 @@ func main() {
 		protected.GET("/addresses", ListAddresses(db))
 		protected.PUT("/addresses/:id", UpdateAddress(db))
 		protected.DELETE("/addresses/:id", DeleteAddress(db))
+		protected.PUT("/addresses/:id/default", SetDefaultAddress(db))
 	}
 
-	// Run the server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8002"
-	}
-	r.Run("0.0.0.0:" + port)
-}
-
-func initDB() (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, err
+	if err := svc.Run(); err != nil {
+		log.Fatal("User service stopped:", err)
 	}
-
-	// Drop existing tables
-	db.Migrator().DropTable(&Address{}, &User{})
-
-	// Enable uuid-ossp extension
-	db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\";")
-
-	// Auto-migrate with new schema
-	if err := db.AutoMigrate(&User{}, &Address{}); err != nil {
-		return nil, err
-	}
-
-	return db, nil
 }
 
 // Additional helper functions...
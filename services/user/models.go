@@ -37,6 +37,7 @@ type Address struct {
 	State      string    `json:"state"`
 	Country    string    `json:"country"`
 	PostalCode string    `json:"postal_code"`
+	IsDefault  bool      `gorm:"default:false" json:"is_default"`
 	UserID     uuid.UUID `json:"user_id"`
 	User       User      `gorm:"constraint:OnDelete:CASCADE;"`
 }
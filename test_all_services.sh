@@ -143,7 +143,6 @@ ORDER_RESPONSE=$(curl -s -X POST "${GATEWAY_URL}/orders" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $TOKEN" \
   -d '{
-    "user_id": "'"$USER_ID"'",
     "items": [
       {
         "product_id": "'"$PRODUCT_ID"'",
@@ -158,6 +157,7 @@ ORDER_ID=$(echo $ORDER_RESPONSE | jq -r '.ID')
 echo -e "\n${GREEN}5. Testing Payment Creation${NC}"
 PAYMENT_RESPONSE=$(curl -s -X POST "${GATEWAY_URL}/payments" \
   -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $TOKEN" \
   -d "{
     \"order_id\": \"${ORDER_ID}\",
     \"amount\": 1999.99,
@@ -177,7 +177,8 @@ fi
 
 # Test Payment Retrieval
 echo -e "\n${GREEN}6. Testing Payment Retrieval${NC}"
-GET_PAYMENT_RESPONSE=$(curl -s -X GET "${GATEWAY_URL}/payments/${PAYMENT_ID}")
+GET_PAYMENT_RESPONSE=$(curl -s -X GET "${GATEWAY_URL}/payments/${PAYMENT_ID}" \
+  -H "Authorization: Bearer $TOKEN")
 echo "Response: $GET_PAYMENT_RESPONSE"
 
 RETRIEVED_PAYMENT_ID=$(echo ${GET_PAYMENT_RESPONSE} | jq -r '.ID')
@@ -190,7 +191,8 @@ fi
 
 # Test Invalid Payment ID
 echo -e "\n${GREEN}7. Testing Invalid Payment ID${NC}"
-INVALID_PAYMENT_RESPONSE=$(curl -s -X GET "${GATEWAY_URL}/payments/invalid-id")
+INVALID_PAYMENT_RESPONSE=$(curl -s -X GET "${GATEWAY_URL}/payments/invalid-id" \
+  -H "Authorization: Bearer $TOKEN")
 echo "Response: $INVALID_PAYMENT_RESPONSE"
 
 PAYMENT_ERROR_CODE=$(echo ${INVALID_PAYMENT_RESPONSE} | jq -r '.code')